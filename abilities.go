@@ -0,0 +1,196 @@
+// This file implements special abilities for monsters: cooldown-based
+// special moves used during their turn instead of a normal action.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// abilityKind represents a kind of special ability.
+type abilityKind int
+
+// These constants represent the available kinds of abilities.
+const (
+	AbilityPoisonBite abilityKind = iota // poisons an adjacent target
+	AbilityWeb                           // traps a target in a web from a distance
+	AbilityCharge                        // rushes in straight line and attacks
+	AbilityBlink                         // teleports away when wounded and cornered
+	AbilityParalyze                      // paralyzes an adjacent target
+	AbilityRend                          // makes an adjacent target bleed
+)
+
+// Ability represents a special ability of a monster, that can be used again
+// only after a cooldown.
+type Ability struct {
+	Kind     abilityKind `json:"kind"`
+	Cooldown int         `json:"cooldown"` // turns between two uses
+	Wait     int         `json:"wait"`     // turns before the ability is ready again
+}
+
+// Abilities lists the special abilities of a monster.
+type Abilities []*Ability
+
+// Ability parameters.
+const (
+	poisonTurns   = 5 // turns of poison inflicted by a bite
+	webTurns      = 3 // turns stuck in a web
+	webRange      = 4 // range of web throws
+	chargeRange   = 4 // maximum distance for charging
+	paralyzeTurns = 2 // turns of paralysis inflicted by a touch
+)
+
+// UseAbility makes monster i use one of its ready abilities against target,
+// if possible. It returns true if an ability was used. Cooldowns are updated
+// in any case.
+func (g *game) UseAbility(i, target int) bool {
+	used := false
+	for _, ab := range g.ECS.Abilities[i] {
+		if ab.Wait > 0 {
+			ab.Wait--
+			continue
+		}
+		if used || target < 0 {
+			continue
+		}
+		switch ab.Kind {
+		case AbilityPoisonBite:
+			used = g.PoisonBite(i, target)
+		case AbilityWeb:
+			used = g.ThrowWeb(i, target)
+		case AbilityCharge:
+			used = g.Charge(i, target)
+		case AbilityBlink:
+			used = g.Blink(i, target)
+		case AbilityParalyze:
+			used = g.ParalyzingTouch(i, target)
+		case AbilityRend:
+			used = g.Rend(i, target)
+		}
+		if used {
+			ab.Wait = ab.Cooldown
+		}
+	}
+	return used
+}
+
+// PoisonBite makes monster i bite an adjacent target, poisoning it if the
+// bite hurts.
+func (g *game) PoisonBite(i, target int) bool {
+	p, q := g.ECS.Positions[i], g.ECS.Positions[target]
+	if paths.DistanceManhattan(p, q) != 1 {
+		return false
+	}
+	hp := g.ECS.Fighter[target].HP
+	g.Attack(i, target, "bites")
+	if g.ECS.Alive(target) && g.ECS.Fighter[target].HP < hp {
+		g.ECS.PutStatus(target, StatusPoisoned, poisonTurns)
+		if g.InFOV(q) {
+			g.Logf("%v is poisoned!", ColorLogAbility, g.ECS.HighlightName(target, g.ECS.GetName(target)))
+		}
+	}
+	return true
+}
+
+// ParalyzingTouch makes monster i attack an adjacent target that is not
+// already paralyzed, paralyzing it if the touch hurts.
+func (g *game) ParalyzingTouch(i, target int) bool {
+	p, q := g.ECS.Positions[i], g.ECS.Positions[target]
+	if paths.DistanceManhattan(p, q) != 1 || g.ECS.Status(target, StatusParalyzed) {
+		return false
+	}
+	hp := g.ECS.Fighter[target].HP
+	g.Attack(i, target, "touches")
+	if g.ECS.Alive(target) && g.ECS.Fighter[target].HP < hp {
+		g.ECS.PutStatus(target, StatusParalyzed, paralyzeTurns)
+		if g.InFOV(q) {
+			g.Logf("%v is paralyzed!", ColorLogAbility, g.ECS.HighlightName(target, g.ECS.GetName(target)))
+		}
+	}
+	return true
+}
+
+// Rend makes monster i bite an adjacent target, making it bleed if the bite
+// hurts.
+func (g *game) Rend(i, target int) bool {
+	p, q := g.ECS.Positions[i], g.ECS.Positions[target]
+	if paths.DistanceManhattan(p, q) != 1 {
+		return false
+	}
+	hp := g.ECS.Fighter[target].HP
+	g.Attack(i, target, "rends")
+	if g.ECS.Alive(target) && g.ECS.Fighter[target].HP < hp {
+		g.Wound(target)
+	}
+	return true
+}
+
+// ThrowWeb makes monster i throw a web at a non-adjacent target within range,
+// trapping it for a few turns.
+func (g *game) ThrowWeb(i, target int) bool {
+	p, q := g.ECS.Positions[i], g.ECS.Positions[target]
+	dist := paths.DistanceManhattan(p, q)
+	if dist <= 1 || dist > webRange || g.ECS.Status(target, StatusWebbed) || !g.ClearShot(p, q) {
+		return false
+	}
+	g.ECS.PutStatus(target, StatusWebbed, webTurns)
+	if g.InFOV(p) || g.InFOV(q) {
+		g.Logf("%v throws a web at %v!", ColorLogAbility, g.ECS.HighlightName(i, g.ECS.Name[i]),
+			g.ECS.HighlightName(target, g.ECS.Name[target]))
+	}
+	return true
+}
+
+// Charge makes monster i rush toward a target in the same row or column,
+// and attack it in the same turn.
+func (g *game) Charge(i, target int) bool {
+	p, q := g.ECS.Positions[i], g.ECS.Positions[target]
+	dist := paths.DistanceManhattan(p, q)
+	if dist <= 1 || dist > chargeRange || p.X != q.X && p.Y != q.Y {
+		return false
+	}
+	dir := gruid.Point{sign(q.X - p.X), sign(q.Y - p.Y)}
+	for r := p.Add(dir); r != q; r = r.Add(dir) {
+		if !g.Map.Walkable(r) || !g.ECS.NoBlockingEntityAt(r) {
+			return false
+		}
+	}
+	g.ECS.MoveEntity(i, q.Sub(dir))
+	g.ECS.AI[i].Path = nil
+	if g.InFOV(p) || g.InFOV(q) {
+		g.Logf("%v charges!", ColorLogAbility, g.ECS.HighlightName(i, g.ECS.Name[i]))
+	}
+	g.Attack(i, target, "slams")
+	return true
+}
+
+func init() {
+	registerTurnHook(turnHook{Name: "poison", Order: turnEffects, Run: (*game).PoisonNextTurn})
+}
+
+// PoisonNextTurn inflicts poison damage to poisoned fighters. Fighters
+// wearing a ring of poison resistance take no damage.
+func (g *game) PoisonNextTurn() {
+	for _, i := range g.ECS.Fighter.sortedKeys() {
+		if !g.ECS.Alive(i) || !g.ECS.Status(i, StatusPoisoned) || g.WearsRing(i, RingPoisonResistance) {
+			continue
+		}
+		g.Damage(i, 1)
+		if i == g.ECS.PlayerID {
+			g.Logf("You suffer from poison.", ColorLogAbility)
+		}
+	}
+}
+
+// Blink makes monster i teleport away if it is wounded and its target is
+// adjacent.
+func (g *game) Blink(i, target int) bool {
+	fi := g.ECS.Fighter[i]
+	if fi.HP*2 > fi.MaxHP || paths.DistanceManhattan(g.ECS.Positions[i], g.ECS.Positions[target]) > 1 {
+		return false
+	}
+	g.Teleport(i)
+	g.ECS.AI[i].Path = nil
+	return true
+}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"errors"
 	"log"
 
 	"github.com/anaseto/gruid"
@@ -19,70 +20,185 @@ type actionType int
 
 // These constants represent the possible UI actions.
 const (
-	NoAction           actionType = iota
-	ActionBump                    // bump request (attack or movement)
-	ActionDrop                    // menu to drop an inventory item
-	ActionInventory               // inventory menu to use an item
-	ActionPickup                  // pickup an item on the ground
-	ActionWait                    // wait a turn
-	ActionQuit                    // quit the game (without saving)
-	ActionSave                    // save the game
-	ActionViewMessages            // view history messages
-	ActionExamine                 // examine map
+	NoAction            actionType = iota
+	ActionBump                     // bump request (attack or movement)
+	ActionDrop                     // menu to drop an inventory item
+	ActionInventory                // inventory menu to use an item
+	ActionPickup                   // pickup an item on the ground
+	ActionWait                     // wait a turn
+	ActionQuit                     // quit the game (without saving)
+	ActionSave                     // save the game
+	ActionViewMessages             // view history messages
+	ActionExamine                  // examine map
+	ActionDescend                  // descend stairs
+	ActionAscend                   // climb stairs back to the town
+	ActionDestroyCorpse            // destroy a corpse on the floor
+	ActionEquip                    // menu to equip or unequip an item
+	ActionViewQuests               // view quest journal
+	ActionViewCharacter            // view character sheet
+	ActionOrderAllies              // cycle orders given to allies
+	ActionInteract                 // context-aware interaction
+	ActionAutoEquip                // equip best available gear
+	ActionDropWorse                // drop strictly worse gear
+	ActionRepeatTarget             // repeat targeted attack on last target
+	ActionFire                     // shoot an arrow with an equipped bow
+	ActionExportTurns              // export the turn log (bug reports)
+	ActionThrow                    // inventory menu to throw a potion
+	ActionAutoPickup               // auto-pickup settings menu
+	ActionTravel                   // travel to the nearest noteworthy feature
+	ActionBash                     // bash an adjacent enemy with a shield
 )
 
 // handleAction updates the model in response to current recorded last action.
 func (m *model) handleAction() gruid.Effect {
+	var eff gruid.Effect
+	if m.action.Type == ActionInteract {
+		// We replace the interaction by the concrete action it
+		// corresponds to in the current context.
+		a, err := m.game.InteractAction()
+		if err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+		}
+		m.action = a
+	}
 	switch m.action.Type {
 	case ActionBump:
-		np := m.game.ECS.PP().Add(m.action.Delta)
+		np := m.game.ECS.PP().Add(m.game.ConfusedDelta(m.action.Delta))
+		if i := m.game.ECS.NPCAt(np); i >= 0 && len(m.game.Services(i)) > 0 {
+			if err := m.game.CheckHostility(i); err != nil {
+				m.game.Logf("%v", ColorLogSpecial, err)
+				break
+			}
+			m.game.Talk(i)
+			m.OpenServices(i)
+			m.mode = modeService
+			break
+		}
 		m.game.Bump(np)
 	case ActionDrop:
-		m.OpenInventory("Drop item")
+		m.marked = nil
+		m.OpenInventory(dropTitle)
 		m.mode = modeInventoryDrop
 	case ActionInventory:
 		m.OpenInventory("Use item")
 		m.mode = modeInventoryActivate
+	case ActionThrow:
+		m.OpenInventory("Throw potion")
+		m.mode = modeInventoryThrow
+	case ActionAutoPickup:
+		m.OpenAutoPickupSettings()
+	case ActionTravel:
+		if err := m.game.Travel(); err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+		}
+	case ActionEquip:
+		m.OpenInventory("Equip or remove item")
+		m.mode = modeInventoryEquip
 	case ActionPickup:
 		m.game.PickupItem()
 	case ActionWait:
 		m.game.EndTurn()
 	case ActionSave:
-		data, err := EncodeGame(m.game)
-		if err == nil {
-			err = SaveFile("save", data)
-		}
-		if err != nil {
+		if err := m.SaveGame(true); err != nil {
 			m.game.Logf("Could not save game.", ColorLogSpecial)
 			log.Printf("could not save game: %v", err)
 			break
 		}
 		return gruid.End()
 	case ActionQuit:
-		// Remove any previously saved files (if any).
-		RemoveDataFile("save")
-		// for now, just terminate with gruid End command: this will
-		// have to be updated later when implementing saving.
-		return gruid.End()
+		m.Confirm("Really quit and abandon this game?", func() gruid.Effect {
+			// Remove any previously saved files (if any).
+			RemoveDataFile(saveFile)
+			RemoveDataFile(eventsFile)
+			return gruid.End()
+		})
 	case ActionViewMessages:
 		m.mode = modeMessageViewer
 		lines := []ui.StyledText{}
 		for _, e := range m.game.Log {
-			st := gruid.Style{}
-			st.Fg = e.Color
-			lines = append(lines, ui.NewStyledText(e.String(), st))
+			lines = append(lines, e.StyledText())
 		}
 		m.viewer.SetLines(lines)
+	case ActionViewQuests:
+		m.mode = modeQuestJournal
+		m.journal.SetLines(m.game.QuestJournalLines())
+	case ActionViewCharacter:
+		m.mode = modeCharacterSheet
+		m.charsheet.SetLines(m.game.CharacterSheetLines())
 	case ActionExamine:
 		m.mode = modeExamination
 		m.targ.pos = m.game.ECS.PP().Shift(0, LogLines)
+	case ActionDescend:
+		if err := m.game.Descend(); err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+			break
+		}
+		m.startMapGenDebug()
+	case ActionAscend:
+		if err := m.game.Ascend(); err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+		}
+	case ActionDestroyCorpse:
+		if err := m.game.DestroyCorpse(); err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+		}
+	case ActionOrderAllies:
+		m.game.OrderAllies()
+	case ActionRepeatTarget:
+		if m.game.LastTarget.Shot {
+			p, ok := m.game.LastTargetPos()
+			if !ok {
+				m.game.Logf("You have no visible target to shoot again.", ColorLogSpecial)
+				break
+			}
+			eff = m.fireAt(p)
+			break
+		}
+		if err := m.game.RepeatTargetedAttack(); err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+			break
+		}
+		m.game.EndTurn()
+	case ActionBash:
+		if err := m.game.ShieldBash(m.game.ECS.PlayerID); err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+			break
+		}
+		m.game.EndTurn()
+	case ActionFire:
+		if err := m.game.CheckFire(m.game.ECS.PlayerID); err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+			break
+		}
+		p, ok := m.game.LastTargetPos()
+		if !ok {
+			p = m.game.ECS.PP()
+		}
+		m.targ = targeting{pos: p.Shift(0, LogLines), fire: true}
+		m.mode = modeTargeting
+	case ActionExportTurns:
+		if err := m.game.ExportTurns(turnLogLength); err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+		}
+	case ActionDropWorse:
+		if err := m.OpenDropWorse(); err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+		}
+	case ActionAutoEquip:
+		if err := m.game.AutoEquip(m.game.ECS.PlayerID); err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+			break
+		}
+		m.game.EndTurn()
 	}
 	if m.game.ECS.PlayerDied() {
 		m.game.Logf("You died -- press “q” or escape to quit", ColorLogSpecial)
-		m.mode = modeEnd
-		return nil
+		return m.endGame("died")
+	}
+	if m.game.Won {
+		return m.endGame("won")
 	}
-	return nil
+	return eff
 }
 
 // Bump moves the player to a given position and updates FOV information,
@@ -91,6 +207,11 @@ func (g *game) Bump(to gruid.Point) {
 	if !g.Map.Walkable(to) {
 		return
 	}
+	if i := g.ECS.MonsterAt(to); g.ECS.Ally(i) && g.ECS.Alive(i) {
+		g.SwapWithAlly(i)
+		g.EndTurn()
+		return
+	}
 	if i := g.ECS.MonsterAt(to); g.ECS.Alive(i) {
 		// We show a message to standard error. Later in the tutorial,
 		// we'll put a message in the UI instead.
@@ -98,19 +219,68 @@ func (g *game) Bump(to gruid.Point) {
 		g.EndTurn()
 		return
 	}
-	// We move the player to the new destination.
+	if i := g.ECS.NPCAt(to); i >= 0 {
+		g.Talk(i)
+		return
+	}
+	if g.ECS.Status(g.ECS.PlayerID, StatusWebbed) {
+		g.Logf("You struggle against the web.", ColorLogAbility)
+		g.EndTurn()
+		return
+	}
+	// We move the player to the new destination. Tall grass gets trampled
+	// by the player, but monsters can hide and move through it.
 	g.ECS.MovePlayer(to)
+	g.Map.Trample(to)
+	g.AutoPickup()
 	g.EndTurn()
 }
 
+// PickupGold picks up a gold pile at the player's position, if any, and
+// returns true in that case. Gold does not take inventory space, so it is
+// picked up automatically when walking over it.
+func (g *game) PickupGold() bool {
+	pp := g.ECS.PP()
+	for _, i := range g.ECS.EntitiesAt(pp) {
+		gold, ok := g.ECS.Entities[i].(*Gold)
+		if !ok {
+			continue
+		}
+		g.ECS.Player().Gold += gold.Amount
+		g.Logf("You pickup %s gold.", ColorLogItemUse, Highlight(MarkupItem, gold.Amount))
+		g.ECS.RemoveEntity(i)
+		return true
+	}
+	return false
+}
+
+// ConfusedDelta returns the direction in which the player actually moves when
+// trying to move in direction delta: a confused player sometimes stumbles in
+// a random direction.
+func (g *game) ConfusedDelta(delta gruid.Point) gruid.Point {
+	if !g.ECS.Status(g.ECS.PlayerID, StatusConfused) || g.Rand(RNGCombat).Intn(2) == 0 {
+		return delta
+	}
+	dirs := []gruid.Point{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	return dirs[g.Rand(RNGCombat).Intn(len(dirs))]
+}
+
 // PickupItem takes an item on the floor.
 func (g *game) PickupItem() {
+	if g.PickupAmulet() {
+		return
+	}
+	if g.PickupGold() {
+		g.EndTurn()
+		return
+	}
 	pp := g.ECS.PP()
-	for i, p := range g.ECS.Positions {
-		if p != pp {
-			// Skip entities whose position is diffferent than the
-			// player's.
-			continue
+	for _, i := range g.ECS.EntitiesAt(pp) {
+		name := g.ECS.HighlightName(i, g.ECS.GetName(i))
+		if g.StackArrows(g.ECS.PlayerID, i) {
+			g.Logf("You pickup %v", ColorLogItemUse, name)
+			g.EndTurn()
+			return
 		}
 		err := g.InventoryAdd(g.ECS.PlayerID, i)
 		if err != nil {
@@ -122,31 +292,42 @@ func (g *game) PickupItem() {
 			g.Logf("Could not pickup: %v", ColorLogSpecial, err)
 			return
 		}
-		g.Logf("You pickup %v", ColorLogItemUse, g.ECS.Name[i])
+		g.Logf("You pickup %v", ColorLogItemUse, name)
 		g.EndTurn()
 		return
 	}
 }
 
+// DestroyCorpse destroys a corpse at the player's position, so that it cannot
+// be raised by necromancers.
+func (g *game) DestroyCorpse() error {
+	pp := g.ECS.PP()
+	for _, i := range g.ECS.EntitiesAt(pp) {
+		if _, ok := g.ECS.Entities[i].(*Corpse); !ok {
+			continue
+		}
+		g.Logf("You hack the %s to pieces.", ColorLogItemUse, g.ECS.Name[i])
+		g.ECS.RemoveEntity(i)
+		g.EndTurn()
+		return nil
+	}
+	return errors.New("There is no corpse here.")
+}
+
 // OpenInventory opens the inventory and allows the player to select an item.
 func (m *model) OpenInventory(title string) {
 	inv := m.game.ECS.Inventory[m.game.ECS.PlayerID]
-	// We build a list of entries.
-	entries := []ui.MenuEntry{}
-	r := 'a'
+	// We build a list of entries, with letter shortcuts.
+	lp := listPicker{Title: title, Footer: "? - describe", Letters: true}
 	for _, it := range inv.Items {
-		name := m.game.ECS.Name[it]
-		entries = append(entries, ui.MenuEntry{
-			Text: ui.Text(string(r) + " - " + name),
-			// allow to use the character r to select the entry
-			Keys: []gruid.Key{gruid.Key(r)},
-		})
-		r++
+		name := m.game.ECS.GetName(it)
+		if j, ok := m.game.ECS.Equipment[m.game.ECS.PlayerID][SlotOffhand]; ok && j == it {
+			name += " (off-hand)"
+		} else if m.game.ECS.Equipped(m.game.ECS.PlayerID, it) {
+			name += " (equipped)"
+		}
+		lp.Entries = append(lp.Entries, pickerEntry{Text: name, Marked: m.marked[len(lp.Entries)]})
 	}
 	// We create a new menu widget for the inventory window.
-	m.inventory = ui.NewMenu(ui.MenuConfig{
-		Grid:    gruid.NewGrid(40, MapHeight),
-		Box:     &ui.Box{Title: ui.Text(title)},
-		Entries: entries,
-	})
+	m.inventory = lp.Menu()
 }
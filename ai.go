@@ -3,10 +3,9 @@
 package main
 
 import (
-	"math/rand"
-
 	"github.com/anaseto/gruid"
 	"github.com/anaseto/gruid/paths"
+	"github.com/anaseto/gruid/rl"
 )
 
 // HandleMonsterTurn handles a monster's turn. The function assumes the entity
@@ -17,24 +16,48 @@ func (g *game) HandleMonsterTurn(i int) {
 		// Do nothing if the entity corresponds to a dead monster.
 		return
 	}
+	if g.ECS.Status(i, StatusParalyzed) {
+		// Paralyzed monsters skip their turns.
+		return
+	}
+	ai := g.ECS.AI[i]
 	if g.ECS.Status(i, StatusConfused) {
+		ai.State = AIWandering
 		g.HandleConfusedMonster(i)
 		return
 	}
+	if g.ECS.Ally(i) {
+		g.HandleAllyTurn(i)
+		return
+	}
 	p := g.ECS.Positions[i]
-	ai := g.ECS.AI[i]
-	aip := &aiPath{g: g}
-	pp := g.ECS.PP()
-	if paths.DistanceManhattan(p, pp) == 1 {
-		// If the monster is adjacent to the player, attack.
-		g.BumpAttack(i, g.ECS.PlayerID)
+	target := g.AITarget(i)
+	ai.State = AIWandering
+	if target >= 0 {
+		ai.State = AIHunting
+	}
+	if g.UseAbility(i, target) {
+		return
+	}
+	if target >= 0 && ai.Range > 0 && g.HandleRangedTurn(i, target) {
 		return
 	}
-	if !g.InFOV(p) {
-		// The monster is not in player's FOV.
+	if target >= 0 && paths.DistanceManhattan(p, g.ECS.Positions[target]) == 1 {
+		// If the monster is adjacent to its target, attack.
+		g.BumpAttack(i, target)
+		return
+	}
+	if ai.Necromancer && g.RaiseCorpse(i) {
+		return
+	}
+	if ai.Breeds && g.Breed(i) {
+		return
+	}
+	if target < 0 {
+		// The monster has no target in sight.
 		if len(ai.Path) < 1 {
 			// Pick new path to a random floor tile.
-			ai.Path = g.PR.AstarPath(aip, p, g.Map.RandomFloor())
+			g.AIPath(i, g.Map.randomFloor(g.Rand(RNGAI)))
 		}
 		g.AIMove(i)
 		// NOTE: this base AI can be improved for example to avoid
@@ -42,23 +65,187 @@ func (g *game) HandleMonsterTurn(i int) {
 		// started, though.
 		return
 	}
-	// The monster is in player's FOV, so we compute a suitable path to
-	// reach the player.
-	ai.Path = g.PR.AstarPath(aip, p, pp)
+	g.ChaseTarget(i, target)
+}
+
+// blockedRecompute is the number of turns a monster blocked by another one
+// holds position before computing a new path to its target.
+const blockedRecompute = 3
+
+// ChaseTarget moves monster i along a path toward its target. When the next
+// step is occupied by another monster, as often happens in corridors, the
+// monster holds position for a few turns instead of recomputing a path each
+// turn and jittering between alternative routes.
+func (g *game) ChaseTarget(i, target int) {
+	ai := g.ECS.AI[i]
+	tp := g.ECS.Positions[target]
+	if g.followsPath(i, tp) {
+		if ai.Blocked > 0 {
+			// The target did not move and the way is still
+			// blocked: wait for the monster in front to move.
+			ai.Blocked++
+			ai.State = AIResting
+			return
+		}
+		// The current path still leads to the target: follow it, and
+		// leave recomputation to a later turn.
+		g.AIMove(i)
+		return
+	}
+	// The monster sees its target, so we compute a suitable path to
+	// reach it.
+	if !g.AIPath(i, tp) && len(ai.Path) == 0 {
+		// Out of budget and no previous path: wait.
+		ai.State = AIResting
+		return
+	}
+	if g.blockedStep(i) {
+		// Even the best path goes through an occupied cell: hold
+		// position and start a new waiting period.
+		ai.Blocked = 1
+		ai.State = AIResting
+		return
+	}
+	ai.Blocked = 0
 	g.AIMove(i)
 }
 
+// followsPath reports whether monster i keeps its current path toward tp this
+// turn instead of computing a new one.
+func (g *game) followsPath(i int, tp gruid.Point) bool {
+	ai := g.ECS.AI[i]
+	if len(ai.Path) == 0 || ai.Path[len(ai.Path)-1] != tp {
+		return false
+	}
+	if ai.Blocked > 0 {
+		return ai.Blocked < blockedRecompute && g.blockedStep(i)
+	}
+	return len(ai.Path) > 1 && !g.StaggerTurn(i) && !g.blockedStep(i)
+}
+
+// blockedStep reports whether the next step in the path of monster i is
+// occupied by a blocking entity.
+func (g *game) blockedStep(i int) bool {
+	ai := g.ECS.AI[i]
+	path := ai.Path
+	if len(path) > 0 && path[0] == g.ECS.Positions[i] {
+		path = path[1:]
+	}
+	return len(path) > 0 && !g.ECS.NoBlockingEntityAt(path[0])
+}
+
+// raiseRange is the maximum distance at which necromancers can raise corpses.
+const raiseRange = 6
+
+// RaiseCorpse makes necromancer i raise a corpse in its line of sight as a
+// zombie with degraded stats. The corpse entity is consumed and replaced by a
+// new monster. It returns true if a corpse was raised.
+func (g *game) RaiseCorpse(i int) bool {
+	p := g.ECS.Positions[i]
+	fov := rl.NewFOV(gruid.NewRange(-raiseRange, -raiseRange, raiseRange+1, raiseRange+1).Add(p))
+	fov.SSCVisionMap(p, raiseRange, g.Map.Transparent, false)
+	corpse := -1
+	for _, j := range g.ECS.Positions.sortedKeys() {
+		q := g.ECS.Positions[j]
+		if !fov.Visible(q) || paths.DistanceManhattan(p, q) > raiseRange {
+			continue
+		}
+		if c, ok := g.ECS.Entities[j].(*Corpse); !ok || c.Undead || !g.ECS.NoBlockingEntityAt(q) {
+			continue
+		}
+		corpse = j
+		break
+	}
+	if corpse < 0 {
+		return false
+	}
+	q := g.ECS.Positions[corpse]
+	c := g.ECS.Entities[corpse].(*Corpse)
+	fi := c.Fighter
+	name := c.Of
+	g.ECS.RemoveEntity(corpse)
+	z := g.ECS.AddEntity(&Monster{}, q)
+	g.ECS.Blocks[z] = true
+	maxHP := fi.MaxHP / 2
+	if maxHP < 1 {
+		maxHP = 1
+	}
+	power := fi.Power - 1
+	if power < 1 {
+		power = 1
+	}
+	g.ECS.Fighter[z] = &fighter{HP: maxHP, MaxHP: maxHP, Defense: fi.Defense, Power: power}
+	g.ECS.Name[z] = name + " zombie"
+	g.ECS.Style[z] = Style{Rune: c.Rune, Color: ColorZombie}
+	g.ECS.AI[z] = &AI{Undead: true}
+	g.ECS.Faction[z] = FactionUndead
+	// Zombies are slow.
+	g.ECS.Speeds[z] = normalSpeed / 2
+	// Zombies burst when destroyed.
+	g.ECS.OnDeath[z] = DeathEffects{{Kind: DeathExplode}}
+	if g.InFOV(p) || g.InFOV(q) {
+		g.Logf("The necromancer raises the %s corpse!", ColorLogMonsterAttack, name)
+	}
+	return true
+}
+
+// Breeding parameters: breeders split with a given percentage chance each
+// turn, as long as there are less than maxBreeders of them on the level.
+const (
+	breedChance = 8
+	maxBreeders = 12
+)
+
+// Breed makes the breeder monster i split into a copy of itself on an
+// adjacent free tile. The copy has the same current HP. It returns true if
+// the monster bred.
+func (g *game) Breed(i int) bool {
+	if g.Rand(RNGAI).Intn(100) >= breedChance {
+		return false
+	}
+	n := 0
+	for j, ai := range g.ECS.AI {
+		if ai.Breeds && g.ECS.Alive(j) {
+			n++
+		}
+	}
+	if n >= maxBreeders {
+		return false
+	}
+	p := g.ECS.Positions[i]
+	free := []gruid.Point{}
+	for _, q := range []gruid.Point{p.Shift(-1, 0), p.Shift(1, 0), p.Shift(0, -1), p.Shift(0, 1)} {
+		if g.Map.Walkable(q) && g.ECS.NoBlockingEntityAt(q) {
+			free = append(free, q)
+		}
+	}
+	if len(free) == 0 {
+		return false
+	}
+	q := free[g.Rand(RNGAI).Intn(len(free))]
+	j := g.AddMonster(MonsterSlime, q)
+	g.ECS.Name[j] = g.ECS.Name[i]
+	g.ECS.Style[j] = g.ECS.Style[i]
+	*g.ECS.Fighter[j] = *g.ECS.Fighter[i]
+	if g.InFOV(p) || g.InFOV(q) {
+		g.Logf("The %s splits in two!", ColorLogMonsterAttack, g.ECS.HighlightName(i, g.ECS.Name[i]))
+	}
+	return true
+}
+
 // HandleConfusedMonster handles the behavior of a confused monster. It simply
 // tries to bump into a random direction.
 func (g *game) HandleConfusedMonster(i int) {
 	p := g.ECS.Positions[i]
-	p.X += -1 + 2*rand.Intn(2)
-	p.Y += -1 + 2*rand.Intn(2)
+	p.X += -1 + 2*g.Rand(RNGAI).Intn(2)
+	p.Y += -1 + 2*g.Rand(RNGAI).Intn(2)
 	if !p.In(g.Map.Grid.Range()) {
 		return
 	}
-	if p == g.ECS.PP() {
-		g.BumpAttack(i, g.ECS.PlayerID)
+	if j := g.ECS.BlockingEntityAt(p); j >= 0 && g.ECS.Fighter[j] != nil {
+		// Confused monsters attack whoever they bump into, even
+		// allies.
+		g.BumpAttack(i, j)
 		return
 	}
 	if g.Map.Walkable(p) && g.ECS.NoBlockingEntityAt(p) {
@@ -70,9 +257,19 @@ func (g *game) HandleConfusedMonster(i int) {
 // at the destination. It assumes the destination is walkable.
 func (g *game) AIMove(i int) {
 	ai := g.ECS.AI[i]
+	if g.ECS.Status(i, StatusWebbed) {
+		// Monsters stuck in a web cannot move.
+		return
+	}
 	if len(ai.Path) > 0 && ai.Path[0] == g.ECS.Positions[i] {
 		ai.Path = ai.Path[1:]
 	}
+	if len(ai.Path) > 0 && g.Frightens(i, ai.Path[0]) && !g.Frightens(i, g.ECS.Positions[i]) &&
+		g.Rand(RNGAI).Intn(2) == 0 {
+		// The monster hesitates before stepping into a frightening
+		// cell, losing its turn.
+		return
+	}
 	if len(ai.Path) > 0 && g.ECS.NoBlockingEntityAt(ai.Path[0]) {
 		// Only move if there is no blocking entity.
 		g.ECS.MoveEntity(i, ai.Path[0])
@@ -80,9 +277,34 @@ func (g *game) AIMove(i int) {
 	}
 }
 
+// Frightens returns true if the monster i is reluctant to step onto the cell
+// at p. Currently, animals fear cells lit by fire.
+func (g *game) Frightens(i int, p gruid.Point) bool {
+	ai := g.ECS.AI[i]
+	return ai != nil && ai.Animal && g.Map.Lit[p]
+}
+
+// Hazardous returns true if the cell at p would harm the monster i: fire
+// traps and burning grass, unless the monster is fireproof, and poison traps,
+// unless it is undead. Monsters know where traps are.
+func (g *game) Hazardous(i int, p gruid.Point) bool {
+	ai := g.ECS.AI[i]
+	if ai == nil {
+		return false
+	}
+	switch g.Map.Grid.At(p) {
+	case FireTrap, BurningGrass:
+		return !ai.Fireproof
+	case PoisonTrap:
+		return !ai.Undead
+	}
+	return false
+}
+
 // aiPath implements the paths.Astar interface for use in AI pathfinding.
 type aiPath struct {
 	g  *game
+	i  int // moving monster
 	nb paths.Neighbors
 }
 
@@ -103,6 +325,10 @@ func (aip *aiPath) Cost(p, q gruid.Point) int {
 		// player.
 		return 8
 	}
+	if aip.g.Frightens(aip.i, q) || aip.g.Hazardous(aip.i, q) {
+		// Frightening and hazardous cells are avoided when possible.
+		return 10
+	}
 	return 1
 }
 
@@ -0,0 +1,67 @@
+// This file describes the states of the monster AI, which can be shown next
+// to monsters in wizard mode, so that AI behavior changes can be checked at a
+// glance during play.
+
+package main
+
+import "github.com/anaseto/gruid"
+
+// aiState describes what a monster did on its last turn.
+type aiState int
+
+const (
+	AIResting   aiState = iota // holding position, or has not acted yet
+	AIWandering                // no target in sight
+	AIHunting                  // chasing or attacking a target
+	AIFleeing                  // backing off from a target
+)
+
+func (st aiState) String() (s string) {
+	switch st {
+	case AIResting:
+		s = "resting"
+	case AIWandering:
+		s = "wandering"
+	case AIHunting:
+		s = "hunting"
+	case AIFleeing:
+		s = "fleeing"
+	}
+	return s
+}
+
+// Rune returns the indicator rune of the state.
+func (st aiState) Rune() (r rune) {
+	switch st {
+	case AIResting:
+		r = 'Z'
+	case AIWandering:
+		r = '?'
+	case AIHunting:
+		r = '!'
+	case AIFleeing:
+		r = '~'
+	}
+	return r
+}
+
+// DrawAIStates draws the AI state indicator of visible hostile monsters on
+// their right, when the wizard mode diagnostics overlay is shown. It draws in
+// the effects layer.
+func (m *model) DrawAIStates(gd gruid.Grid) {
+	g := m.game
+	if !g.Options.Wizard || !m.diag.Show {
+		return
+	}
+	for _, i := range g.ECS.AI.sortedKeys() {
+		p := g.ECS.Positions[i]
+		if !g.ECS.Alive(i) || g.ECS.Ally(i) || !g.InFOV(p) || g.Unseen(i) {
+			continue
+		}
+		q := p.Shift(1, 0)
+		if !q.In(gd.Range()) {
+			continue
+		}
+		gd.Set(q, gruid.Cell{Rune: g.ECS.AI[i].State.Rune(), Style: gruid.Style{Fg: ColorLogSpecial}})
+	}
+}
@@ -0,0 +1,76 @@
+// This file implements idle ambient map effects: braziers flicker and water
+// shimmers, driven by a low-frequency tick. They are purely visual, and do
+// not use the game's random number generator, so that they never affect the
+// game state.
+
+package main
+
+import (
+	"time"
+
+	"github.com/anaseto/gruid"
+)
+
+// ambientEffects enables ambient map effects. It can be disabled with the
+// -ambient=false command-line flag.
+var ambientEffects = true
+
+// ambientTickDelay is the duration between two frames of ambient effects.
+const ambientTickDelay = 400 * time.Millisecond
+
+// msgAmbientTick is sent to advance ambient effects to their next frame.
+type msgAmbientTick struct{}
+
+// ambientTickCmd returns a command that sends a message for the next frame
+// of ambient effects after a delay, if they are enabled.
+func ambientTickCmd() gruid.Effect {
+	if !ambientEffects {
+		return nil
+	}
+	return gruid.Cmd(func() gruid.Msg {
+		time.Sleep(ambientTickDelay)
+		return msgAmbientTick{}
+	})
+}
+
+// nextAmbientFrame advances ambient effects to their next frame.
+func (m *model) nextAmbientFrame() gruid.Effect {
+	m.ambient++
+	return ambientTickCmd()
+}
+
+// ambientNoise returns a pseudo-random number for position p at the given
+// frame.
+func ambientNoise(p gruid.Point, frame int) uint32 {
+	h := uint32(p.X)*73856093 ^ uint32(p.Y)*19349663 ^ uint32(frame)*83492791
+	h ^= h >> 13
+	h *= 0x5bd1e995
+	return h ^ h>>15
+}
+
+// DrawAmbient draws ambient effects of visible terrain in the effects layer.
+func (m *model) DrawAmbient(gd gruid.Grid) {
+	if !ambientEffects {
+		return
+	}
+	g := m.game
+	it := g.Map.Grid.Iterator()
+	for it.Next() {
+		p := it.P()
+		if !g.InFOV(p) {
+			continue
+		}
+		switch c := it.Cell(); c {
+		case Brazier:
+			// Torch flicker: the flames change color at random.
+			if ambientNoise(p, m.ambient)%3 == 0 {
+				gd.Set(p, gruid.Cell{Rune: g.Map.Rune(c), Style: gruid.Style{Fg: ColorConsumable}})
+			}
+		case Pool, DeepWater:
+			// Water shimmer: glints follow slow diagonal waves.
+			if (p.X+p.Y+m.ambient)%9 == 0 && ambientNoise(p, m.ambient)%2 == 0 {
+				gd.Set(p, gruid.Cell{Rune: g.Map.Rune(c), Style: gruid.Style{Fg: ColorBones}})
+			}
+		}
+	}
+}
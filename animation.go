@@ -0,0 +1,71 @@
+// This file implements simple animations, like the flight of an arrow. They
+// are purely visual: the game state has already been updated when they are
+// shown.
+
+package main
+
+import (
+	"time"
+
+	"github.com/anaseto/gruid"
+)
+
+// animFrameDelay is the duration of a frame in animations. It is set with the
+// -anim-frame command-line flag. A zero duration means instant mode: no
+// animations are shown.
+var animFrameDelay = 30 * time.Millisecond
+
+// animation represents a projectile moving along a path, one position per
+// frame.
+type animation struct {
+	Path  []gruid.Point // positions of the projectile
+	Rune  rune          // rune representing the projectile
+	Frame int           // current frame
+}
+
+// msgAnimFrame is sent to advance the current animation to its next frame.
+type msgAnimFrame struct{}
+
+// animFrameCmd returns a command that sends a message for the next frame
+// after a delay.
+func animFrameCmd() gruid.Cmd {
+	return func() gruid.Msg {
+		time.Sleep(animFrameDelay)
+		return msgAnimFrame{}
+	}
+}
+
+// StartAnimation starts an animation of a projectile following path. No
+// animation is shown when replaying an event log, nor in instant mode.
+func (m *model) StartAnimation(path []gruid.Point, r rune) gruid.Effect {
+	if m.replaying || animFrameDelay <= 0 || len(path) == 0 {
+		return nil
+	}
+	m.anim = &animation{Path: path, Rune: r}
+	return animFrameCmd()
+}
+
+// nextAnimFrame advances the current animation, if any.
+func (m *model) nextAnimFrame() gruid.Effect {
+	if m.anim == nil {
+		return nil
+	}
+	m.anim.Frame++
+	if m.anim.Frame >= len(m.anim.Path) {
+		m.anim = nil
+		return nil
+	}
+	return animFrameCmd()
+}
+
+// DrawAnimation draws the current frame of the running animation, if any.
+func (m *model) DrawAnimation(gd gruid.Grid) {
+	if m.anim == nil {
+		return
+	}
+	p := m.anim.Path[m.anim.Frame]
+	if !m.game.InFOV(p) {
+		return
+	}
+	gd.Set(p, gruid.Cell{Rune: m.anim.Rune, Style: gruid.Style{Fg: ColorLogPlayerAttack}})
+}
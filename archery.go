@@ -0,0 +1,207 @@
+// This file implements archery for the player: bows shoot arrows at a target
+// chosen in targeting mode, providing a ranged option other than scrolls.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// bowRange is the maximal distance at which bows can shoot.
+const bowRange = 7
+
+// Arrows is a bundle of arrows used as ammunition for bows. Bundles stack in
+// the inventory.
+type Arrows struct {
+	Count int `json:"count"`
+}
+
+// arrowsName returns the name of a bundle of n arrows.
+func arrowsName(n int) string {
+	if n == 1 {
+		return "arrow"
+	}
+	return fmt.Sprintf("%d arrows", n)
+}
+
+// AddArrows adds a bundle of n arrows at p and returns its id.
+func (g *game) AddArrows(n int, p gruid.Point) int {
+	return g.ECS.AddItem(&Arrows{Count: n}, p, arrowsName(n), '(')
+}
+
+// Quiver returns the arrows bundle of the actor's inventory, or -1 if the
+// actor has no arrows.
+func (g *game) Quiver(actor int) int {
+	for _, i := range g.ECS.Inventory[actor].Items {
+		if _, ok := g.ECS.Entities[i].(*Arrows); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// StackArrows adds the arrows of bundle i to the arrows already in the
+// actor's inventory, if any, and removes bundle i. It returns false if the
+// item is not a bundle of arrows or there was no bundle to stack on.
+func (g *game) StackArrows(actor, i int) bool {
+	ar, ok := g.ECS.Entities[i].(*Arrows)
+	if !ok {
+		return false
+	}
+	q := g.Quiver(actor)
+	if q < 0 {
+		return false
+	}
+	quiver := g.ECS.Entities[q].(*Arrows)
+	quiver.Count += ar.Count
+	g.ECS.Name[q] = arrowsName(quiver.Count)
+	g.ECS.RemoveEntity(i)
+	return true
+}
+
+// StackCount returns the number of arrows of the n-th item of the actor's
+// inventory, or 0 if it is not a bundle of arrows.
+func (g *game) StackCount(actor, n int) int {
+	inv := g.ECS.Inventory[actor]
+	if len(inv.Items) <= n {
+		return 0
+	}
+	if ar, ok := g.ECS.Entities[inv.Items[n]].(*Arrows); ok {
+		return ar.Count
+	}
+	return 0
+}
+
+// DropArrows makes the actor drop count arrows of the bundle at the n-th
+// inventory slot.
+func (g *game) DropArrows(actor, n, count int) error {
+	if count <= 0 {
+		return errors.New("You drop nothing.")
+	}
+	i := g.ECS.Inventory[actor].Items[n]
+	ar := g.ECS.Entities[i].(*Arrows)
+	if count >= ar.Count {
+		return g.InventoryRemove(actor, n)
+	}
+	ar.Count -= count
+	g.ECS.Name[i] = arrowsName(ar.Count)
+	g.AddArrows(count, g.ECS.Positions[actor])
+	return nil
+}
+
+// EquippedBow returns the bow equipped by the actor, if any.
+func (g *game) EquippedBow(actor int) *Bow {
+	i, ok := g.ECS.Equipment[actor][SlotRanged]
+	if !ok {
+		return nil
+	}
+	b, _ := g.ECS.Entities[i].(*Bow)
+	return b
+}
+
+// Ammo returns the number of arrows left in the actor's quiver.
+func (g *game) Ammo(actor int) int {
+	q := g.Quiver(actor)
+	if q < 0 {
+		return 0
+	}
+	return g.ECS.Entities[q].(*Arrows).Count
+}
+
+// CheckFire returns an error if the actor cannot currently shoot: a bow has
+// to be equipped, and some arrows available.
+func (g *game) CheckFire(actor int) error {
+	if g.EquippedBow(actor) == nil {
+		return errors.New("You have no bow equipped.")
+	}
+	if g.Quiver(actor) < 0 {
+		return errors.New("You have no arrows.")
+	}
+	return nil
+}
+
+// linePoints returns the points of the line from p to q, excluding p and
+// including q.
+func linePoints(p, q gruid.Point) []gruid.Point {
+	ps := []gruid.Point{}
+	lineFree(p, q, func(r gruid.Point) bool {
+		ps = append(ps, r)
+		return true
+	})
+	return append(ps, q)
+}
+
+// Fire makes the actor shoot an arrow at p, consuming it. It returns the path
+// followed by the arrow, for animation purposes.
+func (g *game) Fire(actor int, p gruid.Point) ([]gruid.Point, error) {
+	if err := g.CheckFire(actor); err != nil {
+		return nil, err
+	}
+	from := g.ECS.Positions[actor]
+	if p == from {
+		return nil, errors.New("You cannot shoot yourself.")
+	}
+	if !g.InFOV(p) {
+		return nil, errors.New("You cannot target what you cannot see.")
+	}
+	if i := g.ECS.MonsterAt(p); i >= 0 && g.ECS.Ally(i) && g.ECS.Alive(i) {
+		return nil, errors.New("You do not want to shoot your ally.")
+	}
+	bow := g.EquippedBow(actor)
+	if paths.DistanceManhattan(from, p) > bow.Range {
+		return nil, errors.New("Your target is out of range.")
+	}
+	if !g.ClearShot(from, p) {
+		return nil, errors.New("You have no clear line of fire.")
+	}
+	g.ConsumeArrow(actor)
+	path := linePoints(from, p)
+	i := g.ECS.MonsterAt(p)
+	if i < 0 || !g.ECS.Alive(i) {
+		g.Logf("Your arrow flies and falls to the ground.", ColorLogItemUse)
+		return path, nil
+	}
+	g.Shoot(actor, i, bow)
+	return path, nil
+}
+
+// ConsumeArrow removes one arrow from the actor's inventory.
+func (g *game) ConsumeArrow(actor int) {
+	q := g.Quiver(actor)
+	ar := g.ECS.Entities[q].(*Arrows)
+	ar.Count--
+	if ar.Count > 0 {
+		g.ECS.Name[q] = arrowsName(ar.Count)
+		return
+	}
+	inv := g.ECS.Inventory[actor]
+	for n, i := range inv.Items {
+		if i == q {
+			inv.Items = append(inv.Items[:n], inv.Items[n+1:]...)
+			break
+		}
+	}
+	g.ECS.RemoveEntity(q)
+	if actor == g.ECS.PlayerID {
+		g.Logf("You shot your last arrow.", ColorLogSpecial)
+	}
+}
+
+// Shoot makes actor i hit entity j with an arrow shot with the given bow.
+// Arrows ignore melee weapon bonuses.
+func (g *game) Shoot(i, j int, bow *Bow) {
+	damage := g.ECS.Fighter[i].Power + bow.Power - g.ECS.Defense(j)
+	attacker := g.ECS.HighlightName(i, strings.Title(g.ECS.Name[i]))
+	defender := g.ECS.HighlightName(j, g.ECS.Name[j])
+	if damage <= 0 {
+		g.Logf("%v shoots %v but does no damage", ColorLogPlayerAttack, attacker, defender)
+		return
+	}
+	g.Logf("%v shoots %v for %s damage", ColorLogPlayerAttack, attacker, defender, Highlight(MarkupDamage, damage))
+	g.Damage(j, damage)
+}
@@ -0,0 +1,154 @@
+// This file implements the arena: a wizard mode sandbox where the player is
+// dropped into a small flat room with chosen monsters and items, for quickly
+// testing combat, item effects and AI changes.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// arenaSpec describes the content of the arena. It is set with the -arena
+// command-line flag, and uses the following format: a comma-separated list
+// of monster names, then a semicolon and a comma-separated list of item
+// names. Each name can be followed by “*n” for n copies. For example:
+// “orc*3,troll;fireball scroll*2,health potion”.
+var arenaSpec string
+
+// defaultArenaSpec is the arena content used when no -arena flag was given.
+const defaultArenaSpec = "orc*2,troll;health potion*2"
+
+// Arena dimensions.
+const (
+	arenaWidth  = 30
+	arenaHeight = 13
+)
+
+// monsterKinds maps monster names to monster kinds.
+var monsterKinds = map[string]monsterKind{
+	"orc":           MonsterOrc,
+	"wolf":          MonsterWolf,
+	"troll":         MonsterTroll,
+	"necromancer":   MonsterNecromancer,
+	"orc chieftain": MonsterOrcChieftain,
+	"orc warlord":   MonsterOrcWarlord,
+	"bat":           MonsterBat,
+	"slime":         MonsterSlime,
+	"orc archer":    MonsterOrcArcher,
+	"giant spider":  MonsterSpider,
+	"ghost":         MonsterGhost,
+}
+
+// arenaContent describes the monsters and items to put in the arena.
+type arenaContent struct {
+	Monsters []monsterKind
+	Items    []string
+}
+
+// ParseArenaSpec parses an arena specification.
+func ParseArenaSpec(spec string) (arenaContent, error) {
+	ac := arenaContent{}
+	parts := strings.SplitN(spec, ";", 2)
+	names, err := parseArenaList(parts[0])
+	if err != nil {
+		return ac, err
+	}
+	for _, name := range names {
+		kind, ok := monsterKinds[name]
+		if !ok {
+			return ac, fmt.Errorf("unknown monster: %s", name)
+		}
+		ac.Monsters = append(ac.Monsters, kind)
+	}
+	if len(parts) < 2 {
+		return ac, nil
+	}
+	ac.Items, err = parseArenaList(parts[1])
+	if err != nil {
+		return ac, err
+	}
+	for _, name := range ac.Items {
+		if !isItemName(name) {
+			return ac, fmt.Errorf("unknown item: %s", name)
+		}
+	}
+	return ac, nil
+}
+
+// parseArenaList parses a comma-separated list of names with optional “*n”
+// counts, and returns the list with repeated names expanded.
+func parseArenaList(s string) ([]string, error) {
+	names := []string{}
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		n := 1
+		if k := strings.LastIndex(field, "*"); k >= 0 {
+			var err error
+			n, err = strconv.Atoi(strings.TrimSpace(field[k+1:]))
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid count in “%s”", field)
+			}
+			field = strings.TrimSpace(field[:k])
+		}
+		for i := 0; i < n; i++ {
+			names = append(names, field)
+		}
+	}
+	return names, nil
+}
+
+// EnterArena replaces the current level by a new arena with the content
+// described by spec. The player is fully healed and keeps its inventory.
+func (g *game) EnterArena(spec string) error {
+	if spec == "" {
+		spec = defaultArenaSpec
+	}
+	ac, err := ParseArenaSpec(spec)
+	if err != nil {
+		return err
+	}
+	size := gruid.Point{UIWidth, UIHeight - 3}
+	g.Map = newMap(size, g.Depth, g.levelSeed())
+	g.Map.Special = "arena"
+	rg := gruid.NewRange(0, 0, arenaWidth, arenaHeight).Add(size.Sub(gruid.Point{arenaWidth, arenaHeight}).Div(2))
+	rg.Shift(1, 1, -1, -1).Iter(func(p gruid.Point) {
+		g.Map.Grid.Set(p, Floor)
+	})
+	rg.Iter(func(p gruid.Point) { g.Map.Explored[p] = true })
+	g.PR = paths.NewPathRange(gruid.NewRange(0, 0, size.X, size.Y))
+	g.LevelTurns = 0
+	g.Objective = nil
+	for i := range g.ECS.Positions {
+		if i != g.ECS.PlayerID {
+			g.ECS.RemoveEntity(i)
+		}
+	}
+	fi := g.ECS.Fighter[g.ECS.PlayerID]
+	fi.HP = fi.MaxHP
+	delete(g.ECS.Statuses, g.ECS.PlayerID)
+	pp := gruid.Point{rg.Min.X + 3, (rg.Min.Y + rg.Max.Y) / 2}
+	g.ECS.MovePlayer(pp)
+	for _, name := range ac.Items {
+		g.AddNamedItem(name, pp)
+	}
+	// Monsters are lined up in columns on the other side.
+	for k, kind := range ac.Monsters {
+		h := arenaHeight - 2
+		p := gruid.Point{rg.Max.X - 3 - k/h, rg.Min.Y + 1 + k%h}
+		if !g.Map.Walkable(p) {
+			break
+		}
+		g.AddMonster(kind, p)
+	}
+	g.UpdateFOV()
+	g.Logf("You enter the arena (%s).", ColorLogSpecial, spec)
+	return nil
+}
@@ -0,0 +1,122 @@
+// This file implements auto-pickup: gold is always picked up when walking on
+// it, and items of categories enabled in the auto-pickup settings are picked
+// up too. The settings are saved with the game, so that replaying an event
+// log picks up the same items.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// pickupCategory describes categories of items that can be picked up
+// automatically.
+type pickupCategory int
+
+const (
+	PickupPotions pickupCategory = iota
+	PickupScrolls
+	PickupArrows
+	numPickupCategories
+)
+
+func (pc pickupCategory) String() (s string) {
+	switch pc {
+	case PickupPotions:
+		s = "potions"
+	case PickupScrolls:
+		s = "scrolls"
+	case PickupArrows:
+		s = "arrows"
+	}
+	return s
+}
+
+// pickupCategoryOf returns the auto-pickup category of an entity, if any.
+func pickupCategoryOf(e Entity) (pickupCategory, bool) {
+	switch e.(type) {
+	case *HealingPotion, *StrengthPotion, *PoisonPotion, *RegenerationPotion:
+		return PickupPotions, true
+	case *LightningScroll, *ConfusionScroll, *FireballScroll, *TeleportScroll, *EnchantScroll:
+		return PickupScrolls, true
+	case *Arrows:
+		return PickupArrows, true
+	}
+	return 0, false
+}
+
+// AutoPickup picks up the gold at the player's position, as well as the
+// items of the categories enabled in the auto-pickup settings. It does not
+// take a turn.
+func (g *game) AutoPickup() {
+	g.PickupGold()
+	pid := g.ECS.PlayerID
+	for _, i := range g.ECS.EntitiesAt(g.ECS.PP()) {
+		pc, ok := pickupCategoryOf(g.ECS.Entities[i])
+		if !ok || !g.AutoPickupOn[pc] {
+			continue
+		}
+		name := g.ECS.HighlightName(i, g.ECS.GetName(i))
+		if !g.StackArrows(pid, i) {
+			if err := g.InventoryAdd(pid, i); err != nil {
+				g.Logf("You cannot pickup %v: %v", ColorLogSpecial, name, err)
+				continue
+			}
+		}
+		g.Logf("You pickup %v (auto-pickup).", ColorLogItemUse, name)
+	}
+}
+
+// ToggleAutoPickup enables or disables auto-pickup of a category of items.
+func (g *game) ToggleAutoPickup(pc pickupCategory) {
+	if g.AutoPickupOn == nil {
+		g.AutoPickupOn = map[pickupCategory]bool{}
+	}
+	g.AutoPickupOn[pc] = !g.AutoPickupOn[pc]
+}
+
+// OpenAutoPickupSettings opens the auto-pickup settings menu. Invoking an
+// entry toggles the corresponding category.
+func (m *model) OpenAutoPickupSettings() {
+	lp := listPicker{
+		Title:   "Auto-pickup (gold always)",
+		Letters: true,
+		Height:  int(numPickupCategories) + 2,
+	}
+	for pc := pickupCategory(0); pc < numPickupCategories; pc++ {
+		state := "off"
+		if m.game.AutoPickupOn[pc] {
+			state = "on"
+		}
+		lp.Entries = append(lp.Entries, pickerEntry{Text: fmt.Sprintf("%-8s %s", pc, state)})
+	}
+	active := 0
+	if m.inventory != nil && m.mode == modeAutoPickup {
+		active = m.inventory.Active()
+	}
+	m.inventory = lp.Menu()
+	m.inventory.SetActive(active)
+	m.mode = modeAutoPickup
+}
+
+// updateAutoPickupSettings handles input messages when the auto-pickup
+// settings menu is open.
+func (m *model) updateAutoPickupSettings(msg gruid.Msg) {
+	m.inventory.Update(msg)
+	switch m.inventory.Action() {
+	case ui.MenuQuit:
+		m.mode = modeNormal
+	case ui.MenuInvoke:
+		pc := pickupCategory(m.inventory.Active())
+		m.game.ToggleAutoPickup(pc)
+		state := "off"
+		if m.game.AutoPickupOn[pc] {
+			state = "on"
+		}
+		m.game.Logf("Auto-pickup of %s: %s.", ColorLogSpecial, pc, state)
+		m.OpenAutoPickupSettings()
+	}
+}
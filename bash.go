@@ -0,0 +1,53 @@
+// This file implements shield bashing: an active defense action, usable with
+// a shield equipped, that stuns an adjacent enemy for a turn instead of
+// attacking it.
+
+package main
+
+import (
+	"errors"
+
+	"github.com/anaseto/gruid"
+)
+
+// BashTarget returns an enemy adjacent to the actor to be bashed, or -1 if
+// there is none. The last targeted monster is preferred.
+func (g *game) BashTarget(actor int) int {
+	p := g.ECS.Positions[actor]
+	target := -1
+	for _, q := range [4]gruid.Point{p.Shift(1, 0), p.Shift(-1, 0), p.Shift(0, 1), p.Shift(0, -1)} {
+		i := g.ECS.MonsterAt(q)
+		if i < 0 || !g.ECS.Alive(i) || !g.ECS.Hostile(actor, i) {
+			continue
+		}
+		if g.LastTarget.Set && g.LastTarget.Monster == i {
+			return i
+		}
+		if target < 0 {
+			target = i
+		}
+	}
+	return target
+}
+
+// ShieldBash makes the actor bash an adjacent enemy with its shield, instead
+// of attacking: the enemy is stunned and loses its next turn. It returns an
+// error if the actor has no shield, or no enemy to bash.
+func (g *game) ShieldBash(actor int) error {
+	sh, ok := g.ECS.Equipment[actor][SlotShield]
+	if !ok {
+		return errors.New("You need a shield to bash.")
+	}
+	target := g.BashTarget(actor)
+	if target < 0 {
+		return errors.New("There is no enemy next to you to bash.")
+	}
+	// A status put for zero turns lasts until the end of the next turn.
+	g.ECS.PutStatus(target, StatusParalyzed, 0)
+	if ai := g.ECS.AI[target]; ai != nil {
+		ai.Path = nil
+	}
+	g.Logf("You bash %v with your %s: it is stunned!", ColorLogPlayerAttack,
+		g.ECS.HighlightName(target, g.ECS.GetName(target)), g.ECS.GetName(sh))
+	return nil
+}
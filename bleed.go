@@ -0,0 +1,57 @@
+// This file implements bleeding wounds: critical hits, and the bites of some
+// monsters, make their target bleed, losing one HP each turn until the
+// bleeding stops by itself or the wound is healed by a potion.
+
+package main
+
+const (
+	bleedTurns = 5  // duration of the bleeding status
+	critChance = 10 // hits are critical with a 1 in critChance chance
+)
+
+func init() {
+	registerTurnHook(turnHook{Name: "bleeding", Order: turnEffects + 3, Run: (*game).BleedNextTurn})
+}
+
+// CriticalHit returns true if a hit is critical.
+func (g *game) CriticalHit() bool {
+	return g.Rand(RNGCombat).Intn(critChance) == 0
+}
+
+// Wound makes fighter i bleed, unless it is already bleeding, and reports it
+// if visible.
+func (g *game) Wound(i int) {
+	if !g.ECS.Alive(i) || g.ECS.Status(i, StatusBleeding) {
+		return
+	}
+	g.ECS.PutStatus(i, StatusBleeding, bleedTurns)
+	switch {
+	case i == g.ECS.PlayerID:
+		g.Logf("You are bleeding!", ColorLogMonsterAttack)
+	case g.InFOV(g.ECS.Positions[i]) && !g.Unseen(i):
+		g.Logf("%v is bleeding.", ColorLogAbility, g.ECS.HighlightName(i, g.ECS.GetName(i)))
+	}
+}
+
+// StopBleeding heals the wound of fighter i. It returns true if the fighter
+// was bleeding.
+func (g *game) StopBleeding(i int) bool {
+	if !g.ECS.Status(i, StatusBleeding) {
+		return false
+	}
+	delete(g.ECS.Statuses[i], StatusBleeding)
+	return true
+}
+
+// BleedNextTurn inflicts bleeding damage to bleeding fighters.
+func (g *game) BleedNextTurn() {
+	for _, i := range g.ECS.Fighter.sortedKeys() {
+		if !g.ECS.Alive(i) || !g.ECS.Status(i, StatusBleeding) {
+			continue
+		}
+		g.Damage(i, 1)
+		if i == g.ECS.PlayerID {
+			g.Logf("You bleed.", ColorLogMonsterAttack)
+		}
+	}
+}
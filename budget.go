@@ -0,0 +1,68 @@
+// This file implements a per-turn budget for AI pathfinding, so that turn
+// latency stays bounded on big levels with many monsters.
+
+package main
+
+import (
+	"time"
+
+	"github.com/anaseto/gruid"
+)
+
+// AI computation budget: at most aiPathBudget paths are computed during a
+// single EndTurn, and no new paths are computed once aiTimeBudget has elapsed.
+// Monsters that run out of budget keep following their previous path.
+const (
+	aiPathBudget = 64
+	aiTimeBudget = 20 * time.Millisecond
+)
+
+// aiStagger is the number of turns over which recomputation of still valid
+// chase paths is spread: each monster refreshes its path once every aiStagger
+// turns, on a turn depending on its entity index.
+const aiStagger = 4
+
+// aiBudget tracks AI pathfinding computations during the current turn.
+type aiBudget struct {
+	paths    int       // remaining path computations
+	deadline time.Time // no new paths are computed after the deadline
+	skipped  int       // path computations skipped this turn (diagnostics)
+}
+
+func init() {
+	registerTurnHook(turnHook{Name: "ai budget", Order: turnStart, Run: (*game).ResetAIBudget})
+}
+
+// ResetAIBudget starts a new AI budget for the current turn. The time
+// deadline is not used in games saved as event logs, because it would make
+// replays depend on the machine's speed.
+func (g *game) ResetAIBudget() {
+	g.budget = aiBudget{paths: aiPathBudget}
+	if !g.Options.EventLog {
+		g.budget.deadline = time.Now().Add(aiTimeBudget)
+	}
+}
+
+// AIPath computes a new path for monster i toward position to, if the
+// turn budget allows it. It returns false if the computation was skipped, in
+// which case the monster keeps its previous path.
+func (g *game) AIPath(i int, to gruid.Point) bool {
+	if path, ok := g.plannedPath(i, to); ok {
+		g.ECS.AI[i].Path = path
+		return true
+	}
+	if g.budget.paths <= 0 || !g.budget.deadline.IsZero() && time.Now().After(g.budget.deadline) {
+		g.budget.skipped++
+		return false
+	}
+	g.budget.paths--
+	aip := &aiPath{g: g, i: i}
+	g.ECS.AI[i].Path = g.PR.AstarPath(aip, g.ECS.Positions[i], to)
+	return true
+}
+
+// StaggerTurn reports whether monster i refreshes its still valid paths this
+// turn.
+func (g *game) StaggerTurn(i int) bool {
+	return (i+g.LevelTurns)%aiStagger == 0
+}
@@ -0,0 +1,68 @@
+// This file describes the build of the game: its version and the commit it
+// was built from. They are shown on the title screen, and recorded in saves,
+// post-mortem event logs and turn exports, so that bug reports and save
+// compatibility decisions know which build produced them.
+
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// version and commit describe the build of the game. They can be set at
+// build time, for example:
+//
+//	go build -ldflags "-X main.version=0.2.0 -X main.commit=$(git rev-parse --short HEAD)"
+//
+// When not set, the commit is taken from the version control information
+// embedded by the go tool, if any.
+var (
+	version = "0.1.0"
+	commit  = ""
+)
+
+// buildInfo describes the build of the game.
+type buildInfo struct {
+	Version  string `json:"version"`
+	Commit   string `json:"commit,omitempty"` // commit hash, if known
+	Modified bool   `json:"modified"`         // built with uncommitted changes
+}
+
+// build is the build information of the running game.
+var build = readBuildInfo()
+
+// readBuildInfo returns the build information of the running game.
+func readBuildInfo() buildInfo {
+	bi := buildInfo{Version: version, Commit: commit}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return bi
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if bi.Commit == "" {
+				bi.Commit = s.Value
+			}
+		case "vcs.modified":
+			bi.Modified = s.Value == "true"
+		}
+	}
+	if len(bi.Commit) > 12 {
+		bi.Commit = bi.Commit[:12]
+	}
+	return bi
+}
+
+func (bi buildInfo) String() string {
+	switch {
+	case bi.Version == "":
+		return "unknown"
+	case bi.Commit == "":
+		return bi.Version
+	case bi.Modified:
+		return fmt.Sprintf("%s (%s, modified)", bi.Version, bi.Commit)
+	}
+	return fmt.Sprintf("%s (%s)", bi.Version, bi.Commit)
+}
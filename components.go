@@ -7,10 +7,10 @@ import "github.com/anaseto/gruid"
 // fighter holds data relevant to fighting. We'll use simple attack/defense
 // stats.
 type fighter struct {
-	HP      int // Health Points
-	MaxHP   int // Maximum Health Points
-	Power   int // attack power
-	Defense int // defence
+	HP      int `json:"hp"`      // Health Points
+	MaxHP   int `json:"max_hp"`  // Maximum Health Points
+	Power   int `json:"power"`   // attack power
+	Defense int `json:"defense"` // defence
 }
 
 // Heal heals a fighter for a certain amount, if it does not exceed maximum HP.
@@ -26,26 +26,99 @@ func (fi *fighter) Heal(n int) int {
 
 // AI holds simple AI data for monster's.
 type AI struct {
-	Path []gruid.Point // path to destination
+	Path        []gruid.Point `json:"path"`        // path to destination
+	Animal      bool          `json:"animal"`      // animals fear fire and light
+	Necromancer bool          `json:"necromancer"` // necromancers raise corpses as zombies
+	Undead      bool          `json:"undead"`      // undead cannot be raised again
+	Breeds      bool          `json:"breeds"`      // breeders spawn copies of themselves
+	Range       int           `json:"range"`       // range of ranged attacks (0 for melee only)
+	Order       allyOrder     `json:"order"`       // current order (allies only)
+	Blocked     int           `json:"blocked"`     // turns spent waiting behind a blocking entity
+	State       aiState       `json:"state"`       // behavior on the last turn
+	Invisible   bool          `json:"invisible"`   // only seen with see invisible
+	Fireproof   bool          `json:"fireproof"`   // fireproof monsters do not burn
+}
+
+// Regen represents natural regeneration: the entity regains one HP every
+// given number of turns.
+type Regen struct {
+	Every int `json:"every"` // turns between two regenerated HP
+	Wait  int `json:"wait"`  // turns before the next regenerated HP
+	Shown int `json:"shown"` // turns during which recent regeneration is shown
+}
+
+// regenShownTurns is the number of turns during which the status line shows
+// that the player regenerated HP recently.
+const regenShownTurns = 3
+
+// NextTurn updates the regeneration of fighter fi for a new turn.
+func (r *Regen) NextTurn(fi *fighter) {
+	if r.Shown > 0 {
+		r.Shown--
+	}
+	r.Wait--
+	if r.Wait > 0 {
+		return
+	}
+	r.Wait = r.Every
+	if fi.Heal(1) > 0 {
+		r.Shown = regenShownTurns
+	}
 }
 
 // Style contains information relative to the default graphical representation
 // of an entity.
 type Style struct {
-	Rune  rune
-	Color gruid.Color
+	Rune  rune        `json:"rune"`
+	Color gruid.Color `json:"color"`
 }
 
 // Inventory holds items. For now, consumables.
 type Inventory struct {
-	Items []int
+	Items []int `json:"items"`
+}
+
+// blessing describes the blessed/uncursed/cursed state of an item.
+type blessing int
+
+const (
+	Uncursed blessing = iota
+	Blessed
+	Cursed
+)
+
+func (b blessing) String() (s string) {
+	switch b {
+	case Uncursed:
+		s = "uncursed"
+	case Blessed:
+		s = "blessed"
+	case Cursed:
+		s = "cursed"
+	}
+	return s
+}
+
+// BUC holds the blessing state of an item, and whether the player knows about
+// it (for example after dropping the item on an altar).
+type BUC struct {
+	Blessing blessing `json:"blessing"`
+	Known    bool     `json:"known"`
 }
 
 // status describes different kind of statuses.
 type status int
 
 const (
-	StatusConfused status = iota
+	StatusConfused     status = iota
+	StatusHasted              // acts twice as fast
+	StatusSlowed              // acts twice as slow
+	StatusPoisoned            // loses HP each turn
+	StatusWebbed              // stuck in a web, cannot move
+	StatusRegenerating        // regains HP each turn
+	StatusParalyzed           // skips its turns
+	StatusBurning             // loses HP each turn and spreads fire
+	StatusBleeding            // loses HP each turn until healed
 )
 
 // Statuses maps ongoing statuses to their remaining turns.
@@ -0,0 +1,51 @@
+// This file handles corpses, which are left by monsters on death and rot
+// away after a while, unless raised again by a necromancer.
+
+package main
+
+// Corpse represents the remains of a dead monster. It keeps the information
+// needed to raise the monster again as a zombie.
+type Corpse struct {
+	Of      string  `json:"of"`      // name of the dead monster
+	Fighter fighter `json:"fighter"` // fighting stats of the dead monster
+	Rune    rune    `json:"rune"`    // rune of the dead monster
+	Undead  bool    `json:"undead"`  // whether the monster was undead (cannot be raised again)
+	Age     int     `json:"age"`     // turns since death
+}
+
+// corpseRotTurns is the number of turns after which corpses rot away.
+const corpseRotTurns = 200
+
+// LeaveCorpse replaces the dead monster i by a corpse entity at the same
+// position.
+func (g *game) LeaveCorpse(i int) {
+	p := g.ECS.Positions[i]
+	c := &Corpse{
+		Of:      g.ECS.Name[i],
+		Fighter: *g.ECS.Fighter[i],
+		Rune:    g.ECS.Style[i].Rune,
+		Undead:  g.ECS.AI[i] != nil && g.ECS.AI[i].Undead,
+	}
+	g.ECS.RemoveEntity(i)
+	j := g.ECS.AddEntity(c, p)
+	g.ECS.Name[j] = c.Of + " corpse"
+	g.ECS.Style[j] = Style{Rune: '%'}
+}
+
+func init() {
+	registerTurnHook(turnHook{Name: "corpses", Order: turnWorld + 1, Run: (*game).RotCorpses})
+}
+
+// RotCorpses ages corpses, removing those that rotted away.
+func (g *game) RotCorpses() {
+	for i, e := range g.ECS.Entities {
+		c, ok := e.(*Corpse)
+		if !ok {
+			continue
+		}
+		c.Age++
+		if c.Age >= corpseRotTurns {
+			g.ECS.RemoveEntity(i)
+		}
+	}
+}
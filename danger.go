@@ -0,0 +1,82 @@
+// This file implements the danger map overlay: visible tiles are colored by
+// the number of visible enemies that could attack the player there during
+// the next turn, to help with tactical positioning.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// DangerMap returns, for walkable tiles in view, the number of visible
+// enemies that could attack the player there during the next turn. Tiles out
+// of reach of all enemies are not in the map.
+//
+// An enemy with n actions next turn, taking into account its energy and
+// speed, can walk n-1 steps and then attack an adjacent tile. Ranged
+// attackers also threaten tiles within range to which they have a clear
+// shot. Other monsters are not taken into account as obstacles, so the
+// result errs on the side of caution.
+func (g *game) DangerMap() map[gruid.Point]int {
+	danger := map[gruid.Point]int{}
+	pid := g.ECS.PlayerID
+	elapsed := normalSpeed * normalSpeed / g.ECS.Speed(pid)
+	for _, i := range g.ECS.AI.sortedKeys() {
+		p := g.ECS.Positions[i]
+		if !g.ECS.Alive(i) || !g.ECS.Hostile(i, pid) || !g.InFOV(p) || g.Unseen(i) {
+			continue
+		}
+		actions := (g.ECS.Energy[i] + g.ECS.Speed(i)*elapsed/normalSpeed) / normalSpeed
+		if actions < 1 {
+			// Slow monsters may not act next turn.
+			continue
+		}
+		reach := actions
+		if g.ECS.Status(i, StatusWebbed) {
+			reach = 1
+		}
+		threatened := map[gruid.Point]bool{}
+		for _, n := range g.PR.BreadthFirstMap(&path{m: g.Map}, []gruid.Point{p}, reach) {
+			if n.Cost >= 1 {
+				threatened[n.P] = true
+			}
+		}
+		if rng := g.ECS.AI[i].Range; rng > 0 {
+			rg := gruid.NewRange(-rng, -rng, rng+1, rng+1).Add(p).Intersect(g.Map.Grid.Range())
+			rg.Iter(func(q gruid.Point) {
+				if g.Map.Walkable(q) && paths.DistanceManhattan(p, q) <= rng && g.ClearShot(p, q) {
+					threatened[q] = true
+				}
+			})
+		}
+		for q := range threatened {
+			if q != p && g.InFOV(q) {
+				danger[q]++
+			}
+		}
+	}
+	return danger
+}
+
+// DrawDanger colors the tiles of the danger map in the effects layer, if
+// the danger map overlay is enabled.
+func (m *model) DrawDanger(gd gruid.Grid) {
+	if !m.danger {
+		return
+	}
+	for q, n := range m.game.DangerMap() {
+		// We keep the map's rune and foreground, changing only the
+		// background.
+		c := m.layers.Map.At(q)
+		switch {
+		case n == 1:
+			c.Style.Bg = ColorDangerLow
+		case n == 2:
+			c.Style.Bg = ColorDangerMedium
+		default:
+			c.Style.Bg = ColorDangerHigh
+		}
+		gd.Set(q, c)
+	}
+}
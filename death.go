@@ -0,0 +1,137 @@
+// This file implements death effects: effects triggered when an entity is
+// killed, like exploding or splitting.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// deathKind represents a kind of effect triggered on death.
+type deathKind int
+
+// These constants represent the available kinds of death effects.
+const (
+	DeathExplode  deathKind = iota // damages adjacent fighters
+	DeathCurse                     // curses an item of the player
+	DeathDropItem                  // drops a quest item
+	DeathSplit                     // splits into two smaller copies
+)
+
+// DeathEffect describes an effect triggered when an entity is killed.
+type DeathEffect struct {
+	Kind deathKind `json:"kind"`
+	Item string    `json:"item"` // name of the dropped item (DeathDropItem)
+}
+
+// DeathEffects lists the effects triggered when an entity is killed.
+type DeathEffects []DeathEffect
+
+// explodeDamage is the damage inflicted by death explosions.
+const explodeDamage = 3
+
+// Kill handles the death of fighter entity i. This is the only place where
+// death happens: death effects are triggered, then quests and reputation are
+// updated, loot is dropped, and monsters are replaced by a corpse.
+func (g *game) Kill(i int) {
+	fi := g.ECS.Fighter[i]
+	if fi.HP > 0 {
+		fi.HP = 0
+	}
+	// The dead do not block movement.
+	delete(g.ECS.Blocks, i)
+	if i == g.ECS.PlayerID {
+		// The dead player is shown as a corpse, but stays a fighter
+		// entity for end of game handling.
+		g.ECS.Style[i] = Style{Rune: '%'}
+		return
+	}
+	effects := g.ECS.OnDeath[i]
+	delete(g.ECS.OnDeath, i)
+	for _, e := range effects {
+		g.TriggerDeathEffect(i, e)
+	}
+	g.UpdateQuests(QuestKill, g.ECS.Name[i])
+	if g.ECS.Ally(i) {
+		g.AddReputation(allyLostReputation, "ally lost")
+	}
+	g.DropLoot(i)
+	g.LeaveCorpse(i)
+}
+
+// TriggerDeathEffect triggers the death effect e of the dying entity i.
+func (g *game) TriggerDeathEffect(i int, e DeathEffect) {
+	p := g.ECS.Positions[i]
+	seen := g.InFOV(p)
+	name := g.ECS.HighlightName(i, g.ECS.Name[i])
+	switch e.Kind {
+	case DeathExplode:
+		if seen {
+			g.Logf("The %v bursts!", ColorLogAbility, name)
+		}
+		for _, j := range g.ECS.Fighter.sortedKeys() {
+			if j != i && g.ECS.Alive(j) && paths.DistanceManhattan(p, g.ECS.Positions[j]) <= 1 {
+				g.Damage(j, explodeDamage)
+			}
+		}
+	case DeathCurse:
+		if !seen {
+			return
+		}
+		items := []int{}
+		for _, j := range g.ECS.Inventory[g.ECS.PlayerID].Items {
+			if buc := g.ECS.BUC[j]; buc != nil && buc.Blessing != Cursed {
+				items = append(items, j)
+			}
+		}
+		if len(items) == 0 {
+			return
+		}
+		j := items[g.Rand(RNGCombat).Intn(len(items))]
+		g.ECS.BUC[j].Blessing = Cursed
+		g.ECS.BUC[j].Known = true
+		g.Logf("With a dying curse, %v curses your %v!", ColorLogAbility, name, g.ECS.HighlightName(j, g.ECS.Name[j]))
+	case DeathDropItem:
+		g.ECS.AddItem(&QuestItem{}, p, e.Item, '\'')
+		if seen {
+			g.Logf("The %v drops the %s.", ColorLogAbility, name, Highlight(MarkupItem, e.Item))
+		}
+	case DeathSplit:
+		g.Split(i)
+	}
+}
+
+// Split adds two copies of the dying monster i with half its maximum HP on
+// free cells around it. Copies that are too small do not split again.
+func (g *game) Split(i int) {
+	fi := g.ECS.Fighter[i]
+	maxHP := fi.MaxHP / 2
+	if maxHP < 1 {
+		return
+	}
+	p := g.ECS.Positions[i]
+	free := []gruid.Point{}
+	for _, q := range []gruid.Point{p, p.Shift(-1, 0), p.Shift(1, 0), p.Shift(0, -1), p.Shift(0, 1)} {
+		if g.Map.Walkable(q) && g.ECS.NoBlockingEntityAt(q) {
+			free = append(free, q)
+		}
+	}
+	for k := 0; k < 2 && k < len(free); k++ {
+		j := g.ECS.AddEntity(&Monster{}, free[k])
+		g.ECS.Blocks[j] = true
+		g.ECS.Fighter[j] = &fighter{HP: maxHP, MaxHP: maxHP, Defense: fi.Defense, Power: fi.Power}
+		g.ECS.Name[j] = g.ECS.Name[i]
+		g.ECS.Style[j] = g.ECS.Style[i]
+		ai := *g.ECS.AI[i]
+		ai.Path = nil
+		g.ECS.AI[j] = &ai
+		g.ECS.Faction[j] = g.ECS.Faction[i]
+		if maxHP >= 2 {
+			g.ECS.OnDeath[j] = DeathEffects{{Kind: DeathSplit}}
+		}
+	}
+	if g.InFOV(p) {
+		g.Logf("The %v splits as it dies!", ColorLogAbility, g.ECS.HighlightName(i, g.ECS.Name[i]))
+	}
+}
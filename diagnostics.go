@@ -0,0 +1,116 @@
+// This file implements wizard mode diagnostics: an overlay showing timing
+// information, useful to catch performance regressions, and a check for
+// leaked entity references.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// wizard enables wizard mode for new games. It is set with the -wizard
+// command-line flag.
+var wizard bool
+
+// diagnostics contains timing information shown in the diagnostics overlay.
+type diagnostics struct {
+	Show   bool          // whether the overlay is shown
+	Update time.Duration // duration of last Update
+	Draw   time.Duration // duration of last Draw
+}
+
+// timeUpdate records the duration of an Update call started at start.
+func (m *model) timeUpdate(start time.Time) {
+	m.diag.Update = time.Since(start)
+}
+
+// timeDraw records the duration of a Draw call started at start.
+func (m *model) timeDraw(start time.Time) {
+	m.diag.Draw = time.Since(start)
+}
+
+// timeEndTurn records the duration of an EndTurn call started at start.
+func (g *game) timeEndTurn(start time.Time) {
+	g.turnTime = time.Since(start)
+}
+
+// CheckLeaks scans the ECS for orphaned component entries, whose entity was
+// removed, as well as dangling references to entities in inventories,
+// equipment and the spatial index. It returns a description of each problem
+// found.
+func (es *ECS) CheckLeaks() []string {
+	leaks := []string{}
+	names := []string{}
+	comps := es.components()
+	for name := range comps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ids := comps[name].keys()
+		sort.Ints(ids)
+		for _, i := range ids {
+			if _, ok := es.Entities[i]; !ok {
+				leaks = append(leaks, fmt.Sprintf("%s: orphaned entry for entity %d", name, i))
+			}
+		}
+	}
+	for i, inv := range es.Inventory {
+		for _, j := range inv.Items {
+			if _, ok := es.Entities[j]; !ok {
+				leaks = append(leaks, fmt.Sprintf("Inventory: entity %d holds removed entity %d", i, j))
+			}
+		}
+	}
+	for i, eq := range es.Equipment {
+		for _, j := range eq {
+			if _, ok := es.Entities[j]; !ok {
+				leaks = append(leaks, fmt.Sprintf("Equipment: entity %d equips removed entity %d", i, j))
+			}
+		}
+	}
+	for p, ids := range es.atPos {
+		for _, i := range ids {
+			if q, ok := es.Positions[i]; !ok || q != p {
+				leaks = append(leaks, fmt.Sprintf("spatial index: stale entry for entity %d at %v", i, p))
+			}
+		}
+	}
+	return leaks
+}
+
+// ReportLeaks logs the result of a leak check.
+func (g *game) ReportLeaks() {
+	leaks := g.ECS.CheckLeaks()
+	if len(leaks) == 0 {
+		g.Logf("Leak check: no problems found (%d entities).", ColorLogSpecial, len(g.ECS.Entities))
+		return
+	}
+	for _, l := range leaks {
+		g.Logf("Leak check: %s", ColorLogSpecial, l)
+	}
+}
+
+// DrawDiagnostics draws the diagnostics overlay in the top-right corner of
+// the map grid, if enabled. The times shown are those of the previous frame.
+func (m *model) DrawDiagnostics(mapgrid gruid.Grid) {
+	if !m.game.Options.Wizard || !m.diag.Show {
+		return
+	}
+	lb := ui.Label{
+		Box: &ui.Box{Title: ui.Text("Diagnostics")},
+		Content: ui.Textf("Draw:     %v\nUpdate:   %v\nEndTurn:  %v\nEntities: %d\nPaths:    %d (%d skipped)",
+			m.diag.Draw.Round(time.Microsecond), m.diag.Update.Round(time.Microsecond),
+			m.game.turnTime.Round(time.Microsecond), len(m.game.ECS.Entities),
+			aiPathBudget-m.game.budget.paths, m.game.budget.skipped),
+		AdjustWidth: true,
+	}
+	const width = 26
+	rg := mapgrid.Range()
+	lb.Draw(mapgrid.Slice(rg.Shift(rg.Max.X-width, 0, 0, 0)))
+}
@@ -0,0 +1,86 @@
+// This file implements monster drops: items left by monsters on their tile
+// when killed.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/anaseto/gruid"
+)
+
+// dropKind represents a kind of item a monster can drop.
+type dropKind int
+
+// These constants represent the kinds of drops.
+const (
+	DropPotion    dropKind = iota // a healing potion
+	DropItem                      // a random item
+	DropEquipment                 // a piece of equipment
+	DropGold                      // a pile of gold
+)
+
+// drop describes a possible drop with its percentage chance.
+type drop struct {
+	Kind   dropKind `json:"kind"`
+	Chance int      `json:"chance"`
+}
+
+// Drops is a component listing the possible drops of a monster. Each drop is
+// rolled independently when the monster is killed.
+type Drops []drop
+
+// dropTables contains the drop tables for each kind of monster.
+var dropTables = map[monsterKind]Drops{
+	MonsterOrc:          {{DropGold, 30}, {DropPotion, 10}},
+	MonsterWolf:         {},
+	MonsterTroll:        {{DropGold, 40}, {DropEquipment, 15}},
+	MonsterNecromancer:  {{DropItem, 60}},
+	MonsterOrcChieftain: {{DropGold, 100}, {DropEquipment, 50}},
+	MonsterOrcWarlord:   {{DropGold, 100}, {DropEquipment, 100}},
+	MonsterBat:          {},
+	MonsterSlime:        {},
+	MonsterOrcArcher:    {{DropGold, 30}},
+	MonsterSpider:       {{DropPotion, 20}},
+	MonsterGhost:        {},
+	MonsterShopkeeper:   {{DropGold, 100}},
+	MonsterTownGuard:    {},
+}
+
+// Gold is a pile of gold pieces.
+type Gold struct {
+	Amount int `json:"amount"`
+}
+
+// AddGold adds a pile of gold with the given amount at p, and returns its id.
+func (g *game) AddGold(amount int, p gruid.Point) int {
+	return g.ECS.AddItem(&Gold{Amount: amount}, p, fmt.Sprintf("%d gold pieces", amount), '$')
+}
+
+// DropLoot rolls the drops of the killed monster i, and places them on its
+// tile.
+func (g *game) DropLoot(i int) {
+	p := g.ECS.Positions[i]
+	for _, d := range g.ECS.Drops[i] {
+		if g.Rand(RNGLoot).Intn(100) >= d.Chance {
+			continue
+		}
+		switch d.Kind {
+		case DropPotion:
+			if g.Rule(RuleNoHealingPotions) {
+				continue
+			}
+			id := g.ECS.AddItem(&HealingPotion{Amount: 4}, p, "health potion", '!')
+			g.ECS.BUC[id] = &BUC{Blessing: g.RandomBlessing()}
+		case DropItem:
+			g.PlaceRandomItem(p)
+		case DropEquipment:
+			id := g.PlaceEquipment(p)
+			g.ECS.BUC[id] = &BUC{Blessing: g.RandomBlessing()}
+		case DropGold:
+			g.AddGold(1+g.Rand(RNGLoot).Intn(5+5*g.Depth), p)
+		}
+	}
+	// Drops happen only once.
+	delete(g.ECS.Drops, i)
+}
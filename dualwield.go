@@ -0,0 +1,118 @@
+// This file implements dual-wielding: a second one-handed weapon can be
+// wielded in the off-hand, instead of a shield. Both weapons then strike on
+// each melee attack, but each strike may miss.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anaseto/gruid/ui"
+)
+
+// dualWieldMiss is the accuracy penalty of dual-wielding: each strike misses
+// with a 1 in dualWieldMiss chance.
+const dualWieldMiss = 4
+
+// weaponSlot returns the weapon slot in which the actor wields the new weapon
+// w: the off-hand if the main hand already wields a one-handed weapon, and
+// neither the off-hand nor the shield slot are in use. Otherwise, the weapon
+// replaces the main weapon.
+func (g *game) weaponSlot(actor int, w *Weapon) equipSlot {
+	eq := g.ECS.Equipment[actor]
+	main, ok := eq[SlotWeapon]
+	if !ok || w.TwoHanded {
+		return SlotWeapon
+	}
+	if mw, ok := g.ECS.Entities[main].(*Weapon); !ok || mw.TwoHanded {
+		return SlotWeapon
+	}
+	if _, ok := eq[SlotOffhand]; ok {
+		return SlotWeapon
+	}
+	if _, ok := eq[SlotShield]; ok {
+		return SlotWeapon
+	}
+	return SlotOffhand
+}
+
+// FreeOffhand unequips the off-hand weapon of the actor, if any, when the new
+// item e needs the off-hand: shields, and two-handed weapons. It returns an
+// error if the off-hand weapon is cursed.
+func (g *game) FreeOffhand(actor int, e Equippable) error {
+	j, ok := g.ECS.Equipment[actor][SlotOffhand]
+	if !ok {
+		return nil
+	}
+	switch e := e.(type) {
+	case *Shield:
+	case *Weapon:
+		if !e.TwoHanded {
+			return nil
+		}
+	default:
+		return nil
+	}
+	if err := g.Unequip(actor, j); err != nil {
+		return err
+	}
+	g.Logf("You remove the %s.", ColorLogItemUse, g.ECS.HighlightName(j, g.ECS.GetName(j)))
+	return nil
+}
+
+// OffhandPower returns the attack power of the strikes of the off-hand weapon
+// of fighter i: the off-hand weapon is used instead of the main one.
+func (es *ECS) OffhandPower(i int) int {
+	power := es.Power(i)
+	if w, ok := es.Entities[es.Equipment[i][SlotWeapon]].(*Weapon); ok {
+		power -= w.Power
+	}
+	if w, ok := es.Entities[es.Equipment[i][SlotOffhand]].(*Weapon); ok {
+		power += w.Power
+	}
+	return power
+}
+
+// DualAttack implements a melee attack of a dual-wielding fighter i on j:
+// the main weapon strikes first, and then the off-hand one, if the defender
+// is still alive. Each strike may miss.
+func (g *game) DualAttack(i, j int) {
+	strikes := []struct {
+		slot  equipSlot
+		verb  string // verb of a hit
+		miss  string // log format of a miss
+		power int
+	}{
+		{SlotWeapon, "attacks", "%v misses %v", g.ECS.Power(i)},
+		{SlotOffhand, "also strikes", "%v misses %v with the off-hand", g.ECS.OffhandPower(i)},
+	}
+	color := ColorLogMonsterAttack
+	if i == g.ECS.PlayerID {
+		color = ColorLogPlayerAttack
+	}
+	for _, s := range strikes {
+		if !g.ECS.Alive(j) || g.ECS.PlayerDied() {
+			return
+		}
+		if g.Rand(RNGCombat).Intn(dualWieldMiss) != 0 {
+			damage := g.AttackWith(i, j, s.verb, s.power)
+			g.WeaponStrike(i, j, s.slot, s.power, damage)
+			continue
+		}
+		if i == g.ECS.PlayerID || j == g.ECS.PlayerID || g.InFOV(g.ECS.Positions[i]) || g.InFOV(g.ECS.Positions[j]) {
+			g.Logf(s.miss, color, g.ECS.HighlightName(i, strings.Title(g.ECS.Name[i])), g.ECS.HighlightName(j, g.ECS.Name[j]))
+		}
+	}
+}
+
+// powerLine returns the character sheet line showing the player's attack
+// power, along with the power of the off-hand weapon when dual-wielding.
+func (g *game) powerLine() ui.StyledText {
+	i := g.ECS.PlayerID
+	s := fmt.Sprintf("  Power:      %d", g.ECS.Power(i))
+	if _, ok := g.ECS.Equipment[i][SlotOffhand]; ok {
+		s += fmt.Sprintf(" (off-hand %d)", g.ECS.OffhandPower(i))
+	}
+	return ui.Text(s)
+}
@@ -0,0 +1,159 @@
+// This file implements enchantment scrolls, which permanently improve an
+// equipped item chosen by the player in a small selection menu.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// Enchantable describes equipment that can be enchanted.
+type Enchantable interface {
+	Equippable
+	// Enchant permanently changes the item's bonus by n.
+	Enchant(n int)
+	// Enchantment returns the total enchantment of the item.
+	Enchantment() int
+}
+
+func (w *Weapon) Enchant(n int)    { w.Power += n; w.Plus += n }
+func (w *Weapon) Enchantment() int { return w.Plus }
+
+func (ar *Armor) Enchant(n int)    { ar.Defense += n; ar.Plus += n }
+func (ar *Armor) Enchantment() int { return ar.Plus }
+
+func (sh *Shield) Enchant(n int)    { sh.Defense += n; sh.Plus += n }
+func (sh *Shield) Enchantment() int { return sh.Plus }
+
+func (b *Bow) Enchant(n int)    { b.Power += n; b.Plus += n }
+func (b *Bow) Enchantment() int { return b.Plus }
+
+// ItemSelector describes consumables that act on another item of the actor,
+// chosen when the consumable is used.
+type ItemSelector interface {
+	// Candidates returns the items of the actor that can be chosen, or
+	// an error if there are none.
+	Candidates(g *game, actor int) ([]int, error)
+}
+
+// EnchantScroll is an item that can be invoked to permanently improve an
+// equipped item of the given slots.
+type EnchantScroll struct {
+	Slots []equipSlot `json:"slots"`
+	What  string      `json:"what"` // kind of enchanted items (weapon, armor)
+}
+
+func (sc *EnchantScroll) Candidates(g *game, actor int) ([]int, error) {
+	items := []int{}
+	for _, sl := range sc.Slots {
+		i, ok := g.ECS.Equipment[actor][sl]
+		if !ok {
+			continue
+		}
+		if _, ok := g.ECS.Entities[i].(Enchantable); ok {
+			items = append(items, i)
+		}
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("You have no equipped %s to enchant.", sc.What)
+	}
+	return items, nil
+}
+
+func (sc *EnchantScroll) Activate(g *game, a itemAction) error {
+	items, err := sc.Candidates(g, a.Actor)
+	if err != nil {
+		return err
+	}
+	var e Enchantable
+	for _, i := range items {
+		if i == a.Item {
+			e = g.ECS.Entities[i].(Enchantable)
+		}
+	}
+	if e == nil {
+		return errors.New("You have to choose an item to enchant.")
+	}
+	old := g.ECS.GetName(a.Item)
+	switch a.Blessing {
+	case Cursed:
+		// Cursed scrolls backfire: the item is weakened.
+		e.Enchant(-1)
+		g.Logf("Your %s darkens and becomes a %s (cursed scroll).", ColorLogSpecial, old, g.ECS.GetName(a.Item))
+		return nil
+	case Blessed:
+		e.Enchant(2)
+	default:
+		e.Enchant(1)
+	}
+	g.Logf("Your %s glows and becomes a %s.", ColorLogItemUse, old, g.ECS.GetName(a.Item))
+	return nil
+}
+
+// enchantName returns the name of an item with the given enchantment.
+func enchantName(name string, n int) string {
+	if n == 0 {
+		return name
+	}
+	return fmt.Sprintf("%+d %s", n, name)
+}
+
+// SelectsItem returns true if using the n-th item of the actor's inventory
+// requires choosing another item.
+func (g *game) SelectsItem(actor, n int) bool {
+	inv := g.ECS.Inventory[actor]
+	if len(inv.Items) <= n {
+		return false
+	}
+	_, ok := g.ECS.Entities[inv.Items[n]].(ItemSelector)
+	return ok
+}
+
+// itemSelection describes the selection of an item on which another item of
+// the inventory acts.
+type itemSelection struct {
+	n     int   // inventory slot of the used item
+	items []int // items that can be selected
+}
+
+// OpenItemSelection opens a menu for choosing the item on which the n-th
+// item of the player's inventory acts.
+func (m *model) OpenItemSelection(n int) error {
+	pid := m.game.ECS.PlayerID
+	sel := m.game.ECS.Entities[m.game.ECS.Inventory[pid].Items[n]].(ItemSelector)
+	items, err := sel.Candidates(m.game, pid)
+	if err != nil {
+		return err
+	}
+	m.selection = itemSelection{n: n, items: items}
+	lp := listPicker{Title: "Enchant which item?", Letters: true, Height: len(items) + 2}
+	for _, i := range items {
+		lp.Entries = append(lp.Entries, pickerEntry{Text: m.game.ECS.GetName(i)})
+	}
+	m.inventory = lp.Menu()
+	m.mode = modeItemSelection
+	return nil
+}
+
+// updateItemSelection handles input messages when the item selection menu
+// is open.
+func (m *model) updateItemSelection(msg gruid.Msg) {
+	m.inventory.Update(msg)
+	switch m.inventory.Action() {
+	case ui.MenuQuit:
+		m.mode = modeNormal
+	case ui.MenuInvoke:
+		m.mode = modeNormal
+		i := m.selection.items[m.inventory.Active()]
+		err := m.game.InventoryActivateOnItem(m.game.ECS.PlayerID, m.selection.n, i)
+		if err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+			break
+		}
+		m.game.EndTurn()
+	}
+}
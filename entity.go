@@ -4,6 +4,10 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
 	"github.com/anaseto/gruid"
 	"github.com/anaseto/gruid/rl"
 )
@@ -12,31 +16,145 @@ import (
 // (Entity-Component-System) in this tutorial, opting for a simpler hybrid
 // approach good enough for the tutorial purposes.
 type ECS struct {
-	Entities  map[int]Entity      // set of entities
-	Positions map[int]gruid.Point // entity index: map position
-	PlayerID  int                 // index of Player's entity (for convenience)
-	NextID    int                 // next available id
+	Entities  componentMap[Entity]      // set of entities
+	Positions componentMap[gruid.Point] // entity index: map position
+	PlayerID  int                       // index of Player's entity (for convenience)
+	NextID    int                       // next available id
+
+	Fighter   componentMap[*fighter]     // figthing component
+	AI        componentMap[*AI]          // AI component
+	Name      componentMap[string]       // name component
+	Style     componentMap[Style]        // default style component
+	Inventory componentMap[*Inventory]   // inventory component
+	Statuses  componentMap[Statuses]     // statuses (confused, etc.)
+	BUC       componentMap[*BUC]         // blessed/uncursed/cursed state of items
+	Equipment componentMap[Equipment]    // equipped items
+	Drops     componentMap[Drops]        // possible drops on death
+	Blocks    componentMap[bool]         // entities blocking movement
+	Speeds    componentMap[int]          // speed, if not normal
+	Energy    componentMap[int]          // accumulated energy for acting
+	Faction   componentMap[faction]      // faction of fighters
+	Abilities componentMap[Abilities]    // special abilities of monsters
+	Regen     componentMap[*Regen]       // natural regeneration
+	OnDeath   componentMap[DeathEffects] // effects triggered on death
+
+	atPos map[gruid.Point][]int // spatial index: map position: entities
+}
+
+// componentMap is a generic store mapping entity indexes to the values of a
+// particular component. It is a plain map, so components are accessed as
+// usual with es.Fighter[i] and so on.
+type componentMap[T any] map[int]T
+
+// componentStore is the type-independent interface of component maps, used
+// to initialize them and remove entities from all of them at once.
+type componentStore interface {
+	init()
+	remove(i int)
+	keys() []int
+	encode() (map[int]json.RawMessage, error)
+	decode(map[int]json.RawMessage) error
+}
+
+// init makes the component map, if needed.
+func (cm *componentMap[T]) init() {
+	if *cm == nil {
+		*cm = componentMap[T]{}
+	}
+}
+
+// remove removes the component for the entity i.
+func (cm *componentMap[T]) remove(i int) {
+	delete(*cm, i)
+}
+
+// keys returns the indexes of the entities having the component.
+func (cm *componentMap[T]) keys() []int {
+	ks := make([]int, 0, len(*cm))
+	for i := range *cm {
+		ks = append(ks, i)
+	}
+	return ks
+}
 
-	Fighter   map[int]*fighter   // figthing component
-	AI        map[int]*AI        // AI component
-	Name      map[int]string     // name component
-	Style     map[int]Style      // default style component
-	Inventory map[int]*Inventory // inventory component
-	Statuses  map[int]Statuses   // statuses (confused, etc.)
+// encode encodes each component value of the map, by entity.
+func (cm *componentMap[T]) encode() (map[int]json.RawMessage, error) {
+	data := make(map[int]json.RawMessage, len(*cm))
+	for i, v := range *cm {
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = bs
+	}
+	return data, nil
+}
+
+// decode fills the map with decoded component values.
+func (cm *componentMap[T]) decode(data map[int]json.RawMessage) error {
+	*cm = make(componentMap[T], len(data))
+	for i, bs := range data {
+		var v T
+		if err := json.Unmarshal(bs, &v); err != nil {
+			return fmt.Errorf("entity %d: %v", i, err)
+		}
+		(*cm)[i] = v
+	}
+	return nil
+}
+
+// sortedKeys returns the indexes of the entities having the component, in
+// increasing order. It is used instead of plain map iteration when the order
+// matters, so that turns are reproducible from the same random seed.
+func (cm *componentMap[T]) sortedKeys() []int {
+	ks := cm.keys()
+	sort.Ints(ks)
+	return ks
+}
+
+// components returns all the component stores of the ECS, by name. The names
+// are the ones used in saved games, so they should not be changed. Adding a
+// new component only requires adding a field to ECS and listing it here.
+func (es *ECS) components() map[string]componentStore {
+	return map[string]componentStore{
+		"entities":  &es.Entities,
+		"positions": &es.Positions,
+		"fighter":   &es.Fighter,
+		"ai":        &es.AI,
+		"name":      &es.Name,
+		"style":     &es.Style,
+		"inventory": &es.Inventory,
+		"statuses":  &es.Statuses,
+		"buc":       &es.BUC,
+		"equipment": &es.Equipment,
+		"drops":     &es.Drops,
+		"blocks":    &es.Blocks,
+		"speeds":    &es.Speeds,
+		"energy":    &es.Energy,
+		"faction":   &es.Faction,
+		"abilities": &es.Abilities,
+		"regen":     &es.Regen,
+		"on_death":  &es.OnDeath,
+	}
 }
 
 // NewECS returns an initialized ECS structure.
 func NewECS() *ECS {
-	return &ECS{
-		Entities:  map[int]Entity{},
-		Positions: map[int]gruid.Point{},
-		Fighter:   map[int]*fighter{},
-		AI:        map[int]*AI{},
-		Name:      map[int]string{},
-		Style:     map[int]Style{},
-		Inventory: map[int]*Inventory{},
-		Statuses:  map[int]Statuses{},
-		NextID:    0,
+	es := &ECS{}
+	es.InitComponents()
+	return es
+}
+
+// InitComponents makes any missing component maps and builds the spatial
+// index. It is also used after loading a saved game, because the spatial
+// index is not saved.
+func (es *ECS) InitComponents() {
+	for _, c := range es.components() {
+		c.init()
+	}
+	es.atPos = map[gruid.Point][]int{}
+	for i, p := range es.Positions {
+		es.atPos[p] = append(es.atPos[p], i)
 	}
 }
 
@@ -45,6 +163,7 @@ func (es *ECS) AddEntity(e Entity, p gruid.Point) int {
 	id := es.NextID
 	es.Entities[id] = e
 	es.Positions[id] = p
+	es.atPos[p] = append(es.atPos[p], id)
 	es.NextID++
 	return id
 }
@@ -59,19 +178,46 @@ func (es *ECS) AddItem(e Entity, p gruid.Point, name string, r rune) int {
 
 // RemoveEntity removes an entity, given its identifier.
 func (es *ECS) RemoveEntity(i int) {
-	delete(es.Entities, i)
-	delete(es.Positions, i)
-	delete(es.Fighter, i)
-	delete(es.AI, i)
-	delete(es.Name, i)
-	delete(es.Style, i)
-	delete(es.Inventory, i)
-	delete(es.Statuses, i)
+	es.RemovePosition(i)
+	for _, c := range es.components() {
+		c.remove(i)
+	}
 }
 
-// MoveEntity moves the i-th entity to p.
+// MoveEntity moves the i-th entity to p. It can also be used to put back on
+// the map an entity without position, like a dropped item.
 func (es *ECS) MoveEntity(i int, p gruid.Point) {
+	es.RemovePosition(i)
 	es.Positions[i] = p
+	es.atPos[p] = append(es.atPos[p], i)
+}
+
+// RemovePosition removes the i-th entity from the map, as happens for
+// example with items picked up into an inventory.
+func (es *ECS) RemovePosition(i int) {
+	p, ok := es.Positions[i]
+	if !ok {
+		return
+	}
+	delete(es.Positions, i)
+	ids := es.atPos[p]
+	for k, j := range ids {
+		if j == i {
+			ids = append(ids[:k], ids[k+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(es.atPos, p)
+	} else {
+		es.atPos[p] = ids
+	}
+}
+
+// EntitiesAt returns the entities at p, in the order they were put there. The
+// returned slice should not be modified.
+func (es *ECS) EntitiesAt(p gruid.Point) []int {
+	return es.atPos[p]
 }
 
 // MovePlayer moves the player entity to p.
@@ -90,27 +236,42 @@ func (es *ECS) PP() gruid.Point {
 	return es.Positions[es.PlayerID]
 }
 
-// MonsterAt returns the id of the Monster at p, if any, or -1 if there is no
-// monster at p.
+// MonsterAt returns the id of the living monster at p, if any, or -1 if
+// there is no monster at p. Monsters are the blocking entities with an AI
+// component.
 func (es *ECS) MonsterAt(p gruid.Point) int {
-	for i, q := range es.Positions {
-		if p != q || !es.Alive(i) {
-			continue
+	i := es.BlockingEntityAt(p)
+	if i >= 0 && es.AI[i] != nil {
+		return i
+	}
+	return -1
+}
+
+// HostilesLeft returns the number of living monsters on the map.
+func (es *ECS) HostilesLeft() int {
+	n := 0
+	for i := range es.Blocks {
+		if es.AI[i] != nil && es.Alive(i) && !es.Ally(i) {
+			n++
 		}
-		e := es.Entities[i]
-		switch e.(type) {
-		case *Monster:
+	}
+	return n
+}
+
+// BlockingEntityAt returns the id of the blocking entity at p, if any, or -1.
+func (es *ECS) BlockingEntityAt(p gruid.Point) int {
+	for _, i := range es.EntitiesAt(p) {
+		if es.Blocks[i] {
 			return i
 		}
 	}
 	return -1
 }
 
-// NoBlockingEntityAt returns true if there is no blocking entity at p (no
-// player nor monsters in this tutorial).
+// NoBlockingEntityAt returns true if there is no blocking entity at p (like
+// the player, living monsters or NPCs).
 func (es *ECS) NoBlockingEntityAt(p gruid.Point) bool {
-	i := es.MonsterAt(p)
-	return es.PP() != p && !es.Alive(i)
+	return es.BlockingEntityAt(p) < 0
 }
 
 // PlayerDied checks whether the player died.
@@ -135,24 +296,27 @@ func (es *ECS) Dead(i int) bool {
 func (es *ECS) GetStyle(i int) (r rune, c gruid.Color) {
 	r = es.Style[i].Rune
 	c = es.Style[i].Color
-	if es.Dead(i) {
-		// Alternate representation for corpses of dead monsters.
-		r = '%'
-		c = gruid.ColorDefault
-	}
 	return r, c
 }
 
-// GetName returns the name of an entity, which most often is name given by the
-// Name component, except for corpses.
+// GetName returns the name of an entity, as given by the Name component. The
+// blessing state of items is shown when known.
 func (es *ECS) GetName(i int) (s string) {
 	name := es.Name[i]
-	if es.Dead(i) {
-		name = "corpse"
+	if e, ok := es.Entities[i].(Enchantable); ok {
+		name = enchantName(name, e.Enchantment())
+	}
+	if buc := es.BUC[i]; buc != nil && buc.Known {
+		name = buc.Blessing.String() + " " + name
 	}
 	return name
 }
 
+func init() {
+	registerTurnHook(turnHook{Name: "statuses", Order: turnStatuses, Alive: true,
+		Run: func(g *game) { g.ECS.StatusesNextTurn() }})
+}
+
 // StatusesNextTurn updates the remaining turns of entities' statuses.
 func (es *ECS) StatusesNextTurn() {
 	for _, sts := range es.Statuses {
@@ -192,15 +356,11 @@ const (
 // RenderOrder returns the rendering priority of an entity.
 func (es *ECS) RenderOrder(i int) (ro renderOrder) {
 	switch es.Entities[i].(type) {
-	case *Player:
+	case *Player, *NPC, *Monster:
 		ro = ROActor
-	case *Monster:
-		if es.Dead(i) {
-			ro = ROCorpse
-		} else {
-			ro = ROActor
-		}
-	case *Consumable:
+	case *Corpse:
+		ro = ROCorpse
+	case Consumable, Equippable, *Amulet, *QuestItem, *Gold, *Arrows:
 		ro = ROItem
 	}
 	return ro
@@ -211,7 +371,8 @@ type Entity interface{}
 
 // Player contains information relevant to the player.
 type Player struct {
-	FOV *rl.FOV // player's field of view
+	FOV  *rl.FOV `json:"-"`    // player's field of view (not saved)
+	Gold int     `json:"gold"` // gold pieces carried
 }
 
 // maxLOS is the maximum distance in player's field of view.
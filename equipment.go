@@ -0,0 +1,386 @@
+// This file handles equipment: equippable items and equipment slots.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// equipSlot describes the different kinds of equipment slots.
+type equipSlot int
+
+const (
+	SlotWeapon equipSlot = iota
+	SlotArmor
+	SlotShield
+	SlotRanged
+	SlotRingLeft
+	SlotRingRight
+	SlotOffhand // second one-handed weapon (dual-wielding)
+)
+
+func (sl equipSlot) String() (s string) {
+	switch sl {
+	case SlotWeapon:
+		s = "weapon"
+	case SlotArmor:
+		s = "armor"
+	case SlotShield:
+		s = "shield"
+	case SlotRanged:
+		s = "ranged weapon"
+	case SlotRingLeft:
+		s = "left ring"
+	case SlotRingRight:
+		s = "right ring"
+	case SlotOffhand:
+		s = "off-hand weapon"
+	}
+	return s
+}
+
+// Rune returns the map rune used for items of the slot.
+func (sl equipSlot) Rune() (r rune) {
+	switch sl {
+	case SlotWeapon, SlotOffhand:
+		r = '/'
+	case SlotArmor:
+		r = '['
+	case SlotShield:
+		r = ')'
+	case SlotRanged:
+		r = '}'
+	case SlotRingLeft, SlotRingRight:
+		r = '○'
+	}
+	return r
+}
+
+// equipKind describes a kind of equipment that can be generated in the
+// dungeon.
+type equipKind struct {
+	Name      string
+	Slot      equipSlot
+	Bonus     int  // power for weapons and bows, defense otherwise
+	MinDepth  int  // minimum depth at which the item can be found
+	TwoHanded bool // two-handed weapons cannot be dual-wielded
+}
+
+// equipKinds lists the kinds of generated equipment. Better equipment only
+// appears deeper in the dungeon.
+var equipKinds = []equipKind{
+	{Name: "dagger", Slot: SlotWeapon, Bonus: 2, MinDepth: 1},
+	{Name: "short sword", Slot: SlotWeapon, Bonus: 3, MinDepth: 2},
+	{Name: "battle axe", Slot: SlotWeapon, Bonus: 5, MinDepth: 4, TwoHanded: true},
+	{Name: "leather armor", Slot: SlotArmor, Bonus: 1, MinDepth: 1},
+	{Name: "chain mail", Slot: SlotArmor, Bonus: 2, MinDepth: 3},
+	{Name: "plate armor", Slot: SlotArmor, Bonus: 4, MinDepth: 5},
+	{Name: "buckler", Slot: SlotShield, Bonus: 1, MinDepth: 1},
+	{Name: "kite shield", Slot: SlotShield, Bonus: 2, MinDepth: 3},
+	{Name: "short bow", Slot: SlotRanged, Bonus: 2, MinDepth: 1},
+	{Name: "long bow", Slot: SlotRanged, Bonus: 4, MinDepth: 3},
+}
+
+// Equipment maps equipment slots to the equipped item entities.
+type Equipment map[equipSlot]int
+
+// Equippable describes items that can be equipped in an equipment slot.
+type Equippable interface {
+	// Slot returns the equipment slot of the item.
+	Slot() equipSlot
+	// Bonuses returns the attack power and defense bonuses granted by
+	// the item when equipped.
+	Bonuses() (power, defense int)
+}
+
+// Weapon is an equippable item that increases attack power. One-handed
+// weapons can be wielded in the off-hand too (see dualwield.go).
+type Weapon struct {
+	Power     int            `json:"power"`
+	Plus      int            `json:"plus"`       // enchantment, included in power
+	TwoHanded bool           `json:"two_handed"` // cannot be dual-wielded
+	Hand      equipSlot      `json:"hand"`       // weapon slot the weapon is wielded in
+	Property  weaponProperty `json:"property"`   // special property (see weaponprops.go)
+}
+
+func (w *Weapon) Slot() equipSlot               { return w.Hand }
+func (w *Weapon) Bonuses() (power, defense int) { return w.Power, 0 }
+
+// Armor is an equippable item that increases defense.
+type Armor struct {
+	Defense int `json:"defense"`
+	Plus    int `json:"plus"` // enchantment, included in defense
+}
+
+func (ar *Armor) Slot() equipSlot               { return SlotArmor }
+func (ar *Armor) Bonuses() (power, defense int) { return 0, ar.Defense }
+
+// Shield is an equippable item that increases defense.
+type Shield struct {
+	Defense int `json:"defense"`
+	Plus    int `json:"plus"` // enchantment, included in defense
+}
+
+func (sh *Shield) Slot() equipSlot               { return SlotShield }
+func (sh *Shield) Bonuses() (power, defense int) { return 0, sh.Defense }
+
+// Bow is an equippable ranged weapon used to shoot arrows. It does not
+// increase melee attack power.
+type Bow struct {
+	Power int `json:"power"` // damage bonus of arrows
+	Range int `json:"range"`
+	Plus  int `json:"plus"` // enchantment, included in power
+}
+
+func (b *Bow) Slot() equipSlot               { return SlotRanged }
+func (b *Bow) Bonuses() (power, defense int) { return 0, 0 }
+
+// Equipped returns true if the item i is equipped by the given actor.
+func (es *ECS) Equipped(actor, i int) bool {
+	for _, j := range es.Equipment[actor] {
+		if i == j {
+			return true
+		}
+	}
+	return false
+}
+
+// Power returns the attack power of a fighter entity, taking into account
+// equipment bonuses. An off-hand weapon only counts for its own attacks (see
+// OffhandPower).
+func (es *ECS) Power(i int) int {
+	power := es.Fighter[i].Power
+	for sl, j := range es.Equipment[i] {
+		if sl == SlotOffhand {
+			continue
+		}
+		if e, ok := es.Entities[j].(Equippable); ok {
+			p, _ := e.Bonuses()
+			power += p
+		}
+	}
+	return power
+}
+
+// Defense returns the defense of a fighter entity, taking into account
+// equipment bonuses.
+func (es *ECS) Defense(i int) int {
+	defense := es.Fighter[i].Defense
+	for _, j := range es.Equipment[i] {
+		if e, ok := es.Entities[j].(Equippable); ok {
+			_, d := e.Bonuses()
+			defense += d
+		}
+	}
+	return defense
+}
+
+// ToggleEquip equips the n-th inventory item of the actor, or unequips it if
+// it was already equipped. An item previously equipped in the same slot is
+// unequipped first.
+func (g *game) ToggleEquip(actor, n int) error {
+	inv := g.ECS.Inventory[actor]
+	if len(inv.Items) <= n {
+		return errors.New("Empty slot.")
+	}
+	i := inv.Items[n]
+	e, ok := g.ECS.Entities[i].(Equippable)
+	if !ok {
+		return errors.New("You cannot equip this item.")
+	}
+	if g.ECS.Equipped(actor, i) {
+		if err := g.Unequip(actor, i); err != nil {
+			return err
+		}
+		g.Logf("You remove the %s.", ColorLogItemUse, g.ECS.HighlightName(i, g.ECS.GetName(i)))
+		return nil
+	}
+	if g.ECS.Equipment[actor] == nil {
+		g.ECS.Equipment[actor] = Equipment{}
+	}
+	switch e := e.(type) {
+	case *Ring:
+		e.Hand = g.ringSlot(actor)
+	case *Weapon:
+		e.Hand = g.weaponSlot(actor, e)
+	}
+	if j, ok := g.ECS.Equipment[actor][e.Slot()]; ok {
+		if err := g.Unequip(actor, j); err != nil {
+			return err
+		}
+	}
+	if err := g.FreeOffhand(actor, e); err != nil {
+		return err
+	}
+	g.ECS.Equipment[actor][e.Slot()] = i
+	g.Logf("You equip the %s.", ColorLogItemUse, g.ECS.HighlightName(i, g.ECS.GetName(i)))
+	return nil
+}
+
+// Unequip removes the equipped item i from the actor's equipment. Cursed
+// items cannot be removed.
+func (g *game) Unequip(actor, i int) error {
+	e, ok := g.ECS.Entities[i].(Equippable)
+	if !ok {
+		return nil
+	}
+	if buc := g.ECS.BUC[i]; buc != nil && buc.Blessing == Cursed {
+		buc.Known = true
+		return fmt.Errorf("You cannot remove the %s.", g.ECS.GetName(i))
+	}
+	delete(g.ECS.Equipment[actor], e.Slot())
+	if w, ok := e.(*Weapon); ok {
+		// Weapons go back to the main hand by default.
+		w.Hand = SlotWeapon
+	}
+	return nil
+}
+
+// itemScore returns a score for an equippable item, used to compare items
+// for the same slot.
+func itemScore(e Equippable) int {
+	if b, ok := e.(*Bow); ok {
+		return b.Power
+	}
+	power, defense := e.Bonuses()
+	return power + defense
+}
+
+// AutoEquip equips the best available item of the actor's inventory for each
+// equipment slot. Items known to be cursed are never chosen. It returns an
+// error if no item was equipped.
+func (g *game) AutoEquip(actor int) error {
+	inv := g.ECS.Inventory[actor]
+	changed := false
+	for _, slot := range []equipSlot{SlotWeapon, SlotArmor, SlotShield, SlotRanged} {
+		best, bestScore := -1, 0
+		if j, ok := g.ECS.Equipment[actor][slot]; ok {
+			best, bestScore = j, itemScore(g.ECS.Entities[j].(Equippable))
+		}
+		cur := best
+		for _, i := range inv.Items {
+			e, ok := g.ECS.Entities[i].(Equippable)
+			if !ok || e.Slot() != slot {
+				continue
+			}
+			if buc := g.ECS.BUC[i]; buc != nil && buc.Known && buc.Blessing == Cursed {
+				continue
+			}
+			if score := itemScore(e); best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 || best == cur {
+			continue
+		}
+		if slot == SlotWeapon && cur >= 0 {
+			// Replace the main weapon, instead of wielding the
+			// new one in the off-hand.
+			if err := g.Unequip(actor, cur); err != nil {
+				g.Logf("%v", ColorLogSpecial, err)
+				continue
+			}
+		}
+		for n, i := range inv.Items {
+			if i != best {
+				continue
+			}
+			if err := g.ToggleEquip(actor, n); err != nil {
+				g.Logf("%v", ColorLogSpecial, err)
+				break
+			}
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return errors.New("You already wear your best gear.")
+	}
+	return nil
+}
+
+// WorseGear returns the unequipped items of the actor's inventory that are
+// strictly worse than another item of the same slot: their power and defense
+// bonuses are both lower or equal, and at least one is lower.
+func (g *game) WorseGear(actor int) []int {
+	worse := []int{}
+	items := g.ECS.Inventory[actor].Items
+	for _, i := range items {
+		e, ok := g.ECS.Entities[i].(Equippable)
+		if !ok || g.ECS.Equipped(actor, i) {
+			continue
+		}
+		pi, di := e.Bonuses()
+		for _, j := range items {
+			f, ok := g.ECS.Entities[j].(Equippable)
+			if !ok || i == j || f.Slot() != e.Slot() {
+				continue
+			}
+			pj, dj := f.Bonuses()
+			if pi <= pj && di <= dj && (pi < pj || di < dj) {
+				worse = append(worse, i)
+				break
+			}
+		}
+	}
+	return worse
+}
+
+// DropItems makes the actor drop the given inventory items.
+func (g *game) DropItems(actor int, items []int) error {
+	inv := g.ECS.Inventory[actor]
+	for _, i := range items {
+		for n, j := range inv.Items {
+			if i != j {
+				continue
+			}
+			if err := g.InventoryRemove(actor, n); err != nil {
+				return err
+			}
+			g.Logf("You drop the %v.", ColorLogItemUse, g.ECS.HighlightName(i, g.ECS.GetName(i)))
+			break
+		}
+	}
+	return nil
+}
+
+// OpenDropWorse opens a confirmation menu listing the strictly worse gear in
+// the player's inventory.
+func (m *model) OpenDropWorse() error {
+	worse := m.game.WorseGear(m.game.ECS.PlayerID)
+	if len(worse) == 0 {
+		return errors.New("You have no gear strictly worse than another.")
+	}
+	m.worse = worse
+	lp := listPicker{Title: "Drop worse gear?"}
+	for _, i := range worse {
+		lp.Entries = append(lp.Entries, pickerEntry{Text: "  " + m.game.ECS.GetName(i), Disabled: true})
+	}
+	lp.Entries = append(lp.Entries, pickerEntry{
+		Text: fmt.Sprintf("y - drop these %d items", len(worse)),
+		Keys: []gruid.Key{"y"},
+	})
+	m.inventory = lp.Menu()
+	m.mode = modeDropWorse
+	return nil
+}
+
+// updateDropWorse handles input messages when the worse gear confirmation
+// menu is open.
+func (m *model) updateDropWorse(msg gruid.Msg) {
+	m.inventory.Update(msg)
+	switch m.inventory.Action() {
+	case ui.MenuQuit:
+		m.mode = modeNormal
+	case ui.MenuInvoke:
+		m.mode = modeNormal
+		if err := m.game.DropItems(m.game.ECS.PlayerID, m.worse); err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+		}
+		m.game.EndTurn()
+	}
+}
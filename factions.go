@@ -0,0 +1,126 @@
+// This file implements factions, which determine which fighters are hostile
+// to each other, and AI target selection.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// faction represents a group of allied fighters.
+type faction int
+
+// These constants represent the available factions.
+const (
+	FactionPlayer faction = iota
+	FactionOrcs           // orcs and trolls
+	FactionBeasts         // wild animals
+	FactionUndead         // necromancers and their zombies
+	FactionTown           // town folk angered by a thief
+)
+
+// HostileTo returns true if faction f is hostile to faction f2. Everyone is
+// hostile to the player, beasts and town folk only hunt the player, and orcs
+// and undead fight each other.
+func (f faction) HostileTo(f2 faction) bool {
+	switch {
+	case f == f2:
+		return false
+	case f == FactionPlayer || f2 == FactionPlayer:
+		return true
+	case f == FactionBeasts || f2 == FactionBeasts, f == FactionTown || f2 == FactionTown:
+		return false
+	}
+	return true
+}
+
+// Hostile returns true if fighter i is hostile to fighter j. Monsters are
+// also hostile to their confused allies, as those may attack them.
+func (es *ECS) Hostile(i, j int) bool {
+	if i == j {
+		return false
+	}
+	fi, fj := es.Faction[i], es.Faction[j]
+	if fi == fj && fi != FactionPlayer {
+		return es.Status(j, StatusConfused)
+	}
+	return fi.HostileTo(fj)
+}
+
+// monsterSight is the maximum distance at which monsters notice other
+// monsters.
+const monsterSight = 8
+
+// AITarget returns the nearest hostile fighter that monster i can see, or -1
+// if there is none. The player is seen when the monster is in the player's
+// field of view.
+func (g *game) AITarget(i int) int {
+	p := g.ECS.Positions[i]
+	target, best := -1, 0
+	for _, j := range g.ECS.Blocks.sortedKeys() {
+		if g.ECS.Fighter[j] == nil || !g.ECS.Hostile(i, j) {
+			continue
+		}
+		q := g.ECS.Positions[j]
+		dist := paths.DistanceManhattan(p, q)
+		if j == g.ECS.PlayerID {
+			if !g.InFOV(p) {
+				continue
+			}
+		} else if dist > monsterSight || !g.LineOfSight(p, q) {
+			continue
+		}
+		if target < 0 || dist < best || dist == best && j == g.ECS.PlayerID {
+			target, best = j, dist
+		}
+	}
+	return target
+}
+
+// LineOfSight returns true if there are only transparent cells on the
+// straight line between p and q (excluding them).
+func (g *game) LineOfSight(p, q gruid.Point) bool {
+	return lineFree(p, q, g.Map.Transparent)
+}
+
+// lineFree returns true if free returns true for all the cells on the
+// straight line between p and q (excluding them), using Bresenham's line
+// algorithm.
+func lineFree(p, q gruid.Point, free func(gruid.Point) bool) bool {
+	dx, dy := abs(q.X-p.X), -abs(q.Y-p.Y)
+	sx, sy := sign(q.X-p.X), sign(q.Y-p.Y)
+	err := dx + dy
+	for r := p; r != q; {
+		if r != p && !free(r) {
+			return false
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			r.X += sx
+		}
+		if e2 <= dx {
+			err += dx
+			r.Y += sy
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
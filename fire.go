@@ -0,0 +1,126 @@
+// This file implements fire: burning fighters lose HP each turn, and fire
+// spreads from them, and from burning grass, to adjacent tall grass and
+// fighters. Fire is started by fireball scrolls and fire traps.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+const (
+	burnTurns    = 4 // duration of the burning status
+	burnDamage   = 2 // damage inflicted each turn to burning fighters
+	spreadChance = 3 // fire spreads to an adjacent target with a 1 in spreadChance chance
+	burnOutOdds  = 3 // burning grass burns out with a 1 in burnOutOdds chance each turn
+)
+
+func init() {
+	// Fire burns after poison, and before regeneration.
+	registerTurnHook(turnHook{Name: "fire", Order: turnEffects + 2, Run: (*game).FireNextTurn})
+}
+
+// Ignite sets fighter i on fire, unless it is already burning or fireproof,
+// and reports it if visible.
+func (g *game) Ignite(i int) {
+	if !g.ECS.Alive(i) || g.ECS.Status(i, StatusBurning) {
+		return
+	}
+	if ai := g.ECS.AI[i]; ai != nil && ai.Fireproof {
+		return
+	}
+	g.ECS.PutStatus(i, StatusBurning, burnTurns)
+	p := g.ECS.Positions[i]
+	switch {
+	case i == g.ECS.PlayerID:
+		g.Logf("You catch fire!", ColorLogMonsterAttack)
+	case g.InFOV(p) && !g.Unseen(i):
+		g.Logf("%v catches fire.", ColorLogAbility, g.ECS.HighlightName(i, g.ECS.GetName(i)))
+	}
+}
+
+// IgniteGrass sets the tall grass at p on fire, if any. It returns true if
+// the grass caught fire.
+func (m *Map) IgniteGrass(p gruid.Point) bool {
+	if m.Grid.At(p) != Foliage {
+		return false
+	}
+	m.Grid.Set(p, BurningGrass)
+	return true
+}
+
+// FireNextTurn makes fire burn for a turn: burning fighters take damage, and
+// fire spreads from burning fighters and grass. Fires started during the turn
+// only spread on the next one. Water puts out the fire of fighters standing
+// in it.
+func (g *game) FireNextTurn() {
+	r := g.Rand(RNGCombat)
+	fires := []gruid.Point{}
+	it := g.Map.Grid.Iterator()
+	for it.Next() {
+		if it.Cell() == BurningGrass {
+			fires = append(fires, it.P())
+		}
+	}
+	burning := []int{}
+	for _, i := range g.ECS.Fighter.sortedKeys() {
+		if !g.ECS.Alive(i) || !g.ECS.Status(i, StatusBurning) {
+			continue
+		}
+		switch g.Map.Grid.At(g.ECS.Positions[i]) {
+		case Pool, DeepWater:
+			delete(g.ECS.Statuses[i], StatusBurning)
+			if i == g.ECS.PlayerID {
+				g.Logf("The water puts out the flames.", ColorLogItemUse)
+			}
+			continue
+		}
+		burning = append(burning, i)
+		fires = append(fires, g.ECS.Positions[i])
+	}
+	// Fire spreads to the grass under or next to a fire, and to the fighters
+	// standing on burning grass or next to a fire.
+	grass := []gruid.Point{}
+	targets := []int{}
+	for _, p := range fires {
+		if g.Map.Grid.At(p) == Foliage {
+			grass = append(grass, p)
+		}
+		for _, q := range [4]gruid.Point{p.Shift(1, 0), p.Shift(-1, 0), p.Shift(0, 1), p.Shift(0, -1)} {
+			if g.Map.Grid.At(q) == Foliage && r.Intn(spreadChance) == 0 {
+				grass = append(grass, q)
+			}
+		}
+		for _, j := range g.ECS.Fighter.sortedKeys() {
+			if !g.ECS.Alive(j) || g.ECS.Status(j, StatusBurning) {
+				continue
+			}
+			switch paths.DistanceManhattan(p, g.ECS.Positions[j]) {
+			case 0:
+				targets = append(targets, j)
+			case 1:
+				if r.Intn(spreadChance) == 0 {
+					targets = append(targets, j)
+				}
+			}
+		}
+	}
+	for _, i := range burning {
+		g.Damage(i, burnDamage)
+		if i == g.ECS.PlayerID {
+			g.Logf("You burn.", ColorLogMonsterAttack)
+		}
+	}
+	for _, p := range fires {
+		if g.Map.Grid.At(p) == BurningGrass && r.Intn(burnOutOdds) == 0 {
+			g.Map.Grid.Set(p, Floor)
+		}
+	}
+	for _, p := range grass {
+		g.Map.IgniteGrass(p)
+	}
+	for _, j := range targets {
+		g.Ignite(j)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/anaseto/gruid"
 	"github.com/anaseto/gruid/paths"
@@ -14,99 +15,526 @@ import (
 
 // game represents information relevant the current game's state.
 type game struct {
-	ECS *ECS             // entities present on the map
-	Map *Map             // the game map, made of tiles
-	PR  *paths.PathRange // path range for the map
-	Log []LogEntry       // log entries
+	ECS     *ECS             // entities present on the map
+	Map     *Map             // the game map, made of tiles
+	PR      *paths.PathRange // path range for the map
+	Log     []LogEntry       // log entries
+	Depth   int              // current dungeon depth (0 is the town)
+	Quests  []*Quest         // quests given to the player
+	Town    *Map             // surface town map, generated only once
+	Stash   Inventory        // items stored in the town stash
+	Options RunOptions       // gameplay options of the run
+
+	Reputation int        // reputation among town folk
+	Thief      bool       // whether the player stole from the shop
+	Objective  *Objective // bonus objective of the current level, if any
+
+	UniquesSpawned map[string]bool // unique monsters already spawned
+	LevelTurns     int             // turns spent on the current level
+	DangerBudget   int             // danger budget for respawning monsters
+	LastTarget     TargetMemory    // last monster targeted by the player
+	Seed           int64           // initial random seed of the run
+	Scenario       *Scenario       // scenario of the run, if any
+	Levels         int             // number of levels generated so far
+	Deepest        int             // deepest dungeon depth reached
+	Won            bool            // whether the amulet was found
+
+	AutoPickupOn map[pickupCategory]bool // auto-pickup settings
+	SeenItems    map[int]bool            // items seen on the ground (auto-travel)
+	Visited      map[gruid.Point]bool    // features visited on the level (auto-travel)
+
+	turnTime time.Duration   // duration of last EndTurn (diagnostics)
+	budget   aiBudget        // AI pathfinding budget of the current turn
+	planned  map[int]pathJob // paths planned concurrently for this turn
+	turns    turnLog         // last turns (bug reports)
 }
 
-// NewGame initializes a new game.
+// SetPlayerName sets the name of the player, unless it is empty.
+func (g *game) SetPlayerName(name string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return
+	}
+	g.ECS.Name[g.ECS.PlayerID] = name
+}
+
+// MaxDepth is the depth of the final level of the dungeon.
+const MaxDepth = 5
+
+// NewGame initializes a new game with a random seed.
 func NewGame() *game {
-	g := &game{}
-	size := gruid.Point{UIWidth, UIHeight}
-	size.Y -= 3 // for log and status
-	g.Map = NewMap(size)
-	g.PR = paths.NewPathRange(gruid.NewRange(0, 0, size.X, size.Y))
+	return NewGameWithSeed(time.Now().UnixNano(), NewRunOptions())
+}
+
+// NewGameWithSeed initializes a new game with the given seed and options.
+// Given the same player actions, games with the same seed play the same.
+func NewGameWithSeed(seed int64, opts RunOptions) *game {
+	return NewScenarioGame(seed, opts, nil)
+}
+
+// NewScenarioGame initializes a new game for the given scenario, or a
+// standard game if sc is nil. A fixed scenario seed overrides the given one.
+func NewScenarioGame(seed int64, opts RunOptions, sc *Scenario) *game {
+	if sc != nil && sc.Seed != 0 {
+		seed = sc.Seed
+	}
+	g := &game{Options: opts, Seed: seed, Scenario: sc}
 	// Initialize entities
 	g.ECS = NewECS()
-	// Initialization: create a player entity centered on the map.
-	g.ECS.PlayerID = g.ECS.AddEntity(NewPlayer(), g.Map.RandomFloor())
+	// Initialization: create a player entity. Its position will be chosen
+	// when initializing the first level.
+	g.ECS.PlayerID = g.ECS.AddEntity(NewPlayer(), gruid.Point{})
+	g.ECS.Blocks[g.ECS.PlayerID] = true
+	g.ECS.Faction[g.ECS.PlayerID] = FactionPlayer
 	g.ECS.Fighter[g.ECS.PlayerID] = &fighter{
 		HP: 30, MaxHP: 30, Power: 5, Defense: 2,
 	}
 	g.ECS.Style[g.ECS.PlayerID] = Style{Rune: '@', Color: ColorPlayer}
 	g.ECS.Name[g.ECS.PlayerID] = "player"
 	g.ECS.Inventory[g.ECS.PlayerID] = &Inventory{}
-	g.UpdateFOV()
-	// Add some monsters
-	g.SpawnMonsters()
-	// Add items
-	g.PlaceItems()
+	if !g.Rule(RuleNoRegeneration) {
+		g.ECS.Regen[g.ECS.PlayerID] = &Regen{Every: 10}
+	}
+	g.ECS.Player().Gold = 30
+	g.InitLevel()
+	if !g.Rule(RuleNoPet) {
+		g.AddPet()
+	}
+	if sc != nil {
+		g.ApplyScenarioKit()
+	}
+	g.AssignQuests()
 	return g
 }
 
+// levelSeed returns the seed for the next generated level.
+func (g *game) levelSeed() int64 {
+	g.Levels++
+	return g.Seed + int64(g.Levels)*1000003
+}
+
+// InitLevel generates a new map for the current depth and populates it. Any
+// entities on the previous map are removed, except for the player, following
+// allies and the items in inventories.
+func (g *game) InitLevel() {
+	size := gruid.Point{UIWidth, UIHeight}
+	size.Y -= 3 // for log and status
+	if g.Depth == 0 {
+		// The town is persistent: it is only generated the first
+		// time. Its random streams are renewed on each visit.
+		if g.Town == nil {
+			g.Town = NewMap(size, 0, g.levelSeed())
+		} else {
+			g.Town.Reseed(g.levelSeed())
+		}
+		g.Map = g.Town
+	} else {
+		g.Map = NewMap(size, g.Depth, g.levelSeed())
+	}
+	g.PR = paths.NewPathRange(gruid.NewRange(0, 0, size.X, size.Y))
+	g.LevelTurns = 0
+	g.DangerBudget = 0
+	g.SeenItems = nil
+	g.Visited = nil
+	allies := g.FollowingAllies()
+	following := map[int]bool{}
+	for _, i := range allies {
+		following[i] = true
+	}
+	for i := range g.ECS.Positions {
+		if i != g.ECS.PlayerID && !following[i] {
+			g.ECS.RemoveEntity(i)
+		}
+	}
+	if g.Depth == 0 {
+		g.ECS.MovePlayer(g.Map.StartPosition())
+		g.UpdateFOV()
+		g.PlaceTownNPCs()
+		g.PlaceAllies(allies)
+		return
+	}
+	g.ECS.MovePlayer(g.Map.StartPosition())
+	// The player arrives by stairs leading back to the town.
+	g.Map.Grid.Set(g.ECS.PP(), Upstairs)
+	g.UpdateFOV()
+	g.PlacePrefabEntities()
+	g.PlaceAllies(allies)
+	if g.Map.Special == "" {
+		// Add some monsters
+		g.SpawnMonsters()
+		// Add items
+		g.PlaceItems()
+	}
+	g.SpawnUniques()
+	if g.Depth == MaxDepth {
+		g.PlaceBossArena()
+	}
+	g.PlaceQuestItems()
+	g.NewObjective()
+}
+
+// Descend makes the player go down the stairs into a new level, if the player
+// is standing on stairs. From the town, the player goes back to the deepest
+// depth reached so far.
+func (g *game) Descend() error {
+	if g.Map.Grid.At(g.ECS.PP()) != Downstairs {
+		return errors.New("There are no stairs here.")
+	}
+	g.ReportObjective()
+	g.FailLeftQuests()
+	from := g.Depth
+	if from == 0 && g.Deepest > 0 {
+		g.Depth = g.Deepest
+	} else {
+		g.Depth++
+	}
+	if g.Depth > g.Deepest {
+		g.Deepest = g.Depth
+	}
+	g.InitLevel()
+	switch {
+	case g.Depth == 1:
+		g.Logf("You enter the dungeon.", ColorLogSpecial)
+	case from == 0:
+		g.Logf("You go back down to depth %d.", ColorLogSpecial, g.Depth)
+	default:
+		g.Logf("You descend to depth %d.", ColorLogSpecial, g.Depth)
+	}
+	if intro := g.Map.SpecialIntro(); intro != "" {
+		g.Logf("%s", ColorLogSpecial, intro)
+	}
+	for _, name := range g.UniquesHere() {
+		g.Logf("You sense the presence of %s.", ColorLogSpecial, Highlight(MarkupMonster, name))
+	}
+	if g.Objective != nil {
+		g.Logf("Bonus objective: %s.", ColorLogSpecial, g.Objective.Description())
+	}
+	if g.Depth == MaxDepth {
+		g.Logf("You feel a powerful presence on this level.", ColorLogSpecial)
+	}
+	return nil
+}
+
+// Ascend makes the player climb the stairs back to the town, if the player is
+// standing on stairs up.
+func (g *game) Ascend() error {
+	if g.Map.Grid.At(g.ECS.PP()) != Upstairs {
+		return errors.New("There are no stairs up here.")
+	}
+	g.ReportObjective()
+	g.FailLeftQuests()
+	g.Depth = 0
+	g.InitLevel()
+	g.Logf("You climb back to the town.", ColorLogSpecial)
+	return nil
+}
+
+// PlaceBossArena places the boss and the amulet on the spots marked in the
+// boss arena prefab of the final level.
+func (g *game) PlaceBossArena() {
+	for _, p := range g.Map.Placements[PlaceBoss] {
+		if !g.ECS.NoBlockingEntityAt(p) {
+			continue
+		}
+		g.AddMonster(MonsterOrcWarlord, p)
+	}
+	for _, p := range g.Map.Placements[PlaceAmulet] {
+		g.ECS.AddItem(&Amulet{}, p, "amulet of the depths", '♀')
+	}
+}
+
 // SpawnMonsters adds some monsters in the current map.
 func (g *game) SpawnMonsters() {
 	const numberOfMonsters = 12
+	cands := g.SpawnCandidates()
 	for i := 0; i < numberOfMonsters; i++ {
-		m := &Monster{}
-		// We generate either an orc or a troll with 0.8 and 0.2
-		// probabilities respectively.
-		const (
-			orc = iota
-			troll
-		)
-		kind := orc
-		switch {
-		case g.Map.rand.Intn(100) < 80:
+		// We generate either an orc, an orc archer, a wolf, a bat or a
+		// troll with 0.57, 0.08, 0.12, 0.06 and 0.17 probabilities
+		// respectively. From depth 2, most trolls are replaced by
+		// necromancers, slimes or giant spiders, and from depth 3 by
+		// ghosts too.
+		kind := MonsterOrc
+		switch r := g.Rand(RNGMapgen).Intn(100); {
+		case r < 57:
+		case r < 65:
+			kind = MonsterOrcArcher
+		case r < 77:
+			kind = MonsterWolf
+		case r < 83:
+			kind = MonsterBat
+		case r >= 96 && g.Depth >= 2:
+			kind = MonsterNecromancer
+		case r >= 92 && g.Depth >= 2:
+			kind = MonsterSlime
+		case r >= 88 && g.Depth >= 2:
+			kind = MonsterSpider
+		case r >= 85 && g.Depth >= 3:
+			kind = MonsterGhost
 		default:
-			kind = troll
-		}
-		p := g.FreeFloorTile()
-		i := g.ECS.AddEntity(m, p)
-		switch kind {
-		case orc:
-			g.ECS.Fighter[i] = &fighter{
-				HP: 10, MaxHP: 10, Defense: 0, Power: 3,
-			}
-			g.ECS.Name[i] = "orc"
-			g.ECS.Style[i] = Style{Rune: 'o', Color: ColorMonster}
-		case troll:
-			g.ECS.Fighter[i] = &fighter{
-				HP: 16, MaxHP: 16, Defense: 1, Power: 4,
+			kind = MonsterTroll
+		}
+		g.AddMonster(kind, g.MonsterSpawnTile(cands))
+	}
+}
+
+// monsterKind represents a kind of monster.
+type monsterKind int
+
+// These constants represent the available kinds of monsters.
+const (
+	MonsterOrc monsterKind = iota
+	MonsterWolf
+	MonsterTroll
+	MonsterNecromancer
+	MonsterOrcChieftain
+	MonsterOrcWarlord
+	MonsterBat
+	MonsterSlime
+	MonsterOrcArcher
+	MonsterSpider
+	MonsterGhost
+	MonsterShopkeeper // angry shopkeeper, after a theft
+	MonsterTownGuard
+)
+
+// AddMonster adds a new monster of the given kind at p, and returns its id.
+func (g *game) AddMonster(kind monsterKind, p gruid.Point) int {
+	i := g.ECS.AddEntity(&Monster{}, p)
+	g.ECS.Blocks[i] = true
+	switch kind {
+	case MonsterOrc:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 10, MaxHP: 10, Defense: 0, Power: 3,
+		}
+		g.ECS.Name[i] = "orc"
+		g.ECS.Style[i] = Style{Rune: 'o', Color: ColorMonster}
+	case MonsterWolf:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 6, MaxHP: 6, Defense: 0, Power: 3,
+		}
+		g.ECS.Name[i] = "wolf"
+		g.ECS.Style[i] = Style{Rune: 'w', Color: ColorMonster}
+		g.ECS.Abilities[i] = Abilities{{Kind: AbilityRend, Cooldown: 5}}
+	case MonsterTroll:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 16, MaxHP: 16, Defense: 1, Power: 4,
+		}
+		g.ECS.Name[i] = "troll"
+		g.ECS.Style[i] = Style{Rune: 'T', Color: ColorMonster}
+		g.ECS.Regen[i] = &Regen{Every: 3}
+		g.ECS.Abilities[i] = Abilities{{Kind: AbilityCharge, Cooldown: 6}}
+	case MonsterNecromancer:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 8, MaxHP: 8, Defense: 0, Power: 2,
+		}
+		g.ECS.Name[i] = "necromancer"
+		g.ECS.Style[i] = Style{Rune: 'n', Color: ColorMonster}
+		g.ECS.Abilities[i] = Abilities{{Kind: AbilityBlink, Cooldown: 10}}
+	case MonsterOrcChieftain:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 24, MaxHP: 24, Defense: 2, Power: 5,
+		}
+		g.ECS.Name[i] = "orc chieftain"
+		g.ECS.Style[i] = Style{Rune: 'O', Color: ColorMonster}
+	case MonsterOrcWarlord:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 40, MaxHP: 40, Defense: 3, Power: 8,
+		}
+		g.ECS.Name[i] = "orc warlord"
+		g.ECS.Style[i] = Style{Rune: 'O', Color: ColorMonster}
+	case MonsterBat:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 4, MaxHP: 4, Defense: 0, Power: 2,
+		}
+		g.ECS.Name[i] = "bat"
+		g.ECS.Style[i] = Style{Rune: 'b', Color: ColorMonster}
+		g.ECS.Speeds[i] = 2 * normalSpeed
+	case MonsterSlime:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 5, MaxHP: 5, Defense: 0, Power: 2,
+		}
+		g.ECS.Name[i] = "slime"
+		g.ECS.Style[i] = Style{Rune: 's', Color: ColorMonster}
+		g.ECS.OnDeath[i] = DeathEffects{{Kind: DeathSplit}}
+	case MonsterOrcArcher:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 7, MaxHP: 7, Defense: 0, Power: 3,
+		}
+		g.ECS.Name[i] = "orc archer"
+		g.ECS.Style[i] = Style{Rune: 'a', Color: ColorMonster}
+	case MonsterSpider:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 8, MaxHP: 8, Defense: 1, Power: 3,
+		}
+		g.ECS.Name[i] = "giant spider"
+		g.ECS.Style[i] = Style{Rune: 'S', Color: ColorMonster}
+		g.ECS.Abilities[i] = Abilities{
+			{Kind: AbilityPoisonBite, Cooldown: 4},
+			{Kind: AbilityWeb, Cooldown: 8},
+		}
+	case MonsterGhost:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 6, MaxHP: 6, Defense: 1, Power: 3,
+		}
+		g.ECS.Name[i] = "ghost"
+		g.ECS.Style[i] = Style{Rune: 'G', Color: ColorMonster}
+		g.ECS.Abilities[i] = Abilities{{Kind: AbilityParalyze, Cooldown: 8}}
+	case MonsterShopkeeper:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 20, MaxHP: 20, Defense: 2, Power: 5,
+		}
+		g.ECS.Name[i] = "shopkeeper"
+		g.ECS.Style[i] = Style{Rune: 'S', Color: ColorMonster}
+	case MonsterTownGuard:
+		g.ECS.Fighter[i] = &fighter{
+			HP: 15, MaxHP: 15, Defense: 2, Power: 4,
+		}
+		g.ECS.Name[i] = "town guard"
+		g.ECS.Style[i] = Style{Rune: 'g', Color: ColorMonster}
+	}
+	g.ECS.AI[i] = &AI{
+		Animal:      kind == MonsterWolf,
+		Necromancer: kind == MonsterNecromancer,
+		Breeds:      kind == MonsterSlime,
+		Undead:      kind == MonsterGhost,
+		Invisible:   kind == MonsterGhost,
+		Fireproof:   kind == MonsterGhost,
+	}
+	if kind == MonsterOrcArcher {
+		g.ECS.AI[i].Range = archerRange
+	}
+	g.ECS.Drops[i] = dropTables[kind]
+	switch kind {
+	case MonsterWolf, MonsterBat, MonsterSlime, MonsterSpider:
+		g.ECS.Faction[i] = FactionBeasts
+	case MonsterNecromancer, MonsterGhost:
+		g.ECS.Faction[i] = FactionUndead
+	case MonsterShopkeeper, MonsterTownGuard:
+		g.ECS.Faction[i] = FactionTown
+	default:
+		g.ECS.Faction[i] = FactionOrcs
+	}
+	return i
+}
+
+// SpawnCandidates returns the plain floor positions reachable from the
+// player's position, along with their path distance from it, in increasing
+// distance order.
+func (g *game) SpawnCandidates() []paths.Node {
+	pp := g.ECS.PP()
+	size := g.Map.Grid.Size()
+	nodes := g.PR.BreadthFirstMap(&path{m: g.Map}, []gruid.Point{pp}, size.X*size.Y)
+	cands := []paths.Node{}
+	for _, n := range nodes {
+		if n.P != pp && g.Map.Grid.At(n.P) == Floor {
+			cands = append(cands, n)
+		}
+	}
+	return cands
+}
+
+// MonsterSpawnTile returns a random free floor tile among candidates that are
+// far enough from the player, so that monsters do not start adjacent to the
+// player. It falls back to any free floor tile if there is none.
+func (g *game) MonsterSpawnTile(cands []paths.Node) gruid.Point {
+	const minSpawnDistance = maxLOS + 2
+	far := []gruid.Point{}
+	for _, n := range cands {
+		if n.Cost >= minSpawnDistance && g.ECS.NoBlockingEntityAt(n.P) {
+			far = append(far, n.P)
+		}
+	}
+	if len(far) == 0 {
+		return g.FreeFloorTile(RNGMapgen)
+	}
+	return far[g.Rand(RNGMapgen).Intn(len(far))]
+}
+
+// ItemSpawnTile returns a floor tile among candidates for a new item. A few
+// random candidates are drawn, and the one farthest from already placed items
+// is chosen, so that items are scattered evenly on the map.
+func (g *game) ItemSpawnTile(cands []paths.Node, placed []gruid.Point) gruid.Point {
+	const samples = 10
+	if len(cands) == 0 {
+		return g.FreeFloorTile(RNGMapgen)
+	}
+	best := cands[g.Rand(RNGMapgen).Intn(len(cands))].P
+	bestDist := -1
+	for i := 0; i < samples; i++ {
+		p := cands[g.Rand(RNGMapgen).Intn(len(cands))].P
+		if !g.ECS.NoBlockingEntityAt(p) {
+			continue
+		}
+		dist := MapWidth + MapHeight
+		for _, q := range placed {
+			if d := paths.DistanceManhattan(p, q); d < dist {
+				dist = d
 			}
-			g.ECS.Name[i] = "troll"
-			g.ECS.Style[i] = Style{Rune: 'T', Color: ColorMonster}
 		}
-		g.ECS.AI[i] = &AI{}
+		if dist > bestDist {
+			best = p
+			bestDist = dist
+		}
 	}
+	return best
 }
 
-// FreeFloorTile returns a free floor tile in the map (it assumes it exists).
-func (g *game) FreeFloorTile() gruid.Point {
+// FreeFloorTile returns a free floor tile in the map (it assumes it exists),
+// drawn from random stream s.
+func (g *game) FreeFloorTile(s rngStream) gruid.Point {
 	for {
-		p := g.Map.RandomFloor()
+		p := g.Map.randomFloor(g.Rand(s))
 		if g.ECS.NoBlockingEntityAt(p) {
 			return p
 		}
 	}
 }
 
-// EndTurn is called when the player's turn ends. Currently, the player and
-// monsters have all the same speed, so we make each monster act each time the
-// player's does an action that ends a turn.
+// EndTurn is called when the player's turn ends. It runs the registered turn
+// hooks, which, among other things, make monsters act for the duration of the
+// player's action (see turnhooks.go).
+//
+// A paralyzed player cannot act: the following turns are then ended
+// automatically, until the paralysis wears off or the player dies.
 func (g *game) EndTurn() {
-	g.UpdateFOV()
-	for i, e := range g.ECS.Entities {
-		if g.ECS.PlayerDied() {
-			return
+	g.endTurn()
+	for g.ECS.Status(g.ECS.PlayerID, StatusParalyzed) && !g.ECS.PlayerDied() {
+		g.Logf("You are paralyzed and cannot move!", ColorLogMonsterAttack)
+		g.endTurn()
+	}
+}
+
+// endTurn ends a single turn.
+func (g *game) endTurn() {
+	defer g.timeEndTurn(time.Now())
+	defer g.recordTurn()
+	g.runTurnHooks()
+}
+
+func init() {
+	registerTurnHook(turnHook{Name: "fov", Order: turnStart + 1, Run: (*game).UpdateFOV})
+	registerTurnHook(turnHook{Name: "regen", Order: turnEffects + 1, Run: (*game).RegenNextTurn})
+}
+
+// RegenNextTurn makes fighters with natural regeneration regain HP. Poisoned
+// fighters do not regenerate naturally, nor thanks to a ring of regeneration,
+// which heals one HP every ringRegenEvery turns. Fighters under the
+// regenerating status heal one HP each turn.
+func (g *game) RegenNextTurn() {
+	for i, r := range g.ECS.Regen {
+		if !g.ECS.Alive(i) || g.ECS.Status(i, StatusPoisoned) {
+			continue
 		}
-		switch e.(type) {
-		case *Monster:
-			g.HandleMonsterTurn(i)
+		r.NextTurn(g.ECS.Fighter[i])
+	}
+	for i := range g.ECS.Fighter {
+		if g.ECS.Alive(i) && g.ECS.Status(i, StatusRegenerating) {
+			g.ECS.Fighter[i].Heal(1)
+		}
+		if g.ECS.Alive(i) && !g.ECS.Status(i, StatusPoisoned) {
+			g.RingRegenNextTurn(i)
 		}
 	}
-	g.ECS.StatusesNextTurn()
 }
 
 // UpdateFOV updates the field of view.
@@ -121,16 +549,17 @@ func (g *game) UpdateFOV() {
 	// We mark cells in field of view as explored. We use the symmetric
 	// shadow casting algorithm provided by the rl package.
 	passable := func(p gruid.Point) bool {
-		return g.Map.Grid.At(p) != Wall
+		return g.Map.Transparent(p)
 	}
 	for _, p := range player.FOV.SSCVisionMap(pp, maxLOS, passable, false) {
-		if paths.DistanceManhattan(p, pp) > maxLOS {
+		if !g.inSight(pp, p) {
 			continue
 		}
 		if !g.Map.Explored[p] {
 			g.Map.Explored[p] = true
 		}
 	}
+	g.NoteFeatures()
 }
 
 // InFOV returns true if p is in the player's field of view. We only keep cells
@@ -139,62 +568,205 @@ func (g *game) UpdateFOV() {
 // would be the Chebyshev one.
 func (g *game) InFOV(p gruid.Point) bool {
 	pp := g.ECS.PP()
-	return g.ECS.Player().FOV.Visible(p) &&
-		paths.DistanceManhattan(pp, p) <= maxLOS
+	return g.ECS.Player().FOV.Visible(p) && g.inSight(pp, p)
+}
+
+// darkLOS is the maximum distance at which cells in dark zones can be seen.
+const darkLOS = 2
+
+// inSight returns true if a cell at p in line of sight from pp is close
+// enough to be seen. Cells in dark zones can only be seen from nearby.
+func (g *game) inSight(pp, p gruid.Point) bool {
+	dist := paths.DistanceManhattan(pp, p)
+	if g.Map.Dark[p] {
+		return dist <= darkLOS
+	}
+	return dist <= maxLOS
 }
 
 // BumpAttack implements attack of a fighter entity on another.
 func (g *game) BumpAttack(i, j int) {
-	fi := g.ECS.Fighter[i]
-	fj := g.ECS.Fighter[j]
-	damage := fi.Power - fj.Defense
-	attackDesc := fmt.Sprintf("%s attacks %s", strings.Title(g.ECS.Name[i]), g.ECS.Name[j])
+	if _, ok := g.ECS.Equipment[i][SlotOffhand]; ok {
+		g.DualAttack(i, j)
+		return
+	}
+	power := g.ECS.Power(i)
+	damage := g.AttackWith(i, j, "attacks", power)
+	g.WeaponStrike(i, j, SlotWeapon, power, damage)
+}
+
+// Attack implements an attack of a fighter entity on another, described in
+// the log with the given verb.
+func (g *game) Attack(i, j int, verb string) {
+	g.AttackWith(i, j, verb, g.ECS.Power(i))
+}
+
+// AttackWith implements an attack of a fighter entity on another with the
+// given attack power. It returns the damage dealt.
+func (g *game) AttackWith(i, j int, verb string, power int) int {
+	damage := power - g.ECS.Defense(j)
+	// Fights between monsters are only reported if the player can see
+	// them.
+	seen := i == g.ECS.PlayerID || j == g.ECS.PlayerID ||
+		g.InFOV(g.ECS.Positions[i]) || g.InFOV(g.ECS.Positions[j])
+	attacker := g.ECS.HighlightName(i, strings.Title(g.ECS.Name[i]))
+	defender := g.ECS.HighlightName(j, g.ECS.Name[j])
 	color := ColorLogMonsterAttack
 	if i == g.ECS.PlayerID {
 		color = ColorLogPlayerAttack
 	}
 	if damage > 0 {
-		g.Logf("%s for %d damage", color, attackDesc, damage)
-		fj.HP -= damage
-	} else {
-		g.Logf("%s but does no damage", color, attackDesc)
+		// Critical hits deal one more damage and make the defender
+		// bleed.
+		crit := g.CriticalHit()
+		if crit {
+			damage++
+		}
+		if seen && crit {
+			g.Logf("%v %s %v for %s damage (critical hit)", color, attacker, verb, defender, Highlight(MarkupDamage, damage))
+		} else if seen {
+			g.Logf("%v %s %v for %s damage", color, attacker, verb, defender, Highlight(MarkupDamage, damage))
+		}
+		g.Damage(j, damage)
+		if crit {
+			g.Wound(j)
+		}
+		return damage
+	}
+	if seen {
+		g.Logf("%v %s %v but does no damage", color, attacker, verb, defender)
+	}
+	return 0
+}
+
+// Damage inflicts an amount of damage to a fighter entity, handling the
+// consequences of its death, if any.
+func (g *game) Damage(i, damage int) {
+	fi := g.ECS.Fighter[i]
+	if fi == nil || fi.HP <= 0 {
+		return
+	}
+	fi.HP -= damage
+	if fi.HP <= 0 {
+		g.Kill(i)
 	}
 }
 
-// PlaceItems adds items in the current map.
+// PlaceItems adds items in the current map. The number of items is given by
+// the loot table of the depth.
 func (g *game) PlaceItems() {
-	const numberOfItems = 5
+	numberOfItems := 0
+	if t := loot.Table(g.Depth); t != nil {
+		numberOfItems = t.Count
+	}
+	cands := g.SpawnCandidates()
+	placed := []gruid.Point{}
 	for i := 0; i < numberOfItems; i++ {
-		p := g.FreeFloorTile()
-		r := g.Map.rand.Float64()
-		switch {
-		case r < 0.7:
-			g.ECS.AddItem(&HealingPotion{Amount: 4}, p, "health potion", '!')
-		case r < 0.8:
-			g.ECS.AddItem(&ConfusionScroll{Turns: 10}, p, "confusion scroll", '?')
-		case r < 0.9:
-			g.ECS.AddItem(&FireballScroll{Damage: 12, Radius: 3}, p, "fireball scroll", '?')
-		default:
-			g.ECS.AddItem(&LightningScroll{Range: 5, Damage: 20},
-				p, "lightning scroll", '?')
+		p := g.ItemSpawnTile(cands, placed)
+		placed = append(placed, p)
+		g.PlaceRandomItem(p)
+	}
+	// Some treasure, more valuable deeper in the dungeon.
+	const numberOfTreasures = 3
+	for i := 0; i < numberOfTreasures; i++ {
+		p := g.ItemSpawnTile(cands, placed)
+		placed = append(placed, p)
+		g.AddGold(5*g.Depth+g.Rand(RNGLoot).Intn(10*g.Depth+1), p)
+	}
+}
+
+// PlaceRandomItem adds a random item from the loot table of the current depth
+// at p and returns its id.
+func (g *game) PlaceRandomItem(p gruid.Point) int {
+	var id int
+	name := g.RandomLoot()
+	if name == lootEquipment {
+		id = g.PlaceEquipment(p)
+	} else {
+		id, _ = g.AddNamedItem(name, p)
+	}
+	g.ECS.BUC[id] = &BUC{Blessing: g.RandomBlessing()}
+	return id
+}
+
+// PlaceEquipment adds a random piece of equipment suitable for the current
+// depth at p and returns its id.
+func (g *game) PlaceEquipment(p gruid.Point) int {
+	// Monsters killed in town (depth 0) drop equipment of the first
+	// level.
+	depth := g.Depth
+	if depth < 1 {
+		depth = 1
+	}
+	kinds := []equipKind{}
+	for _, ek := range equipKinds {
+		if ek.MinDepth <= depth {
+			kinds = append(kinds, ek)
 		}
 	}
+	ek := kinds[g.Rand(RNGLoot).Intn(len(kinds))]
+	// Deeper levels sometimes provide enchanted equipment.
+	bonus := 0
+	if g.Depth > 1 && g.Rand(RNGLoot).Intn(3) == 0 {
+		bonus = 1 + g.Rand(RNGLoot).Intn(g.Depth/2+1)
+	}
+	id := g.AddEquipment(ek, bonus, p)
+	g.RandomWeaponProperty(id, ek)
+	return id
+}
+
+// AddEquipment adds a piece of equipment of the given kind and enchantment
+// bonus at p, and returns its id.
+func (g *game) AddEquipment(ek equipKind, bonus int, p gruid.Point) int {
+	name := ek.Name
+	if bonus > 0 {
+		name = fmt.Sprintf("+%d %s", bonus, name)
+	}
+	var e Entity
+	switch ek.Slot {
+	case SlotWeapon:
+		e = &Weapon{Power: ek.Bonus + bonus, TwoHanded: ek.TwoHanded}
+	case SlotArmor:
+		e = &Armor{Defense: ek.Bonus + bonus}
+	case SlotRanged:
+		e = &Bow{Power: ek.Bonus + bonus, Range: bowRange}
+	default:
+		e = &Shield{Defense: ek.Bonus + bonus}
+	}
+	return g.ECS.AddItem(e, p, name, ek.Slot.Rune())
+}
+
+// RandomBlessing returns a random blessing state for a new item: most items
+// are uncursed.
+func (g *game) RandomBlessing() blessing {
+	switch r := g.Rand(RNGLoot).Intn(100); {
+	case r < 10:
+		return Blessed
+	case r < 20:
+		return Cursed
+	}
+	return Uncursed
 }
 
 const ErrNoShow = "ErrNoShow"
 
+// maxInventorySize is the maximum number of items in an inventory.
+const maxInventorySize = 26
+
 // IventoryAdd adds an item to the player's inventory, if there is room. It
 // returns an error if the item could not be added.
 func (g *game) InventoryAdd(actor, i int) error {
-	const maxSize = 26
 	switch g.ECS.Entities[i].(type) {
-	case Consumable:
+	case Consumable, Equippable, *QuestItem, *Arrows:
 		inv := g.ECS.Inventory[actor]
-		if len(inv.Items) >= maxSize {
+		if len(inv.Items) >= maxInventorySize {
 			return errors.New("Inventory is full.")
 		}
 		inv.Items = append(inv.Items, i)
-		delete(g.ECS.Positions, i)
+		g.ECS.RemovePosition(i)
+		if actor == g.ECS.PlayerID {
+			g.UpdateQuests(QuestFetch, g.ECS.Name[i])
+		}
 		return nil
 	}
 	return errors.New(ErrNoShow)
@@ -207,12 +779,39 @@ func (g *game) InventoryRemove(actor, n int) error {
 		return errors.New("Empty slot.")
 	}
 	i := inv.Items[n]
+	if g.ECS.Equipped(actor, i) {
+		if err := g.Unequip(actor, i); err != nil {
+			return err
+		}
+	}
 	inv.Items[n] = inv.Items[len(inv.Items)-1]
 	inv.Items = inv.Items[:len(inv.Items)-1]
-	g.ECS.Positions[i] = g.ECS.PP()
+	g.ECS.MoveEntity(i, g.ECS.PP())
+	if g.Map.Grid.At(g.ECS.PP()) == Altar {
+		g.RevealBlessing(i)
+	}
 	return nil
 }
 
+// RevealBlessing makes the blessing state of an item known to the player,
+// using an altar.
+func (g *game) RevealBlessing(i int) {
+	buc := g.ECS.BUC[i]
+	if buc == nil {
+		return
+	}
+	name := g.ECS.GetName(i)
+	switch buc.Blessing {
+	case Blessed:
+		g.Logf("There is an amber flash as the %s hits the altar.", ColorLogSpecial, name)
+	case Cursed:
+		g.Logf("There is a black flash as the %s hits the altar.", ColorLogSpecial, name)
+	default:
+		g.Logf("The %s lands on the altar.", ColorLogItemUse, name)
+	}
+	buc.Known = true
+}
+
 // InventoryActivate uses a given item from the inventory.
 func (g *game) InventoryActivate(actor, n int) error {
 	return g.InventoryActivateWithTarget(actor, n, nil)
@@ -221,14 +820,32 @@ func (g *game) InventoryActivate(actor, n int) error {
 // InventoryActivateWithTarget uses a given item from the inventory, with
 // an optional target.
 func (g *game) InventoryActivateWithTarget(actor, n int, targ *gruid.Point) error {
+	return g.inventoryActivate(n, itemAction{Actor: actor, Target: targ})
+}
+
+// InventoryActivateOnItem uses a given item from the inventory on another
+// chosen item.
+func (g *game) InventoryActivateOnItem(actor, n, item int) error {
+	return g.inventoryActivate(n, itemAction{Actor: actor, Item: item})
+}
+
+// inventoryActivate uses the n-th item of the actor's inventory, with the
+// given action.
+func (g *game) inventoryActivate(n int, a itemAction) error {
+	actor := a.Actor
 	inv := g.ECS.Inventory[actor]
 	if len(inv.Items) <= n {
 		return errors.New("Empty slot.")
 	}
 	i := inv.Items[n]
 	switch e := g.ECS.Entities[i].(type) {
+	default:
+		return errors.New("You cannot use this item.")
 	case Consumable:
-		err := e.Activate(g, itemAction{Actor: actor, Target: targ})
+		if buc := g.ECS.BUC[i]; buc != nil {
+			a.Blessing = buc.Blessing
+		}
+		err := e.Activate(g, a)
 		if err != nil {
 			return err
 		}
@@ -1,11 +1,15 @@
 module github.com/anaseto/gruid-examples
 
-go 1.15
+go 1.18
 
 require (
 	github.com/anaseto/gruid v0.21.1
 	github.com/anaseto/gruid-sdl v0.1.1
+	github.com/veandco/go-sdl2 v0.4.5
 	golang.org/x/image v0.0.0-20210216034530-4410531fe030
+)
+
+require (
 	golang.org/x/text v0.3.2 // indirect
 )
 
@@ -0,0 +1,61 @@
+// This file implements the context-aware interact key, which performs the
+// relevant action depending on what is around the player: taking stairs, picking up items, talking to NPCs, and so on.
+
+package main
+
+import (
+	"errors"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/rl"
+)
+
+// Interactable is implemented by entities the player can interact with
+// using the interact key. InteractAction returns the action performed when
+// interacting with the entity i.
+type Interactable interface {
+	InteractAction(g *game, i int) action
+}
+
+// InteractAction implements Interactable.InteractAction. Interacting with an
+// NPC is the same as bumping into it.
+func (npc *NPC) InteractAction(g *game, i int) action {
+	return action{Type: ActionBump, Delta: g.ECS.Positions[i].Sub(g.ECS.PP())}
+}
+
+// InteractAction implements Interactable.InteractAction. Interacting with a
+// corpse hacks it to pieces.
+func (c *Corpse) InteractAction(g *game, i int) action {
+	return action{Type: ActionDestroyCorpse}
+}
+
+// tileInteractions maps map cells to the action performed when interacting
+// with them while standing on them.
+var tileInteractions = map[rl.Cell]actionType{
+	Downstairs: ActionDescend,
+	Upstairs:   ActionAscend,
+}
+
+// InteractAction returns the action performed by the interact key in the
+// current context. In order of priority, the player interacts with the
+// terrain under the player, items on the floor, other interactable entities
+// under the player, and then adjacent interactable entities.
+func (g *game) InteractAction() (action, error) {
+	pp := g.ECS.PP()
+	if t, ok := tileInteractions[g.Map.Grid.At(pp)]; ok {
+		return action{Type: t}, nil
+	}
+	for _, i := range g.ECS.EntitiesAt(pp) {
+		if g.ECS.RenderOrder(i) == ROItem {
+			return action{Type: ActionPickup}, nil
+		}
+	}
+	for _, p := range []gruid.Point{pp, pp.Shift(-1, 0), pp.Shift(1, 0), pp.Shift(0, -1), pp.Shift(0, 1)} {
+		for _, i := range g.ECS.EntitiesAt(p) {
+			if it, ok := g.ECS.Entities[i].(Interactable); ok {
+				return it.InteractAction(g, i), nil
+			}
+		}
+	}
+	return action{}, errors.New("There is nothing to interact with here.")
+}
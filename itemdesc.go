@@ -0,0 +1,184 @@
+// This file implements the item examination screen: a description pane with
+// the item's effect, stats and identified status, opened from the inventory
+// or when examining an item on the floor.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// itemDescriptions maps item kind names to a short description of their
+// effect.
+var itemDescriptions = map[string]string{
+	"health potion":             "A red potion that heals wounds when drunk.",
+	"regeneration potion":       "A green potion that heals one HP per turn for a while, and cures poison and bleeding.",
+	"poison potion":             "A murky potion that poisons the drinker. Better thrown at monsters.",
+	"strength potion":           "A golden potion that permanently increases attack power.",
+	"confusion scroll":          "A scroll that confuses a targeted monster, making it stumble around.",
+	"fireball scroll":           "A scroll that makes a fireball explode at a targeted position, setting everything around on fire.",
+	"teleport scroll":           "A scroll that teleports the reader to a random place of the level.",
+	"lightning scroll":          "A scroll that strikes the closest visible enemy with lightning.",
+	"enchant weapon scroll":     "A scroll that permanently improves an equipped weapon or bow.",
+	"enchant armor scroll":      "A scroll that permanently improves an equipped armor or shield.",
+	"ring of regeneration":      "A ring that slowly heals its wearer's wounds, unless poisoned.",
+	"ring of see invisible":     "A ring that reveals invisible monsters, such as ghosts.",
+	"ring of poison resistance": "A ring that protects its wearer from poison damage.",
+	"arrows":                    "Arrows shot with an equipped bow.",
+	"dagger":                    "A short blade, light and quick.",
+	"short sword":               "A reliable sword for close combat.",
+	"battle axe":                "A heavy axe that deals great damage.",
+	"leather armor":             "A light armor made of hardened leather.",
+	"chain mail":                "An armor of interlocking metal rings.",
+	"plate armor":               "A heavy armor of metal plates.",
+	"buckler":                   "A small round shield.",
+	"kite shield":               "A large shield covering most of the body.",
+	"short bow":                 "A small bow for shooting arrows at short range.",
+	"long bow":                  "A tall bow that shoots arrows with great force.",
+	"amulet":                    "The amulet of the depths, goal of your quest.",
+	"gold":                      "Shiny coins, useful in town.",
+}
+
+// itemKindName returns the name under which the description of item i can be
+// found.
+func (g *game) itemKindName(i int) string {
+	switch e := g.ECS.Entities[i].(type) {
+	case *Arrows:
+		return "arrows"
+	case *Weapon:
+		if e.Property != PropNone {
+			return strings.Replace(g.ECS.Name[i], e.Property.String()+" ", "", 1)
+		}
+	case *Amulet:
+		return "amulet"
+	case *Gold:
+		return "gold"
+	}
+	return g.ECS.Name[i]
+}
+
+// itemStats returns the description lines of the stats of item i.
+func (g *game) itemStats(i int) []string {
+	var stats []string
+	switch e := g.ECS.Entities[i].(type) {
+	case *HealingPotion:
+		stats = append(stats, fmt.Sprintf("Heals: %d HP", e.Amount))
+	case *RegenerationPotion:
+		stats = append(stats, fmt.Sprintf("Duration: %d turns", e.Turns))
+	case *PoisonPotion:
+		stats = append(stats, fmt.Sprintf("Duration: %d turns", e.Turns))
+	case *StrengthPotion:
+		stats = append(stats, fmt.Sprintf("Power: +%d", e.Amount))
+	case *ConfusionScroll:
+		stats = append(stats, fmt.Sprintf("Duration: %d turns", e.Turns))
+	case *FireballScroll:
+		stats = append(stats, fmt.Sprintf("Damage: %d", e.Damage), fmt.Sprintf("Radius: %d", e.Radius))
+	case *LightningScroll:
+		stats = append(stats, fmt.Sprintf("Damage: %d", e.Damage), fmt.Sprintf("Range: %d", e.Range))
+	case *Weapon:
+		stats = append(stats, fmt.Sprintf("Power: +%d", e.Power))
+		if e.TwoHanded {
+			stats = append(stats, "Two-handed")
+		}
+		if e.Property != PropNone {
+			stats = append(stats, fmt.Sprintf("Property: %s (%s)", e.Property, e.Property.Description()))
+		}
+	case *Armor:
+		stats = append(stats, fmt.Sprintf("Defense: +%d", e.Defense))
+	case *Shield:
+		stats = append(stats, fmt.Sprintf("Defense: +%d", e.Defense))
+	case *Bow:
+		stats = append(stats, fmt.Sprintf("Power: +%d", e.Power), fmt.Sprintf("Range: %d", e.Range))
+	case *Arrows:
+		stats = append(stats, fmt.Sprintf("Count: %d", e.Count))
+	case *Gold:
+		stats = append(stats, fmt.Sprintf("Amount: %d", e.Amount))
+	case *Ring:
+		stats = append(stats, fmt.Sprintf("Effect: %s", e.Effect), "Slot: ring")
+	}
+	if e, ok := g.ECS.Entities[i].(Equippable); ok {
+		if _, ring := e.(*Ring); !ring {
+			stats = append(stats, fmt.Sprintf("Slot: %s", e.Slot()))
+		}
+	}
+	if e, ok := g.ECS.Entities[i].(Enchantable); ok && e.Enchantment() != 0 {
+		stats = append(stats, fmt.Sprintf("Enchant: %+d", e.Enchantment()))
+	}
+	return stats
+}
+
+// ItemDescription returns the full description of item i: its effect, its
+// stats, and its identified status.
+func (g *game) ItemDescription(i int) string {
+	lines := []string{}
+	if desc, ok := itemDescriptions[g.itemKindName(i)]; ok {
+		lines = append(lines, desc, "")
+	}
+	if stats := g.itemStats(i); len(stats) > 0 {
+		lines = append(lines, stats...)
+		lines = append(lines, "")
+	}
+	if buc := g.ECS.BUC[i]; buc != nil {
+		if buc.Known {
+			lines = append(lines, fmt.Sprintf("It is %s.", buc.Blessing))
+		} else {
+			lines = append(lines, "Its blessing state is unknown: drop it on an altar to find out.")
+		}
+	}
+	if g.ECS.Equipped(g.ECS.PlayerID, i) {
+		lines = append(lines, "You have it equipped.")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// itemDescWidth is the width of the item description pane.
+const itemDescWidth = 38
+
+// OpenItemDescription opens the description pane of item i. The pane is
+// closed with any key, returning to the current mode.
+func (m *model) OpenItemDescription(i int) {
+	m.itemDesc = &ui.Label{
+		Box:     &ui.Box{Title: ui.Text(m.game.ECS.GetName(i))},
+		Content: ui.Text(m.game.ItemDescription(i)).Format(itemDescWidth - 2),
+	}
+	m.descBack = m.mode
+	m.mode = modeItemDescription
+}
+
+// updateItemDescription handles input messages when the item description
+// pane is open.
+func (m *model) updateItemDescription(msg gruid.Msg) {
+	switch msg := msg.(type) {
+	case gruid.MsgKeyDown:
+		m.mode = m.descBack
+	case gruid.MsgMouse:
+		if msg.Action == gruid.MouseMain {
+			m.mode = m.descBack
+		}
+	}
+}
+
+// DrawItemDescription draws the item description pane on the right side of
+// the given grid.
+func (m *model) DrawItemDescription(gd gruid.Grid) {
+	rg := gd.Range()
+	h := m.itemDesc.Content.Size().Y + 2
+	m.itemDesc.Draw(gd.Slice(gruid.NewRange(rg.Max.X-itemDescWidth, 0, rg.Max.X, h)))
+}
+
+// ExaminedItem returns the first visible item at map position p, if any.
+func (g *game) ExaminedItem(p gruid.Point) (int, bool) {
+	if !g.InFOV(p) {
+		return -1, false
+	}
+	for _, i := range g.ECS.EntitiesAt(p) {
+		if g.ECS.RenderOrder(i) == ROItem {
+			return i, true
+		}
+	}
+	return -1, false
+}
@@ -5,11 +5,89 @@ package main
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/anaseto/gruid"
 	"github.com/anaseto/gruid/paths"
 )
 
+// itemKinds maps the names of non-equipment items to functions adding such an
+// item at p and returning its id.
+var itemKinds = map[string]func(g *game, p gruid.Point) int{
+	"health potion": func(g *game, p gruid.Point) int {
+		return g.ECS.AddItem(&HealingPotion{Amount: 4}, p, "health potion", '!')
+	},
+	"regeneration potion": func(g *game, p gruid.Point) int {
+		return g.ECS.AddItem(&RegenerationPotion{Turns: 8}, p, "regeneration potion", '!')
+	},
+	"poison potion": func(g *game, p gruid.Point) int {
+		return g.ECS.AddItem(&PoisonPotion{Turns: 6}, p, "poison potion", '!')
+	},
+	"strength potion": func(g *game, p gruid.Point) int {
+		return g.ECS.AddItem(&StrengthPotion{Amount: 1}, p, "strength potion", '!')
+	},
+	"confusion scroll": func(g *game, p gruid.Point) int {
+		return g.ECS.AddItem(&ConfusionScroll{Turns: 10}, p, "confusion scroll", '?')
+	},
+	"fireball scroll": func(g *game, p gruid.Point) int {
+		return g.ECS.AddItem(&FireballScroll{Damage: 12, Radius: 3}, p, "fireball scroll", '?')
+	},
+	"teleport scroll": func(g *game, p gruid.Point) int {
+		return g.ECS.AddItem(&TeleportScroll{}, p, "teleport scroll", '?')
+	},
+	"lightning scroll": func(g *game, p gruid.Point) int {
+		return g.ECS.AddItem(&LightningScroll{Range: 5, Damage: 20}, p, "lightning scroll", '?')
+	},
+	"enchant weapon scroll": func(g *game, p gruid.Point) int {
+		sc := &EnchantScroll{Slots: []equipSlot{SlotWeapon, SlotOffhand, SlotRanged}, What: "weapon"}
+		return g.ECS.AddItem(sc, p, "enchant weapon scroll", '?')
+	},
+	"enchant armor scroll": func(g *game, p gruid.Point) int {
+		sc := &EnchantScroll{Slots: []equipSlot{SlotArmor, SlotShield}, What: "armor"}
+		return g.ECS.AddItem(sc, p, "enchant armor scroll", '?')
+	},
+	"ring of regeneration": func(g *game, p gruid.Point) int {
+		return g.ECS.AddItem(&Ring{Effect: RingRegeneration, Hand: SlotRingLeft}, p, "ring of regeneration", '○')
+	},
+	"ring of see invisible": func(g *game, p gruid.Point) int {
+		return g.ECS.AddItem(&Ring{Effect: RingSeeInvisible, Hand: SlotRingLeft}, p, "ring of see invisible", '○')
+	},
+	"ring of poison resistance": func(g *game, p gruid.Point) int {
+		return g.ECS.AddItem(&Ring{Effect: RingPoisonResistance, Hand: SlotRingLeft}, p, "ring of poison resistance", '○')
+	},
+	"arrows": func(g *game, p gruid.Point) int {
+		return g.AddArrows(4+g.Rand(RNGLoot).Intn(5), p)
+	},
+}
+
+// isItemName returns true if name is the name of an item kind that can be
+// added with AddNamedItem.
+func isItemName(name string) bool {
+	if _, ok := itemKinds[name]; ok {
+		return true
+	}
+	for _, ek := range equipKinds {
+		if ek.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AddNamedItem adds an item with the given name at p, and returns its id. The
+// name can be any of itemKinds or equipKinds.
+func (g *game) AddNamedItem(name string, p gruid.Point) (int, error) {
+	if fn, ok := itemKinds[name]; ok {
+		return fn(g, p), nil
+	}
+	for _, ek := range equipKinds {
+		if ek.Name == name {
+			return g.AddEquipment(ek, 0, p), nil
+		}
+	}
+	return -1, fmt.Errorf("unknown item: %s", name)
+}
+
 // Consumable describes a consumable item, like a potion.
 type Consumable interface {
 	// Activate makes use of an item using a specific action. It returns
@@ -21,13 +99,24 @@ type Consumable interface {
 // actor does the action, and whether the action has a particular target
 // position.
 type itemAction struct {
-	Actor  int          // entity doing the action
-	Target *gruid.Point // optional target
+	Actor    int          // entity doing the action
+	Target   *gruid.Point // optional target
+	Item     int          // chosen item (for items acting on another)
+	Blessing blessing     // blessing state of the used item
+}
+
+// Amplify returns an amount n adjusted for the blessing state of the used
+// item: blessed items are more effective.
+func (a itemAction) Amplify(n int) int {
+	if a.Blessing == Blessed {
+		return n + n/2
+	}
+	return n
 }
 
 // HealingPotion describes a potion that heals of a given amount.
 type HealingPotion struct {
-	Amount int
+	Amount int `json:"amount"`
 }
 
 func (pt *HealingPotion) Activate(g *game, a itemAction) error {
@@ -36,42 +125,151 @@ func (pt *HealingPotion) Activate(g *game, a itemAction) error {
 		// should not happen in practice
 		return fmt.Errorf("%s cannot use healing potions.", g.ECS.Name[a.Actor])
 	}
-	hp := fi.Heal(pt.Amount)
+	amount := a.Amplify(pt.Amount)
+	if a.Blessing == Cursed {
+		// Cursed potions are less effective.
+		amount /= 2
+	}
+	hp := fi.Heal(amount)
+	// Healing potions also close bleeding wounds.
+	bled := g.StopBleeding(a.Actor)
+	if a.Actor != g.ECS.PlayerID {
+		// Thrown potion.
+		if hp <= 0 && !bled {
+			return g.errSplashNoEffect(a.Actor)
+		}
+		g.logSplash(a.Actor, "%v looks healthier.", ColorLogItemUse)
+		return nil
+	}
+	if bled {
+		g.Logf("Your wounds stop bleeding.", ColorLogItemUse)
+	}
 	if hp <= 0 {
+		if bled {
+			return nil
+		}
 		return errors.New("Your health is already full.")
 	}
-	if a.Actor == g.ECS.PlayerID {
-		g.Logf("You regained %d HP", ColorLogItemUse, hp)
+	g.Logf("You regained %s HP", ColorLogItemUse, Highlight(MarkupDamage, hp))
+	return nil
+}
+
+// StrengthPotion describes a potion that permanently increases attack power.
+type StrengthPotion struct {
+	Amount int `json:"amount"`
+}
+
+func (pt *StrengthPotion) Activate(g *game, a itemAction) error {
+	fi := g.ECS.Fighter[a.Actor]
+	if fi == nil {
+		return fmt.Errorf("%s cannot use strength potions.", g.ECS.Name[a.Actor])
+	}
+	if a.Blessing == Cursed {
+		// Cursed potions have no lasting effect.
+		if a.Actor != g.ECS.PlayerID {
+			return g.errSplashNoEffect(a.Actor)
+		}
+		g.Logf("You feel strong for a moment, but it passes (cursed potion).", ColorLogSpecial)
+		return nil
+	}
+	amount := a.Amplify(pt.Amount)
+	fi.Power += amount
+	if a.Actor != g.ECS.PlayerID {
+		g.logSplash(a.Actor, "%v looks stronger.", ColorLogMonsterAttack)
+		return nil
 	}
+	g.Logf("You feel stronger! Your power increases by %d.", ColorLogItemUse, amount)
+	return nil
+}
+
+// PoisonPotion describes a potion that poisons the drinker for a number of
+// turns.
+type PoisonPotion struct {
+	Turns int `json:"turns"`
+}
+
+func (pt *PoisonPotion) Activate(g *game, a itemAction) error {
+	turns := pt.Turns
+	if a.Blessing == Blessed {
+		// Blessed poison is diluted.
+		turns /= 2
+	}
+	g.ECS.PutStatus(a.Actor, StatusPoisoned, turns)
+	if a.Actor != g.ECS.PlayerID {
+		g.logSplash(a.Actor, "%v looks very sick.", ColorLogPlayerAttack)
+		return nil
+	}
+	g.Logf("You feel very sick.", ColorLogMonsterAttack)
+	return nil
+}
+
+// RegenerationPotion describes a potion that heals one HP per turn for a
+// number of turns.
+type RegenerationPotion struct {
+	Turns int `json:"turns"`
+}
+
+func (pt *RegenerationPotion) Activate(g *game, a itemAction) error {
+	turns := a.Amplify(pt.Turns)
+	if a.Blessing == Cursed {
+		turns /= 2
+	}
+	g.ECS.PutStatus(a.Actor, StatusRegenerating, turns)
+	// Regeneration cures poison and bleeding.
+	delete(g.ECS.Statuses[a.Actor], StatusPoisoned)
+	g.StopBleeding(a.Actor)
+	if a.Actor != g.ECS.PlayerID {
+		g.logSplash(a.Actor, "The wounds of %v start knitting together.", ColorLogItemUse)
+		return nil
+	}
+	g.Logf("You feel your wounds knitting together.", ColorLogItemUse)
 	return nil
 }
 
 // LightningScroll is an item that can be invoked to strike the closest enemy
 // within a particular range.
 type LightningScroll struct {
-	Range  int
-	Damage int
+	Range  int `json:"range"`
+	Damage int `json:"damage"`
 }
 
 func (sc *LightningScroll) Activate(g *game, a itemAction) error {
-	target := -1
+	if a.Blessing == Cursed {
+		// Cursed scrolls backfire: the lightning strikes the reader.
+		g.Logf("A lightning bolt strikes %v (cursed scroll).", ColorLogSpecial, g.ECS.HighlightName(a.Actor, g.ECS.GetName(a.Actor)))
+		g.Damage(a.Actor, sc.Damage/2)
+		return nil
+	}
+	target, blocked := -1, -1
 	minDist := sc.Range + 1
-	for i := range g.ECS.Fighter {
+	from := g.ECS.Positions[a.Actor]
+	for _, i := range g.ECS.Fighter.sortedKeys() {
 		p := g.ECS.Positions[i]
-		if i == a.Actor || g.ECS.Dead(i) || !g.InFOV(p) {
+		if i == a.Actor || g.ECS.Dead(i) || !g.InFOV(p) || g.Unseen(i) || !g.ECS.Hostile(a.Actor, i) {
 			continue
 		}
-		dist := paths.DistanceManhattan(p, g.ECS.Positions[a.Actor])
-		if dist < minDist {
-			target = i
-			minDist = dist
+		dist := paths.DistanceManhattan(p, from)
+		if dist >= minDist {
+			continue
 		}
+		if _, ok := g.WallBetween(from, p); ok {
+			// Seen around a corner, but out of reach of the bolt.
+			if blocked < 0 {
+				blocked = i
+			}
+			continue
+		}
+		target = i
+		minDist = dist
+	}
+	if target < 0 && blocked >= 0 {
+		return fmt.Errorf("A wall blocks the path to %s.", g.ECS.GetName(blocked))
 	}
 	if target < 0 {
 		return errors.New("No enemy within range.")
 	}
-	g.Logf("A lightning bolt strikes %v.", ColorLogItemUse, g.ECS.GetName(target))
-	g.ECS.Fighter[target].HP -= sc.Damage
+	g.Logf("A lightning bolt strikes %v.", ColorLogItemUse, g.ECS.HighlightName(target, g.ECS.GetName(target)))
+	g.Damage(target, a.Amplify(sc.Damage))
 	return nil
 }
 
@@ -85,7 +283,7 @@ type Targetter interface {
 
 // ConfusionScroll is an item that can be invoked to confuse an enemy.
 type ConfusionScroll struct {
-	Turns int
+	Turns int `json:"turns"`
 }
 
 func (sc *ConfusionScroll) Activate(g *game, a itemAction) error {
@@ -103,8 +301,14 @@ func (sc *ConfusionScroll) Activate(g *game, a itemAction) error {
 	if i <= 0 || !g.ECS.Alive(i) {
 		return errors.New("You have to target a monster.")
 	}
-	g.Logf("%s looks confused (scroll).", ColorLogPlayerAttack, g.ECS.GetName(i))
-	g.ECS.PutStatus(i, StatusConfused, sc.Turns)
+	if a.Blessing == Cursed {
+		// Cursed scrolls backfire: the reader gets confused.
+		g.Logf("You feel confused (cursed scroll).", ColorLogSpecial)
+		g.ECS.PutStatus(a.Actor, StatusConfused, sc.Turns)
+		return nil
+	}
+	g.Logf("%s looks confused (scroll).", ColorLogPlayerAttack, g.ECS.HighlightName(i, g.ECS.GetName(i)))
+	g.ECS.PutStatus(i, StatusConfused, a.Amplify(sc.Turns))
 	return nil
 }
 
@@ -113,8 +317,8 @@ func (sc *ConfusionScroll) TargetingRadius() int { return 0 }
 // FireballScroll is an item that can be invoked to produce a flame explosion
 // in an area around a target position.
 type FireballScroll struct {
-	Damage int
-	Radius int
+	Damage int `json:"damage"`
+	Radius int `json:"radius"`
 }
 
 func (sc *FireballScroll) Activate(g *game, a itemAction) error {
@@ -125,23 +329,49 @@ func (sc *FireballScroll) Activate(g *game, a itemAction) error {
 	if !g.InFOV(p) {
 		return errors.New("You cannot target what you cannot see.")
 	}
+	if a.Blessing == Cursed {
+		// Cursed scrolls backfire: the fireball explodes around the
+		// reader.
+		g.Logf("The fireball explodes around you (cursed scroll).", ColorLogSpecial)
+		p = g.ECS.Positions[a.Actor]
+	}
+	// The fireball flies over monsters in the way, but not through walls,
+	// and the explosion does not spread behind walls either.
+	if a.Blessing != Cursed {
+		if g.Map.Grid.At(p) == Wall {
+			return errors.New("The fireball cannot explode inside a wall.")
+		}
+		from := g.ECS.Positions[a.Actor]
+		if w, ok := g.WallBetween(from, p); ok {
+			return &blockedError{Msg: "A wall blocks the path of the fireball.", Path: linePoints(from, w)}
+		}
+	}
 	hits := 0
-	// NOTE: this could be made more complicated by checking whether there
-	// are monsters in the way. For now, it's a fireball that goes up and
-	// then down and explodes on reaching the target!
-	for i, fi := range g.ECS.Fighter {
+	for _, i := range g.ECS.Fighter.sortedKeys() {
 		if g.ECS.Dead(i) {
 			continue
 		}
-		q := g.ECS.Positions[i]
-		dist := paths.DistanceManhattan(q, p)
-		if dist > sc.Radius {
+		if !g.InBlast(p, g.ECS.Positions[i], sc.Radius) {
 			continue
 		}
-		g.Logf("%v is engulfed in flames.", ColorLogPlayerAttack, g.ECS.GetName(i))
-		fi.HP -= sc.Damage
+		g.Logf("%v is engulfed in flames.", ColorLogPlayerAttack, g.ECS.HighlightName(i, g.ECS.GetName(i)))
+		if a.Actor == g.ECS.PlayerID && g.ECS.Ally(i) {
+			g.AddReputation(allyHarmedReputation, "ally harmed")
+		}
+		g.Damage(i, a.Amplify(sc.Damage))
+		g.Ignite(i)
 		hits++
 	}
+	// Tall grass caught in the explosion catches fire.
+	for y := p.Y - sc.Radius; y <= p.Y+sc.Radius; y++ {
+		for x := p.X - sc.Radius; x <= p.X+sc.Radius; x++ {
+			q := gruid.Point{x, y}
+			if g.Map.Grid.At(q) == Foliage && g.InBlast(p, q, sc.Radius) {
+				g.Map.IgniteGrass(q)
+				hits++
+			}
+		}
+	}
 	if hits <= 0 {
 		return errors.New("There are no targets in the radius.")
 	}
@@ -149,3 +379,68 @@ func (sc *FireballScroll) Activate(g *game, a itemAction) error {
 }
 
 func (sc *FireballScroll) TargetingRadius() int { return sc.Radius }
+
+// InBlast returns true if position q is reached by an explosion of the given
+// radius at p. Explosions do not spread behind walls.
+func (g *game) InBlast(p, q gruid.Point, radius int) bool {
+	if paths.DistanceManhattan(q, p) > radius {
+		return false
+	}
+	_, wall := g.WallBetween(p, q)
+	return !wall
+}
+
+// FriendlyFire returns the player and allies that would be caught in an
+// explosion of the given radius at p.
+func (g *game) FriendlyFire(p gruid.Point, radius int) []int {
+	friends := []int{}
+	for _, i := range g.ECS.Fighter.sortedKeys() {
+		if !g.ECS.Alive(i) || i != g.ECS.PlayerID && !g.ECS.Ally(i) {
+			continue
+		}
+		if g.InBlast(p, g.ECS.Positions[i], radius) {
+			friends = append(friends, i)
+		}
+	}
+	return friends
+}
+
+// TeleportScroll is an item that teleports the reader to a random location
+// on the level.
+type TeleportScroll struct{}
+
+func (sc *TeleportScroll) Activate(g *game, a itemAction) error {
+	g.Teleport(a.Actor)
+	if a.Blessing == Cursed {
+		// Cursed scrolls leave the reader confused.
+		g.Logf("You feel disoriented (cursed scroll).", ColorLogSpecial)
+		g.ECS.PutStatus(a.Actor, StatusConfused, 3)
+	}
+	return nil
+}
+
+// Teleport moves the entity i to a random free floor tile, logging the
+// event if it is seen.
+func (g *game) Teleport(i int) {
+	from := g.ECS.Positions[i]
+	to := g.FreeFloorTile(RNGCombat)
+	g.ECS.MoveEntity(i, to)
+	if i == g.ECS.PlayerID {
+		g.UpdateFOV()
+		g.Logf("You feel yanked away and find yourself elsewhere.", ColorLogItemUse)
+		return
+	}
+	name := g.ECS.HighlightName(i, strings.Title(g.ECS.Name[i]))
+	switch {
+	case g.InFOV(from):
+		g.Logf("%v vanishes!", ColorLogAbility, name)
+	case g.InFOV(to):
+		g.Logf("%v appears out of nowhere!", ColorLogAbility, name)
+	}
+}
+
+// QuestItem is an item that the player has to retrieve for a fetch quest.
+type QuestItem struct{}
+
+// Amulet is the goal item found on the final level of the dungeon.
+type Amulet struct{}
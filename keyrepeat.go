@@ -0,0 +1,123 @@
+// This file handles repeated movement when a movement key is held down, and
+// the interruption conditions that stop repeated actions.
+
+package main
+
+import (
+	"time"
+
+	"github.com/anaseto/gruid"
+)
+
+// keyRepeatInterval is the minimum interval between two steps when holding a
+// movement key. It is set with the -key-repeat command-line flag.
+var keyRepeatInterval = 80 * time.Millisecond
+
+// keyHoldGap is the maximum interval between key down events of the same key
+// for them to be considered as part of a held key. The driver sends repeated
+// key down events while a key is held, after an initial delay. Drivers that
+// report key releases with msgKeyUp end a held key right away: the gap is
+// only a fallback for those that do not.
+const keyHoldGap = 600 * time.Millisecond
+
+// msgKeyUp reports that a movement key was released. It is sent by the driver
+// wrapper in sdlkeys.go, as gruid does not report key releases. It may be
+// received before the key down message of the released press: its time is
+// then later than the time of the key down message.
+type msgKeyUp struct {
+	Key  gruid.Key // released key
+	Time time.Time // time of the release
+}
+
+// releaseKey handles the release of a key: it ends the current key hold, if
+// the key is the held one, and the hold did not start after the release.
+func (m *model) releaseKey(msg msgKeyUp) {
+	m.released = msg
+	if msg.Key == m.hold.Key && !msg.Time.Before(m.hold.Last) {
+		m.hold = keyHold{}
+	}
+}
+
+// keyHold contains information about a held movement key.
+type keyHold struct {
+	Key     gruid.Key      // held key
+	Last    time.Time      // time of last key down event
+	Step    time.Time      // time of last step
+	Stopped bool           // repeating was interrupted
+	Start   interruptState // state when the key was first pressed
+}
+
+// interruptState summarizes the parts of the game state used to decide
+// whether a repeated action should be interrupted.
+type interruptState struct {
+	HP       int // player's HP
+	Hostiles int // hostile monsters in view
+}
+
+// InterruptState returns the current interruption state.
+func (g *game) InterruptState() interruptState {
+	st := interruptState{HP: g.ECS.Fighter[g.ECS.PlayerID].HP}
+	for i := range g.ECS.Blocks {
+		if g.ECS.Hostile(i, g.ECS.PlayerID) && g.ECS.Alive(i) && g.InFOV(g.ECS.Positions[i]) && !g.Unseen(i) {
+			st.Hostiles++
+		}
+	}
+	return st
+}
+
+// Interrupts returns true if the current state st2 should interrupt a
+// repeated action started in state st: the player lost HP, or new hostile
+// monsters came into view.
+func (st interruptState) Interrupts(st2 interruptState) bool {
+	return st2.HP < st.HP || st2.Hostiles > st.Hostiles
+}
+
+// isMovementKey returns true if the key is a movement key.
+func isMovementKey(key gruid.Key) bool {
+	switch key {
+	case gruid.KeyArrowLeft, gruid.KeyArrowDown, gruid.KeyArrowUp, gruid.KeyArrowRight,
+		"h", "j", "k", "l":
+		return true
+	}
+	return false
+}
+
+// skipKeyRepeat returns true if the given key down message should be
+// ignored, because it repeats a held movement key either too fast, or after
+// an interruption.
+func (m *model) skipKeyRepeat(msg gruid.MsgKeyDown) bool {
+	if !isMovementKey(msg.Key) {
+		m.hold = keyHold{}
+		return false
+	}
+	skip := m.holdKey(msg)
+	if r := m.released; r.Key == msg.Key && !r.Time.Before(msg.Time) {
+		// The key was released before this message was received:
+		// the hold is already over.
+		m.hold = keyHold{}
+	}
+	return skip
+}
+
+// holdKey updates the held key information for a movement key down message,
+// and returns true if the message should be ignored.
+func (m *model) holdKey(msg gruid.MsgKeyDown) bool {
+	h := &m.hold
+	if msg.Key != h.Key || msg.Time.Sub(h.Last) > keyHoldGap {
+		// New key press.
+		m.hold = keyHold{Key: msg.Key, Last: msg.Time, Step: msg.Time, Start: m.game.InterruptState()}
+		return false
+	}
+	h.Last = msg.Time
+	switch {
+	case h.Stopped:
+		return true
+	case msg.Time.Sub(h.Step) < keyRepeatInterval:
+		return true
+	case h.Start.Interrupts(m.game.InterruptState()):
+		h.Stopped = true
+		return true
+	}
+	h.Step = msg.Time
+	return false
+}
@@ -0,0 +1,69 @@
+// This file implements the memory of the last monster targeted by the
+// player, so that targeted attacks can be repeated on it even after it
+// moved.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/anaseto/gruid"
+)
+
+// TargetMemory remembers the last monster targeted by the player with an
+// item or a bow.
+type TargetMemory struct {
+	Monster int    // targeted monster
+	Item    string // name of the item used
+	Shot    bool   // whether the monster was shot at with a bow
+	Set     bool   // whether there is a remembered target
+}
+
+// RememberTarget records the monster at p, if any, as the last target of an
+// item with the given name.
+func (g *game) RememberTarget(p gruid.Point, item string) {
+	i := g.ECS.MonsterAt(p)
+	if i < 0 || g.ECS.Ally(i) {
+		return
+	}
+	g.LastTarget = TargetMemory{Monster: i, Item: item, Set: true}
+}
+
+// RememberShot records the monster at p, if any, as the last target of a bow
+// shot.
+func (g *game) RememberShot(p gruid.Point) {
+	i := g.ECS.MonsterAt(p)
+	if i < 0 || g.ECS.Ally(i) {
+		return
+	}
+	g.LastTarget = TargetMemory{Monster: i, Shot: true, Set: true}
+}
+
+// LastTargetPos returns the current position of the last targeted monster,
+// if it is still alive and in view.
+func (g *game) LastTargetPos() (gruid.Point, bool) {
+	t := g.LastTarget
+	if !t.Set || !g.ECS.Alive(t.Monster) {
+		return gruid.Point{}, false
+	}
+	p := g.ECS.Positions[t.Monster]
+	return p, g.InFOV(p)
+}
+
+// RepeatTargetedAttack makes the player use again an item of the same kind
+// as last time on the last targeted monster.
+func (g *game) RepeatTargetedAttack() error {
+	p, ok := g.LastTargetPos()
+	if !ok {
+		return errors.New("You have no visible target to attack again.")
+	}
+	item := g.LastTarget.Item
+	for n, i := range g.ECS.Inventory[g.ECS.PlayerID].Items {
+		if g.ECS.Name[i] != item {
+			continue
+		}
+		return g.InventoryActivateWithTarget(g.ECS.PlayerID, n, &p)
+	}
+	return fmt.Errorf("You have no %s left.", item)
+}
@@ -0,0 +1,61 @@
+// This file implements the drawing layers of the map: the map layer with
+// tiles and entities, the effects layer with highlights and animations, and
+// the UI layer with popups and other overlays. Each layer is drawn
+// separately, and then composited, so that overlays never mutate the cells of
+// the layers below.
+
+package main
+
+import "github.com/anaseto/gruid"
+
+// layers holds the drawing layers of the map, from bottom to top.
+type layers struct {
+	Map     gruid.Grid // map tiles and entities
+	Effects gruid.Grid // highlights, animations and indicators
+	UI      gruid.Grid // popups and other overlays
+}
+
+// newLayers returns new drawing layers of map size.
+func newLayers() layers {
+	return layers{
+		Map:     gruid.NewGrid(MapWidth, MapHeight),
+		Effects: gruid.NewGrid(MapWidth, MapHeight),
+		UI:      gruid.NewGrid(MapWidth, MapHeight),
+	}
+}
+
+// Clear clears the layers for a new frame. The effects and UI layers become
+// fully transparent.
+func (ls layers) Clear() {
+	ls.Map.Fill(gruid.Cell{Rune: ' '})
+	ls.Effects.Fill(gruid.Cell{})
+	ls.UI.Fill(gruid.Cell{})
+}
+
+// Composite draws the composition of the layers into gd.
+//
+// A cell of the effects layer with a zero rune only adds its attributes to
+// the cell below (for example for highlights). Otherwise, it replaces the
+// rune and foreground of the cell below, keeping its background unless the
+// effect has its own. A cell of the UI layer with a non-zero rune replaces
+// the cell below.
+func (ls layers) Composite(gd gruid.Grid) {
+	it := ls.Map.Iterator()
+	for it.Next() {
+		p := it.P()
+		c := it.Cell()
+		e := ls.Effects.At(p)
+		if e.Rune != 0 {
+			c.Rune = e.Rune
+			c.Style.Fg = e.Style.Fg
+			if e.Style.Bg != gruid.ColorDefault {
+				c.Style.Bg = e.Style.Bg
+			}
+		}
+		c.Style.Attrs |= e.Style.Attrs
+		if u := ls.UI.At(p); u.Rune != 0 {
+			c = u
+		}
+		gd.Set(p, c)
+	}
+}
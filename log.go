@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/anaseto/gruid"
 	"github.com/anaseto/gruid/ui"
@@ -14,6 +15,7 @@ type LogEntry struct {
 	Text  string      // entry text
 	Color gruid.Color // color
 	Dups  int         // consecutive duplicates of same message
+	Refs  []EntityRef // entities referenced in the text
 }
 
 func (e LogEntry) String() string {
@@ -23,10 +25,72 @@ func (e LogEntry) String() string {
 	return fmt.Sprintf("%s (%d×)", e.Text, e.Dups)
 }
 
+// StyledText returns the entry as styled text, in the entry's color, with
+// inline markup spans highlighted.
+func (e LogEntry) StyledText() ui.StyledText {
+	st := gruid.Style{}.WithFg(e.Color)
+	return ui.NewStyledText(e.String(), st).WithMarkups(logMarkups)
+}
+
+// Markup runes for inline style spans in log entries. A span starts with '@'
+// followed by one of those runes, and ends with "@N", which goes back to the
+// entry's color. A literal '@' is written "@@".
+const (
+	MarkupDamage  = 'd' // damage numbers and amounts
+	MarkupMonster = 'm' // monster names
+	MarkupItem    = 'i' // item names
+	MarkupPlayer  = 'p' // the player
+)
+
+// logMarkups maps markup runes to their style.
+var logMarkups = map[rune]gruid.Style{
+	MarkupDamage:  gruid.Style{}.WithFg(ColorLogSpecial),
+	MarkupMonster: gruid.Style{}.WithFg(ColorMonster),
+	MarkupItem:    gruid.Style{}.WithFg(ColorConsumable),
+	MarkupPlayer:  gruid.Style{}.WithFg(ColorPlayer),
+}
+
+// Highlight returns the default formatting of v wrapped in a markup span
+// using the markup rune r.
+func Highlight(r rune, v interface{}) string {
+	s := strings.ReplaceAll(fmt.Sprint(v), "@", "@@")
+	return fmt.Sprintf("@%c%s@N", r, s)
+}
+
+// EntityRef is a reference to an entity within a log entry. When formatted,
+// it produces the entity's name wrapped in a markup span. Entity references
+// passed as arguments to Logf are recorded in the log entry, so that
+// clicking on the name later can show the entity.
+type EntityRef struct {
+	ID     int    // entity index
+	Name   string // name as written in the log
+	Markup rune   // markup rune for the name
+}
+
+func (r EntityRef) String() string {
+	return Highlight(r.Markup, r.Name)
+}
+
+// HighlightName returns a reference to entity i with the given name,
+// highlighted depending on the kind of entity.
+func (es *ECS) HighlightName(i int, name string) EntityRef {
+	r := EntityRef{ID: i, Name: name, Markup: MarkupItem}
+	switch {
+	case i == es.PlayerID || es.Ally(i):
+		r.Markup = MarkupPlayer
+	case es.Alive(i):
+		r.Markup = MarkupMonster
+	}
+	return r
+}
+
 // Log adds an entry to the player's log.
 func (g *game) log(e LogEntry) {
+	g.noteTurnEvent(e.Text)
 	if len(g.Log) > 0 {
 		if g.Log[len(g.Log)-1].Text == e.Text {
+			// References are updated to the latest ones.
+			g.Log[len(g.Log)-1].Refs = e.Refs
 			g.Log[len(g.Log)-1].Dups++
 			return
 		}
@@ -34,12 +98,83 @@ func (g *game) log(e LogEntry) {
 	g.Log = append(g.Log, e)
 }
 
-// Logf adds a formatted entry to the game log.
+// Logf adds a formatted entry to the game log. Arguments of type EntityRef
+// are recorded in the entry.
 func (g *game) Logf(format string, color gruid.Color, a ...interface{}) {
 	e := LogEntry{Text: fmt.Sprintf(format, a...), Color: color}
+	for _, v := range a {
+		if r, ok := v.(EntityRef); ok {
+			e.Refs = append(e.Refs, r)
+		}
+	}
 	g.log(e)
 }
 
+// RefAt returns the entity reference whose name is displayed at column x of
+// the entry, if any. Markup spans in the text are matched in order with the
+// entry's references.
+func (e LogEntry) RefAt(x int) (EntityRef, bool) {
+	refs := e.Refs
+	col, start := 0, 0
+	var markup rune // markup of the current span, if any
+	var name []rune // content of the current span
+	found := false
+	endSpan := func() {
+		if markup == 0 || len(refs) == 0 || refs[0].Markup != markup || refs[0].Name != string(name) {
+			return
+		}
+		if x >= start && x < col {
+			found = true
+			return
+		}
+		refs = refs[1:]
+	}
+	procm := false
+	for _, c := range e.Text {
+		if procm {
+			procm = false
+			if c != '@' {
+				endSpan()
+				if found {
+					return refs[0], true
+				}
+				markup, name, start = c, nil, col
+				if c == 'N' {
+					markup = 0
+				}
+				continue
+			}
+		} else if c == '@' {
+			procm = true
+			continue
+		}
+		name = append(name, c)
+		col++
+	}
+	return EntityRef{}, false
+}
+
+// clickLog handles a mouse click on the log at p: if the click is on an
+// entity name, the examination cursor is placed on that entity, provided it
+// is still in view.
+func (m *model) clickLog(p gruid.Point) {
+	n := len(m.game.Log) - LogLines + p.Y
+	if n < 0 || n >= len(m.game.Log) {
+		return
+	}
+	r, ok := m.game.Log[n].RefAt(p.X)
+	if !ok || r.ID == m.game.ECS.PlayerID {
+		return
+	}
+	q, ok := m.game.ECS.Positions[r.ID]
+	if _, exists := m.game.ECS.Entities[r.ID]; !exists || !ok || !m.game.InFOV(q) {
+		m.game.Logf("You cannot see the %s anymore.", ColorLogSpecial, r.Name)
+		return
+	}
+	m.mode = modeExamination
+	m.targ.pos = q.Shift(0, LogLines)
+}
+
 // InitializeHistoryViewer creates a new pager for viewing message's history.
 func (m *model) InitializeMessageViewer() {
 	m.viewer = ui.NewPager(ui.PagerConfig{
@@ -0,0 +1,143 @@
+// This file handles loot tables: weighted lists of items generated on each
+// level, depending on depth. The default tables are embedded from loot.json,
+// and can be replaced without recompiling by a loot.json file in the game's
+// data directory.
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+//go:embed loot.json
+var defaultLootData []byte
+
+// lootEquipment is the special loot entry name for a random piece of
+// equipment suitable for the depth.
+const lootEquipment = "equipment"
+
+// lootEntry is an item of a loot table with its relative weight.
+type lootEntry struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// lootTable describes the items generated for a range of depths.
+type lootTable struct {
+	MinDepth int         `json:"min_depth"`
+	MaxDepth int         `json:"max_depth"`
+	Count    int         `json:"count"` // number of items per level
+	Items    []lootEntry `json:"items"`
+}
+
+// lootTables is the loot table file format.
+type lootTables struct {
+	Tables []lootTable `json:"tables"`
+}
+
+// loot contains the loot tables in use.
+var loot lootTables
+
+func init() {
+	if err := loot.Parse(defaultLootData); err != nil {
+		panic(fmt.Sprintf("default loot tables: %v", err))
+	}
+}
+
+// Parse parses and checks loot tables in JSON format.
+func (lt *lootTables) Parse(data []byte) error {
+	nlt := lootTables{}
+	if err := json.Unmarshal(data, &nlt); err != nil {
+		return err
+	}
+	for depth := 1; depth <= MaxDepth; depth++ {
+		if nlt.Table(depth) == nil {
+			return fmt.Errorf("no loot table for depth %d", depth)
+		}
+	}
+	for _, t := range nlt.Tables {
+		total := 0
+		for _, e := range t.Items {
+			if e.Name != lootEquipment && !isItemName(e.Name) {
+				return fmt.Errorf("unknown item: %s", e.Name)
+			}
+			if e.Weight < 0 {
+				return fmt.Errorf("negative weight for %s", e.Name)
+			}
+			total += e.Weight
+		}
+		if total <= 0 {
+			return fmt.Errorf("empty loot table for depths %d-%d", t.MinDepth, t.MaxDepth)
+		}
+	}
+	*lt = nlt
+	return nil
+}
+
+// LoadUserLootTables replaces the default loot tables by the ones in the
+// loot.json file of the data directory, if there is one.
+func LoadUserLootTables() error {
+	dataDir, err := DataDir()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(dataDir, "loot.json"))
+	if err != nil {
+		// No custom loot tables.
+		return nil
+	}
+	if err := loot.Parse(data); err != nil {
+		return fmt.Errorf("loot.json: %v", err)
+	}
+	return nil
+}
+
+// Table returns the loot table for the given depth, or nil if there is
+// none. Depths past the last table use the deepest one.
+func (lt *lootTables) Table(depth int) *lootTable {
+	var deepest *lootTable
+	for k := range lt.Tables {
+		t := &lt.Tables[k]
+		if depth >= t.MinDepth && depth <= t.MaxDepth {
+			return t
+		}
+		if depth > t.MaxDepth && (deepest == nil || t.MaxDepth > deepest.MaxDepth) {
+			deepest = t
+		}
+	}
+	return deepest
+}
+
+// RandomLoot returns the name of a random item from the loot table of the
+// current depth, taking into account the scenario's rules.
+func (g *game) RandomLoot() string {
+	t := loot.Table(g.Depth)
+	if t == nil {
+		t = loot.Table(1)
+	}
+	weight := func(e lootEntry) int {
+		if e.Name == "health potion" && g.Rule(RuleNoHealingPotions) {
+			return 0
+		}
+		return e.Weight
+	}
+	total := 0
+	for _, e := range t.Items {
+		total += weight(e)
+	}
+	if total <= 0 {
+		return lootEquipment
+	}
+	n := g.Rand(RNGLoot).Intn(total)
+	for _, e := range t.Items {
+		n -= weight(e)
+		if n < 0 {
+			return e.Name
+		}
+	}
+	return lootEquipment
+}
@@ -3,6 +3,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 
 	"github.com/anaseto/gruid"
@@ -18,6 +20,25 @@ const (
 )
 
 func main() {
+	// Parse command-line flags.
+	flag.BoolVar(&mapGenDebug, "mapgen-debug", false, "step through map generation phases on new levels")
+	flag.BoolVar(&wizard, "wizard", false, "enable wizard mode (diagnostics overlay with D key)")
+	flag.StringVar(&arenaSpec, "arena", "", "start new games in a wizard mode arena with the given monsters and items (e.g. \"orc*3,troll;fireball scroll\")")
+	flag.BoolVar(&eventLogSaves, "event-log", false, "save new games as a seed and input log instead of a snapshot")
+	flag.StringVar(&replayFile, "replay", "", "re-simulate the given event log file of the data directory when continuing")
+	flag.IntVar(&turnLogLength, "turn-log", turnLogLength, "number of last turns exported with the B key (for bug reports)")
+	flag.BoolVar(&ambientEffects, "ambient", ambientEffects, "show ambient map animations (torch flicker, water shimmer)")
+	flag.DurationVar(&animFrameDelay, "anim-frame", animFrameDelay, "duration of an animation frame (0 for instant mode, without animations)")
+	flag.DurationVar(&keyRepeatInterval, "key-repeat", keyRepeatInterval, "minimum interval between steps when holding a movement key")
+	showVersion := flag.Bool("version", false, "print version and build information, and exit")
+	flag.Parse()
+	if *showVersion {
+		fmt.Printf("gruid-rltuto %v\n", build)
+		return
+	}
+	if err := LoadUserLootTables(); err != nil {
+		log.Fatal(err)
+	}
 	// Create a new grid with standard 80x24 size.
 	gd := gruid.NewGrid(UIWidth, UIHeight)
 	// Create the main application's model, using grid gd.
@@ -28,14 +49,14 @@ func main() {
 		log.Fatal(err)
 	}
 	// Use the SDL2 driver from gruid-sdl, using the previously defined
-	// TileManager.
+	// TileManager, and wrap it so that key releases are reported.
 	dr := sdl.NewDriver(sdl.Config{
 		TileManager: t,
 	})
 
 	// Define a new application using the SDL2 gruid driver and our model.
 	app := gruid.NewApp(gruid.AppConfig{
-		Driver: dr,
+		Driver: sdlDriver{Driver: dr},
 		Model:  m,
 	})
 
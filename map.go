@@ -3,8 +3,9 @@
 package main
 
 import (
+	"fmt"
+	"log"
 	"math/rand"
-	"time"
 
 	"github.com/anaseto/gruid"
 	"github.com/anaseto/gruid/paths"
@@ -15,29 +16,111 @@ import (
 const (
 	Wall rl.Cell = iota
 	Floor
+	Altar   // reveals the blessing state of dropped items
+	Foliage // tall grass: walkable but blocks vision
+	// decorative floor features
+	Rubble
+	Bones
+	Mushrooms
+	Pool
+	Brazier // light source
+	DeepWater
+	Bridge
+	Downstairs
+	PoisonTrap   // poisons fighters standing on it
+	FireTrap     // sets fighters standing on it on fire
+	BurningGrass // tall grass on fire: spreads fire, then burns out
+	Upstairs     // way back to the town
 )
 
 // Map represents the rectangular map of the game's level.
 type Map struct {
 	Grid     rl.Grid
-	rand     *rand.Rand           // random number generator
+	rand     *rand.Rand           // random number generator (mapgen stream)
+	rngs     *rngStreams          // random number streams of the level
 	Explored map[gruid.Point]bool // explored cells
+	Lit      map[gruid.Point]bool // cells lit by a light source
+	Dark     map[gruid.Point]bool // cells in dark zones (reduced vision)
+	Depth    int                  // dungeon depth of the map
+	RNG      rngState             // state of rngs (updated when saving)
+
+	// Placements records special positions for entities, as marked
+	// in prefabs.
+	Placements map[placement][]gruid.Point
+
+	Special string // name of the special level, if any
+
+	phases []mapPhase // generation phases (map generation debug mode)
+}
+
+// NewMap returns a new map with given size for a given dungeon depth. The seed
+// initializes the map's random number streams, used both for generation and
+// during play on the map (see rng.go).
+func NewMap(size gruid.Point, depth int, seed int64) *Map {
+	m := newMap(size, depth, seed)
+	m.Generate()
+	return m
 }
 
-// NewMap returns a new map with given size.
-func NewMap(size gruid.Point) *Map {
+// newMap returns a new map filled with walls.
+func newMap(size gruid.Point, depth int, seed int64) *Map {
 	m := &Map{
-		Grid:     rl.NewGrid(size.X, size.Y),
-		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
-		Explored: make(map[gruid.Point]bool),
+		Grid:       rl.NewGrid(size.X, size.Y),
+		Explored:   make(map[gruid.Point]bool),
+		Lit:        make(map[gruid.Point]bool),
+		Dark:       make(map[gruid.Point]bool),
+		Depth:      depth,
+		Placements: make(map[placement][]gruid.Point),
 	}
-	m.Generate()
+	m.Reseed(seed)
 	return m
 }
 
+// Reseed initializes the map's random number streams with the given seed.
+func (m *Map) Reseed(seed int64) {
+	m.rngs = newRNGStreams(seed)
+	m.rand = m.rngs.Get(RNGMapgen)
+}
+
+// SaveRNG records the state of the map's random number streams in RNG.
+func (m *Map) SaveRNG() {
+	m.RNG = m.rngs.State()
+}
+
+// RestoreRNG restores the map's random number streams from RNG, so that a
+// continued game draws the same numbers as if it had not been saved.
+func (m *Map) RestoreRNG() {
+	m.rngs = restoreRNGStreams(m.RNG)
+	m.rand = m.rngs.Get(RNGMapgen)
+}
+
 // Walkable returns true if at the given position there is a floor tile.
 func (m *Map) Walkable(p gruid.Point) bool {
-	return m.Grid.At(p) == Floor
+	switch m.Grid.At(p) {
+	case Floor, Altar, Foliage, Rubble, Bones, Mushrooms, Pool, Bridge, Downstairs, PoisonTrap, FireTrap, BurningGrass, Upstairs:
+		return true
+	}
+	return false
+}
+
+// Transparent returns true if the terrain at the given position does not
+// block vision.
+func (m *Map) Transparent(p gruid.Point) bool {
+	switch m.Grid.At(p) {
+	case Wall, Foliage:
+		return false
+	}
+	return true
+}
+
+// Trample turns foliage at the given position into floor, if any. It returns
+// true if some foliage was trampled.
+func (m *Map) Trample(p gruid.Point) bool {
+	if m.Grid.At(p) != Foliage {
+		return false
+	}
+	m.Grid.Set(p, Floor)
+	return true
 }
 
 // Rune returns the character rune representing a given terrain.
@@ -47,12 +130,205 @@ func (m *Map) Rune(c rl.Cell) (r rune) {
 		r = '#'
 	case Floor:
 		r = '.'
+	case Altar:
+		r = '_'
+	case Foliage:
+		r = '"'
+	case Rubble:
+		r = ','
+	case Bones:
+		r = ';'
+	case Mushrooms:
+		r = '*'
+	case Pool:
+		r = '~'
+	case Brazier:
+		r = '&'
+	case DeepWater:
+		r = '≈'
+	case Bridge:
+		r = '='
+	case Downstairs:
+		r = '>'
+	case Upstairs:
+		r = '<'
+	case PoisonTrap, FireTrap:
+		r = '^'
+	case BurningGrass:
+		r = '"'
 	}
 	return r
 }
 
+// Name returns a short description of a given terrain, for use in map
+// examination. It returns an empty string for plain floor and walls.
+func (m *Map) Name(c rl.Cell) (s string) {
+	switch c {
+	case Altar:
+		s = "altar"
+	case Foliage:
+		s = "tall grass"
+	case Rubble:
+		s = "rubble"
+	case Bones:
+		s = "bones"
+	case Mushrooms:
+		s = "mushrooms"
+	case Pool:
+		s = "pool"
+	case Brazier:
+		s = "brazier"
+	case DeepWater:
+		s = "deep water"
+	case Bridge:
+		s = "bridge"
+	case Downstairs:
+		s = "stairs down"
+	case Upstairs:
+		s = "stairs up"
+	case PoisonTrap:
+		s = "poison trap"
+	case FireTrap:
+		s = "fire trap"
+	case BurningGrass:
+		s = "burning grass"
+	}
+	return s
+}
+
+// Color returns the foreground color representing a given terrain.
+func (m *Map) Color(c rl.Cell) (fg gruid.Color) {
+	switch c {
+	case Foliage:
+		fg = ColorFoliage
+	case Bones:
+		fg = ColorBones
+	case Mushrooms:
+		fg = ColorMushrooms
+	case Pool:
+		fg = ColorPool
+	case Brazier:
+		fg = ColorBrazier
+	case DeepWater:
+		fg = ColorPool
+	case Bridge:
+		fg = ColorBridge
+	case PoisonTrap:
+		fg = ColorPoison
+	case FireTrap, BurningGrass:
+		fg = ColorFire
+	}
+	return fg
+}
+
 // Generate fills the Grid attribute of m with a procedurally generated map.
+// Generated maps are validated, and generation is run again if the result is
+// not satisfying. After a certain number of attempts, validation is relaxed
+// to only require a big enough cave. If it still fails, a fixed fallback
+// level is used instead, so that a map failing validation is never kept.
 func (m *Map) Generate() {
+	if m.Depth > 0 && m.Depth < MaxDepth && m.rand.Intn(100) < specialLevelChance {
+		// Special levels are fixed, so they do not need validation.
+		m.generateSpecial()
+		return
+	}
+	const (
+		maxAttempts        = 50  // attempts with normal validation
+		maxRelaxedAttempts = 100 // total attempts before fallback
+	)
+	for i := 1; i <= maxRelaxedAttempts; i++ {
+		st := m.generate()
+		relaxed := i > maxAttempts
+		err := st.Validate(relaxed)
+		if err == nil {
+			if relaxed {
+				m.debugf("map generation: attempt %d accepted with relaxed validation (%v)", i, st)
+			}
+			return
+		}
+		m.debugf("map generation: attempt %d rejected: %v (%v)", i, err, st)
+	}
+	m.debugf("map generation: using fallback level")
+	m.generateFallback()
+}
+
+// debugf logs a map generation message in map generation debug mode.
+func (m *Map) debugf(format string, v ...interface{}) {
+	if mapGenDebug {
+		log.Printf(format, v...)
+	}
+}
+
+// generateFallback fills the map with a fixed level, used when procedural
+// generation keeps failing validation: a special level on intermediate
+// levels, or the boss arena in an open field on the final level.
+func (m *Map) generateFallback() {
+	if m.Depth > 0 && m.Depth < MaxDepth {
+		m.generateSpecial()
+		return
+	}
+	if m.Depth == 0 {
+		// The town level is fixed and always valid.
+		m.generate()
+		return
+	}
+	m.reset()
+	m.Grid.Fill(Wall)
+	m.Grid.Slice(m.Grid.Range().Shift(1, 1, -1, -1)).Fill(Floor)
+	origin := m.Grid.Size().Sub(bossArena.Size()).Div(2)
+	m.StampPrefab(bossArena, origin)
+	m.Grid.Set(m.RandomFloor(), Altar)
+	m.recordPhase("fallback level")
+}
+
+// minCaveSize is the minimum size of the connected cave in a valid map.
+const minCaveSize = 400
+
+// mapStats contains statistics about a generated map, used for validation.
+type mapStats struct {
+	Cells     int // total number of cells
+	Floor     int // floor cells after cellular automata generation
+	Reachable int // floor cells in the kept connected component
+	Spawn     int // plain floor cells available for spawning entities
+}
+
+func (st mapStats) String() string {
+	return fmt.Sprintf("cells: %d, floor: %d, reachable: %d, spawn: %d",
+		st.Cells, st.Floor, st.Reachable, st.Spawn)
+}
+
+// Validate returns an error if the statistics describe a degenerate map.
+// Relaxed validation only checks the size of the cave.
+func (st mapStats) Validate(relaxed bool) error {
+	const (
+		minFloorPercent = 30  // minimum percentage of reachable floor
+		minSpawnCells   = 300 // minimum number of spawn cells
+	)
+	if relaxed {
+		if st.Reachable <= minCaveSize {
+			return fmt.Errorf("cave smaller than %d cells", minCaveSize)
+		}
+		return nil
+	}
+	switch {
+	case st.Reachable*100 < minFloorPercent*st.Cells:
+		return fmt.Errorf("reachable floor below %d%%", minFloorPercent)
+	case st.Reachable <= minCaveSize:
+		return fmt.Errorf("cave smaller than %d cells", minCaveSize)
+	case st.Spawn < minSpawnCells:
+		return fmt.Errorf("fewer than %d spawn cells", minSpawnCells)
+	}
+	return nil
+}
+
+// generate runs a single map generation attempt and returns statistics about
+// the result.
+func (m *Map) generate() mapStats {
+	st := mapStats{Cells: m.Grid.Size().X * m.Grid.Size().Y}
+	m.reset()
+	if m.Depth == 0 {
+		return m.generateTown()
+	}
 	// map generator using the rl package from gruid
 	mgen := rl.MapGen{Rand: m.rand, Grid: m.Grid}
 	// cellular automata map generation with rules that give a cave-like
@@ -61,30 +337,338 @@ func (m *Map) Generate() {
 		{WCutoff1: 5, WCutoff2: 2, Reps: 4, WallsOutOfRange: true},
 		{WCutoff1: 5, WCutoff2: 25, Reps: 3, WallsOutOfRange: true},
 	}
+	st.Floor = mgen.CellularAutomataCave(Wall, Floor, 0.42, rules)
+	m.recordPhase("cellular automata")
+	if st.Floor == 0 {
+		return st
+	}
+	final := m.Depth == MaxDepth
+	var freep gruid.Point
+	switch {
+	case final:
+		// The final level contains the boss arena.
+		freep = m.StampPrefab(bossArena, m.RandomPrefabOrigin(bossArena))
+	case m.rand.Intn(2) == 0:
+		// Hybrid map with both caverns and rooms.
+		freep = m.GenerateRooms()
+	default:
+		freep = m.RandomFloor()
+	}
+	if !final && m.rand.Intn(100) < vaultChance {
+		q := m.StampPrefab(hiddenVault, m.RandomPrefabOrigin(hiddenVault))
+		if m.Grid.At(freep) != Floor {
+			// The vault was stamped over freep.
+			freep = q
+		}
+	}
+	// We put walls in floor cells non reachable from freep, to ensure that
+	// all the cells are connected (which is not guaranteed by cellular
+	// automata map generation).
+	pr := paths.NewPathRange(m.Grid.Range())
+	pr.CCMap(&path{m: m}, freep)
+	st.Reachable = mgen.KeepCC(pr, freep, Wall)
+	m.recordPhase("connectivity pruning")
+	if st.Reachable <= minCaveSize {
+		// The map will be rejected anyway: we do not bother adding
+		// features.
+		return st
+	}
+	if !final {
+		m.GenerateRiver()
+	}
+	m.GenerateFoliage()
+	m.GenerateDecorations()
+	m.GenerateDarkZones()
+	m.GenerateBraziers()
+	// We place an altar on a random floor tile.
+	m.Grid.Set(m.RandomFloor(), Altar)
+	if !final {
+		m.Grid.Set(m.RandomFloor(), Downstairs)
+	}
+	m.GenerateTraps()
+	st.Spawn = m.Grid.Count(Floor)
+	m.recordPhase("terrain features")
+	return st
+}
+
+// ExploredPercent returns the percentage of walkable cells of the map that
+// have been explored.
+func (m *Map) ExploredPercent() int {
+	total, explored := 0, 0
+	it := m.Grid.Iterator()
+	for it.Next() {
+		if !m.Walkable(it.P()) {
+			continue
+		}
+		total++
+		if m.Explored[it.P()] {
+			explored++
+		}
+	}
+	if total == 0 {
+		return 100
+	}
+	return 100 * explored / total
+}
+
+// reset clears any map information from previous generation attempts.
+func (m *Map) reset() {
+	m.phases = nil
+	m.Lit = make(map[gruid.Point]bool)
+	m.Dark = make(map[gruid.Point]bool)
+	m.Placements = make(map[placement][]gruid.Point)
+}
+
+// GenerateRooms overlays a few walled rectangular rooms onto the cave and
+// connects them with tunnels, providing defensible chokepoints in addition to
+// the open caverns. It returns a floor position inside a room.
+func (m *Map) GenerateRooms() gruid.Point {
+	const (
+		maxRooms = 6
+		maxTries = 200
+	)
+	size := m.Grid.Size()
+	rooms := []gruid.Range{}
+	for tries := 0; len(rooms) < maxRooms && tries < maxTries; tries++ {
+		w := 7 + m.rand.Intn(6)
+		h := 5 + m.rand.Intn(3)
+		x := 1 + m.rand.Intn(size.X-w-1)
+		y := 1 + m.rand.Intn(size.Y-h-1)
+		rg := gruid.NewRange(x, y, x+w, y+h)
+		overlaps := false
+		for _, r := range rooms {
+			// We keep a margin of one cell between rooms.
+			if !r.Shift(-1, -1, 1, 1).Intersect(rg).Empty() {
+				overlaps = true
+				break
+			}
+		}
+		if overlaps {
+			continue
+		}
+		rooms = append(rooms, rg)
+		rg.Iter(func(p gruid.Point) { m.Grid.Set(p, Wall) })
+		rg.Shift(1, 1, -1, -1).Iter(func(p gruid.Point) { m.Grid.Set(p, Floor) })
+	}
+	// We connect each room to the previous one with an L-shaped tunnel
+	// between their centers.
+	center := func(rg gruid.Range) gruid.Point {
+		return rg.Min.Add(rg.Size().Div(2))
+	}
+	for i := 1; i < len(rooms); i++ {
+		m.CarveTunnel(center(rooms[i-1]), center(rooms[i]))
+	}
+	if len(rooms) == 0 {
+		return m.RandomFloor()
+	}
+	return center(rooms[0])
+}
+
+// CarveTunnel carves an L-shaped tunnel of floor cells between two positions,
+// first horizontally and then vertically.
+func (m *Map) CarveTunnel(from, to gruid.Point) {
+	p := from
+	for p.X != to.X {
+		m.Grid.Set(p, Floor)
+		if p.X < to.X {
+			p.X++
+		} else {
+			p.X--
+		}
+	}
+	for p.Y != to.Y {
+		m.Grid.Set(p, Floor)
+		if p.Y < to.Y {
+			p.Y++
+		} else {
+			p.Y--
+		}
+	}
+	m.Grid.Set(p, Floor)
+}
+
+// GenerateRiver carves a river through the cave using a random walk from the
+// left edge of the map to the right one. Only walkable cells are turned into
+// water, and bridges are then added as needed to preserve connectivity.
+func (m *Map) GenerateRiver() {
+	size := m.Grid.Size()
+	p := gruid.Point{0, 1 + m.rand.Intn(size.Y-2)}
+	for p.X < size.X {
+		if m.Walkable(p) {
+			m.Grid.Set(p, DeepWater)
+		}
+		switch r := m.rand.Intn(10); {
+		case r < 6:
+			p.X++
+		case r < 8:
+			if p.Y > 1 {
+				p.Y--
+			}
+		default:
+			if p.Y < size.Y-2 {
+				p.Y++
+			}
+		}
+	}
+	m.BridgeRivers()
+}
+
+// BridgeRivers turns water cells into bridges until all the walkable cells
+// are connected. Each time, the shortest crossing from the connected
+// component of a random floor cell to some other walkable cell is bridged.
+func (m *Map) BridgeRivers() {
+	pr := paths.NewPathRange(m.Grid.Range())
+	size := m.Grid.Size()
 	for {
-		mgen.CellularAutomataCave(Wall, Floor, 0.42, rules)
-		freep := m.RandomFloor()
-		// We put walls in floor cells non reachable from freep, to ensure that
-		// all the cells are connected (which is not guaranteed by cellular
-		// automata map generation).
-		pr := paths.NewPathRange(m.Grid.Range())
-		pr.CCMap(&path{m: m}, freep)
-		ntiles := mgen.KeepCC(pr, freep, Wall)
-		const minCaveSize = 400
-		if ntiles > minCaveSize {
-			break
+		reachable := pr.CCMap(&path{m: m}, m.RandomFloor())
+		sources := make([]gruid.Point, len(reachable))
+		copy(sources, reachable)
+		nodes := pr.BreadthFirstMap(&riverPath{m: m}, sources, size.X*size.Y)
+		target := gruid.Point{-1, -1}
+		for _, n := range nodes {
+			if m.Walkable(n.P) && pr.CCMapAt(n.P) != 0 {
+				target = n.P
+				break
+			}
+		}
+		if target.X < 0 {
+			// All walkable cells are connected.
+			return
+		}
+		// We go back from target to the connected component, bridging
+		// water cells on the way.
+		p := target
+		for cost := pr.BreadthFirstMapAt(p); cost > 0; cost = pr.BreadthFirstMapAt(p) {
+			for _, q := range []gruid.Point{p.Shift(-1, 0), p.Shift(1, 0), p.Shift(0, -1), p.Shift(0, 1)} {
+				if q.In(m.Grid.Range()) && pr.BreadthFirstMapAt(q) == cost-1 {
+					p = q
+					break
+				}
+			}
+			if m.Grid.At(p) == DeepWater {
+				m.Grid.Set(p, Bridge)
+			}
 		}
-		// If there were not enough free tiles, we run the map
-		// generation again.
+	}
+}
+
+// riverPath implements the paths.Pather interface and is used to find
+// crossings over water in map generation.
+type riverPath struct {
+	m  *Map
+	nb paths.Neighbors
+}
+
+// Neighbors returns the list of walkable or water neighbors of q in the map
+// using 4-way movement along cardinal directions.
+func (rp *riverPath) Neighbors(q gruid.Point) []gruid.Point {
+	return rp.nb.Cardinal(q,
+		func(r gruid.Point) bool {
+			return rp.m.Walkable(r) || rp.m.Grid.At(r) == DeepWater
+		})
+}
+
+// GenerateFoliage adds some patches of tall grass to the map. Each patch is
+// produced by a short random walk on floor cells starting from a random floor
+// position.
+func (m *Map) GenerateFoliage() {
+	const (
+		patches   = 6
+		walkSteps = 40
+	)
+	dirs := []gruid.Point{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	for i := 0; i < patches; i++ {
+		p := m.RandomFloor()
+		for j := 0; j < walkSteps; j++ {
+			if m.Grid.At(p) == Floor {
+				m.Grid.Set(p, Foliage)
+			}
+			q := p.Add(dirs[m.rand.Intn(len(dirs))])
+			if m.Walkable(q) {
+				p = q
+			}
+		}
+	}
+}
+
+// GenerateDecorations sprinkles some non-functional decorative features on
+// floor cells, so that levels are less visually uniform.
+func (m *Map) GenerateDecorations() {
+	decorations := []rl.Cell{Rubble, Bones, Mushrooms, Pool}
+	it := m.Grid.Iterator()
+	for it.Next() {
+		if it.Cell() != Floor || m.rand.Intn(100) >= 2 {
+			continue
+		}
+		it.SetCell(decorations[m.rand.Intn(len(decorations))])
+	}
+}
+
+// GenerateDarkZones marks a few roughly circular patches of the map as dark.
+// Vision is reduced in dark cells.
+func (m *Map) GenerateDarkZones() {
+	const (
+		zones     = 3
+		minRadius = 3
+		maxRadius = 6
+	)
+	for i := 0; i < zones; i++ {
+		center := m.RandomFloor()
+		radius := minRadius + m.rand.Intn(maxRadius-minRadius+1)
+		rg := gruid.NewRange(-radius, -radius, radius+1, radius+1).Add(center)
+		rg.Intersect(m.Grid.Range()).Iter(func(p gruid.Point) {
+			if paths.DistanceManhattan(p, center) <= radius {
+				m.Dark[p] = true
+			}
+		})
+	}
+}
+
+// GenerateBraziers places a few braziers in open areas of the map, and marks
+// the cells they light. Braziers are only placed on cells surrounded by
+// walkable cells, so that they do not break map connectivity.
+func (m *Map) GenerateBraziers() {
+	const (
+		braziers    = 2
+		lightRadius = 3
+		maxTries    = 100
+	)
+	fov := rl.NewFOV(m.Grid.Range())
+	for i, tries := 0, 0; i < braziers && tries < maxTries; tries++ {
+		p := m.RandomFloor()
+		open := true
+		for y := -1; y <= 1; y++ {
+			for x := -1; x <= 1; x++ {
+				if !m.Walkable(p.Shift(x, y)) {
+					open = false
+				}
+			}
+		}
+		if !open {
+			continue
+		}
+		m.Grid.Set(p, Brazier)
+		for _, q := range fov.SSCVisionMap(p, lightRadius, m.Transparent, false) {
+			if paths.DistanceManhattan(p, q) <= lightRadius {
+				m.Lit[q] = true
+				delete(m.Dark, q)
+			}
+		}
+		i++
 	}
 }
 
 // RandomFloor returns a random floor cell in the map. It assumes that such a
 // floor cell exists (otherwise the function does not end).
 func (m *Map) RandomFloor() gruid.Point {
+	return m.randomFloor(m.rand)
+}
+
+// randomFloor returns a random floor cell drawn with the given generator.
+func (m *Map) randomFloor(r *rand.Rand) gruid.Point {
 	size := m.Grid.Size()
 	for {
-		freep := gruid.Point{m.rand.Intn(size.X), m.rand.Intn(size.Y)}
+		freep := gruid.Point{r.Intn(size.X), r.Intn(size.Y)}
 		if m.Grid.At(freep) == Floor {
 			return freep
 		}
@@ -0,0 +1,84 @@
+// This file implements a debug mode for visualizing the successive phases of
+// map generation, which is useful for tuning generation parameters.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/rl"
+	"github.com/anaseto/gruid/ui"
+)
+
+// mapGenDebug enables the map generation debug mode. It is set with the
+// -mapgen-debug command-line flag.
+var mapGenDebug bool
+
+// mapPhase records the state of the map grid after a generation phase.
+type mapPhase struct {
+	Name string
+	Grid rl.Grid
+}
+
+// recordPhase records the current state of the map grid as a new generation
+// phase, if map generation debug mode is enabled.
+func (m *Map) recordPhase(name string) {
+	if !mapGenDebug {
+		return
+	}
+	size := m.Grid.Size()
+	gd := rl.NewGrid(size.X, size.Y)
+	gd.Copy(m.Grid)
+	m.phases = append(m.phases, mapPhase{Name: name, Grid: gd})
+}
+
+// startMapGenDebug switches to map generation debug mode for the current
+// level, if enabled.
+func (m *model) startMapGenDebug() {
+	if !mapGenDebug || m.replaying {
+		return
+	}
+	m.mode = modeMapGenDebug
+	m.phase = 0
+}
+
+// updateMapGenDebug handles input messages in map generation debug mode: any
+// key advances to the next phase, and escape returns to normal mode.
+func (m *model) updateMapGenDebug(msg gruid.Msg) {
+	switch msg := msg.(type) {
+	case gruid.MsgKeyDown:
+		m.phase++
+		// The last phase shows spawn placement on the final map.
+		if msg.Key == gruid.KeyEscape || m.phase > len(m.game.Map.phases) {
+			m.mode = modeNormal
+		}
+	}
+}
+
+// DrawMapGenDebug draws the current map generation phase, ignoring the
+// player's field of view.
+func (m *model) DrawMapGenDebug() gruid.Grid {
+	m.grid.Fill(gruid.Cell{Rune: ' '})
+	mapgrid := m.grid.Slice(m.grid.Range().Shift(0, LogLines, 0, -1))
+	g := m.game
+	phases := g.Map.phases
+	gd := g.Map.Grid
+	name := "spawn placement"
+	if m.phase < len(phases) {
+		gd = phases[m.phase].Grid
+		name = phases[m.phase].Name
+	}
+	gd.Iter(func(p gruid.Point, c rl.Cell) {
+		mapgrid.Set(p, gruid.Cell{Rune: g.Map.Rune(c), Style: gruid.Style{Fg: g.Map.Color(c)}})
+	})
+	if m.phase >= len(phases) {
+		for i, p := range g.ECS.Positions {
+			c := mapgrid.At(p)
+			c.Rune, c.Style.Fg = g.ECS.GetStyle(i)
+			mapgrid.Set(p, c)
+		}
+	}
+	m.log.Content = ui.Textf("Map generation phase %d/%d: %s (press any key)",
+		m.phase+1, len(phases)+1, name).WithStyle(gruid.Style{Fg: ColorLogSpecial})
+	m.log.Draw(m.grid.Slice(m.grid.Range().Line(0)))
+	return m.grid
+}
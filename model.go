@@ -5,7 +5,8 @@
 package main
 
 import (
-	"math/rand"
+	"errors"
+	"fmt"
 	"sort"
 	"strings"
 	"time"
@@ -17,18 +18,45 @@ import (
 
 // model represents our main application's state.
 type model struct {
-	grid      gruid.Grid // drawing grid
-	game      *game      // game state
-	action    action     // UI action
-	mode      mode       // UI mode
-	log       *ui.Label  // label for log
-	status    *ui.Label  // label for status
-	desc      *ui.Label  // label for position description
-	inventory *ui.Menu   // inventory menu
-	viewer    *ui.Pager  // message's history viewer
-	targ      targeting  // targeting information
-	gameMenu  *ui.Menu   // game's main menu
-	info      *ui.Label  // info label in main menu (for errors)
+	grid      gruid.Grid    // drawing grid
+	game      *game         // game state
+	action    action        // UI action
+	mode      mode          // UI mode
+	log       *ui.Label     // label for log
+	status    *ui.Label     // label for status
+	desc      *ui.Label     // label for position description
+	itemDesc  *ui.Label     // item description pane
+	descBack  mode          // mode to return to from the item description
+	inventory *ui.Menu      // inventory menu
+	services  *ui.Menu      // NPC service menu
+	npc       int           // NPC offering services in service mode
+	viewer    *ui.Pager     // message's history viewer
+	journal   *ui.Pager     // quest journal
+	charsheet *ui.Pager     // character sheet
+	targ      targeting     // targeting information
+	gameMenu  *ui.Menu      // game's main menu
+	choices   []int         // main menu choice of each entry
+	saveFile  string        // save file of the last game, if any
+	info      *ui.Label     // info label in main menu (for errors)
+	phase     int           // current phase in map generation debug mode
+	diag      diagnostics   // diagnostics overlay (wizard mode)
+	hold      keyHold       // held movement key information
+	released  msgKeyUp      // last movement key release
+	ambient   int           // frame of ambient map effects
+	turnOrder bool          // whether the turn order strip is shown
+	worse     []int         // worse gear to drop in drop worse mode
+	marked    map[int]bool  // inventory entries marked in drop mode
+	vision    bool          // whether the monster vision overlay is shown
+	danger    bool          // whether the danger map overlay is shown
+	selection itemSelection // item selection information
+	events    *eventLog     // input log of the game (event log saves)
+	scenarios []*Scenario   // scenarios listed in the challenges menu
+	challenge *ui.Menu      // challenges menu
+	replaying bool          // whether an event log is being replayed
+	anim      *animation    // running animation, if any
+	layers    layers        // drawing layers of the map
+	prompt    *prompt       // current modal prompt, if any
+	title     *titleScreen  // title screen background
 }
 
 // targeting describes information related to examination or selection of
@@ -37,6 +65,8 @@ type targeting struct {
 	pos    gruid.Point
 	item   int // item to use after selecting target
 	radius int
+	fire   bool // whether the target is for shooting an arrow
+	throw  bool // whether the target is for throwing the item
 }
 
 // mode describes distinct kinds of modes for the UI. It is used to send user
@@ -46,32 +76,64 @@ type mode int
 
 const (
 	modeNormal mode = iota
-	modeEnd         // win or death (currently only death)
+	modeEnd         // win or death
 	modeInventoryActivate
 	modeInventoryDrop
+	modeInventoryEquip
+	modeInventoryThrow
 	modeGameMenu
 	modeMessageViewer
-	modeTargeting   // targeting mode (item use)
-	modeExamination // keyboad map examination mode
+	modeQuestJournal
+	modeCharacterSheet
+	modeService         // NPC service menu
+	modeTargeting       // targeting mode (item use, throwing or shooting)
+	modeExamination     // keyboad map examination mode
+	modeMapGenDebug     // map generation phases visualization
+	modeDropWorse       // confirmation of dropping worse gear
+	modeItemSelection   // choice of an item to act on (enchantment)
+	modeAutoPickup      // auto-pickup settings menu
+	modeItemDescription // item description pane
+	modeChallenges      // challenges menu (before starting a game)
+	modePrompt          // modal prompt (confirmation or input)
 )
 
 // Update implements gruid.Model.Update. It handles keyboard and mouse input
 // messages and updates the model in response to them.
 func (m *model) Update(msg gruid.Msg) gruid.Effect {
+	defer m.timeUpdate(time.Now())
 	switch msg.(type) {
 	case gruid.MsgInit:
 		return m.init()
+	case msgAnimFrame:
+		return m.nextAnimFrame()
+	case msgTitleTick:
+		return m.nextTitleFrame()
+	case msgAmbientTick:
+		return m.nextAmbientFrame()
+	case gruid.MsgQuit:
+		return m.Suspend()
+	case msgFocusLost:
+		return m.Pause()
 	}
+	m.recordEvent(msg)
+	if msg, ok := msg.(msgKeyUp); ok {
+		m.releaseKey(msg)
+		return nil
+	}
+	m.noteTurnInput(msg)
 	m.action = action{} // reset last action information
 	switch m.mode {
 	case modeGameMenu:
 		return m.updateGameMenu(msg)
+	case modeChallenges:
+		m.updateChallenges(msg)
+		return nil
 	case modeEnd:
 		switch msg := msg.(type) {
 		case gruid.MsgKeyDown:
 			switch msg.Key {
 			case "q", gruid.KeyEscape:
-				// You died: quit on "q" or "escape"
+				// You died or won: quit on "q" or "escape"
 				return gruid.End()
 			}
 		}
@@ -82,20 +144,56 @@ func (m *model) Update(msg gruid.Msg) gruid.Effect {
 			m.mode = modeNormal
 		}
 		return nil
-	case modeInventoryActivate, modeInventoryDrop:
+	case modeQuestJournal:
+		m.journal.Update(msg)
+		if m.journal.Action() == ui.PagerQuit {
+			m.mode = modeNormal
+		}
+		return nil
+	case modeCharacterSheet:
+		m.charsheet.Update(msg)
+		if m.charsheet.Action() == ui.PagerQuit {
+			m.mode = modeNormal
+		}
+		return nil
+	case modeInventoryActivate, modeInventoryDrop, modeInventoryEquip, modeInventoryThrow:
 		m.updateInventory(msg)
 		return nil
+	case modeService:
+		m.updateServices(msg)
+		return nil
+	case modeDropWorse:
+		m.updateDropWorse(msg)
+		return nil
+	case modeItemSelection:
+		m.updateItemSelection(msg)
+		return nil
+	case modeAutoPickup:
+		m.updateAutoPickupSettings(msg)
+		return nil
+	case modeItemDescription:
+		m.updateItemDescription(msg)
+		return nil
 	case modeTargeting, modeExamination:
-		m.updateTargeting(msg)
+		return m.updateTargeting(msg)
+	case modeMapGenDebug:
+		m.updateMapGenDebug(msg)
 		return nil
+	case modePrompt:
+		return m.updatePrompt(msg)
 	}
 	switch msg := msg.(type) {
 	case gruid.MsgKeyDown:
 		// Update action information on key down.
 		m.updateMsgKeyDown(msg)
 	case gruid.MsgMouse:
-		if msg.Action == gruid.MouseMove {
+		switch msg.Action {
+		case gruid.MouseMove:
 			m.targ.pos = msg.P
+		case gruid.MouseMain:
+			if msg.P.Y < LogLines {
+				m.clickLog(msg.P)
+			}
 		}
 	}
 	// Handle action (if any).
@@ -104,7 +202,10 @@ func (m *model) Update(msg gruid.Msg) gruid.Effect {
 
 const (
 	MenuNewGame = iota
+	MenuDailyGame
 	MenuContinue
+	MenuDeleteSave
+	MenuChallenges
 	MenuQuit
 )
 
@@ -114,20 +215,57 @@ func (m *model) init() gruid.Effect {
 	m.status = &ui.Label{}
 	m.info = &ui.Label{}
 	m.desc = &ui.Label{Box: &ui.Box{}}
+	m.layers = newLayers()
 	m.InitializeMessageViewer()
+	m.InitializeQuestJournal()
+	m.InitializeCharacterSheet()
 	m.mode = modeGameMenu
-	entries := []ui.MenuEntry{
-		MenuNewGame:  {Text: ui.Text("(N)ew game"), Keys: []gruid.Key{"N", "n"}},
-		MenuContinue: {Text: ui.Text("(C)ontinue last game"), Keys: []gruid.Key{"C", "c"}},
-		MenuQuit:     {Text: ui.Text("(Q)uit")},
-	}
-	m.gameMenu = ui.NewMenu(ui.MenuConfig{
-		Grid:    gruid.NewGrid(UIWidth/2, len(entries)+2),
-		Box:     &ui.Box{Title: ui.Text("Gruid Roguelike Tutorial")},
-		Entries: entries,
-		Style:   ui.MenuStyle{Active: gruid.Style{}.WithFg(ColorMenuActive)},
-	})
-	return nil
+	m.InitGameMenu()
+	m.title = newTitleScreen(time.Now().UnixNano())
+	return gruid.Batch(titleTickCmd(), ambientTickCmd())
+}
+
+// InitGameMenu builds the game's main menu, after checking the save of the
+// last game.
+func (m *model) InitGameMenu() {
+	m.buildGameMenu(probeSave())
+}
+
+// buildGameMenu builds the game's main menu for the given save file and
+// status. The continue entry is grayed out when there is no valid save, and
+// an entry for deleting the save is offered when it is corrupt.
+func (m *model) buildGameMenu(filename string, st saveStatus) {
+	m.saveFile = filename
+	m.choices = nil
+	entries := []pickerEntry{}
+	add := func(choice int, e pickerEntry) {
+		m.choices = append(m.choices, choice)
+		entries = append(entries, e)
+	}
+	add(MenuNewGame, pickerEntry{Text: "(N)ew game", Keys: []gruid.Key{"N", "n"}})
+	add(MenuDailyGame, pickerEntry{Text: "(D)aily game (seed of the day)", Keys: []gruid.Key{"D", "d"}})
+	cont := pickerEntry{Text: "(C)ontinue last game", Keys: []gruid.Key{"C", "c"}}
+	switch st {
+	case saveMissing:
+		cont.Text += " (no save)"
+		cont.Disabled = true
+	case saveCorrupt:
+		cont.Text += " (corrupt save)"
+		cont.Disabled = true
+	}
+	add(MenuContinue, cont)
+	if st == saveCorrupt && filename != replayFile {
+		add(MenuDeleteSave, pickerEntry{Text: "(X) Delete corrupt save", Keys: []gruid.Key{"X", "x"}})
+	}
+	add(MenuChallenges, pickerEntry{Text: "C(h)allenges", Keys: []gruid.Key{"H", "h"}})
+	add(MenuQuit, pickerEntry{Text: "(Q)uit"})
+	m.gameMenu = listPicker{
+		Title:     "Main Menu",
+		Entries:   entries,
+		Width:     UIWidth / 2,
+		Height:    len(entries) + 2,
+		Highlight: true,
+	}.Menu()
 }
 
 // updateGameMenu updates the Game Menu and switchs mode to normal after
@@ -140,25 +278,58 @@ func (m *model) updateGameMenu(msg gruid.Msg) gruid.Effect {
 		m.info.SetText("")
 	case ui.MenuInvoke:
 		m.info.SetText("")
-		switch m.gameMenu.Active() {
+		switch m.choices[m.gameMenu.Active()] {
 		case MenuNewGame:
-			m.game = NewGame()
-			m.mode = modeNormal
+			m.PromptText("What is your name?", "", maxNameLength, func(name string) gruid.Effect {
+				g := NewGame()
+				g.SetPlayerName(name)
+				m.StartGame(g)
+				if arenaSpec != "" {
+					if err := m.game.EnterArena(arenaSpec); err != nil {
+						m.game.Logf("%v", ColorLogSpecial, err)
+					}
+				}
+				return nil
+			})
+		case MenuDailyGame:
+			m.PromptText("What is your name?", "", maxNameLength, func(name string) gruid.Effect {
+				g := NewGameWithSeed(dailySeed(time.Now()), NewRunOptions())
+				g.SetPlayerName(name)
+				m.StartGame(g)
+				return nil
+			})
+		case MenuChallenges:
+			m.OpenChallenges()
 		case MenuContinue:
-			data, err := LoadFile("save")
+			if replayFile != "" || m.hasEventLog() {
+				m.continueEventLog()
+				break
+			}
+			data, err := LoadFile(saveFile)
 			if err != nil {
 				m.info.SetText(err.Error())
+				m.InitGameMenu()
 				break
 			}
 			g, err := DecodeGame(data)
 			if err != nil {
 				m.info.SetText(err.Error())
+				m.buildGameMenu(saveFile, saveCorrupt)
 				break
 			}
 			m.game = g
+			m.game.CheckRunOptions()
 			m.mode = modeNormal
-			// the random number generator is not saved
-			m.game.Map.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+		case MenuDeleteSave:
+			m.Confirm("Really delete the corrupt save?", func() gruid.Effect {
+				if err := RemoveDataFile(m.saveFile); err != nil {
+					m.info.SetText(err.Error())
+					return nil
+				}
+				m.InitGameMenu()
+				m.info.SetText("Deleted the corrupt save.")
+				return nil
+			})
 		case MenuQuit:
 			return gruid.End()
 		}
@@ -168,9 +339,47 @@ func (m *model) updateGameMenu(msg gruid.Msg) gruid.Effect {
 	return nil
 }
 
+// StartGame starts playing the given new game.
+func (m *model) StartGame(g *game) {
+	m.game = g
+	m.events = nil
+	if g.Options.EventLog {
+		m.events = &eventLog{Seed: g.Seed, Options: g.Options, Scenario: g.Scenario, Name: g.ECS.Name[g.ECS.PlayerID]}
+	}
+	m.mode = modeNormal
+	m.startMapGenDebug()
+}
+
+// hasEventLog reports whether the last game was saved as an event log.
+func (m *model) hasEventLog() bool {
+	_, err := LoadFile(eventsFile)
+	return err == nil
+}
+
+// continueEventLog continues the last game saved as an event log, or the
+// game of the -replay file, by re-simulating it.
+func (m *model) continueEventLog() {
+	filename := eventsFile
+	if replayFile != "" {
+		filename = replayFile
+	}
+	el, err := LoadEvents(filename)
+	if err != nil {
+		m.info.SetText(err.Error())
+		m.buildGameMenu(filename, saveCorrupt)
+		return
+	}
+	if err := m.Replay(el); err != nil {
+		m.game.Logf("%v", ColorLogSpecial, err)
+	}
+	if m.mode == modeNormal {
+		m.game.CheckRunOptions()
+	}
+}
+
 // updateTargeting updates targeting information in response to user input
 // messages.
-func (m *model) updateTargeting(msg gruid.Msg) {
+func (m *model) updateTargeting(msg gruid.Msg) gruid.Effect {
 	maprg := gruid.NewRange(0, LogLines, UIWidth, UIHeight-1)
 	if !m.targ.pos.In(maprg) {
 		m.targ.pos = m.game.ECS.PP().Add(maprg.Min)
@@ -187,16 +396,25 @@ func (m *model) updateTargeting(msg gruid.Msg) {
 			p = p.Shift(0, -1)
 		case gruid.KeyArrowRight, "l":
 			p = p.Shift(1, 0)
-		case gruid.KeyEnter, ".":
+		case gruid.KeyEnter, ".", "?":
 			if m.mode == modeExamination {
+				if i, ok := m.game.ExaminedItem(p); ok {
+					m.OpenItemDescription(i)
+				}
 				break
 			}
-			m.activateTarget(p)
-			return
+			if msg.Key == "?" {
+				break
+			}
+			return m.activateTarget(p)
+		case "v":
+			if m.mode == modeExamination {
+				m.ToggleMonsterVision()
+			}
 		case gruid.KeyEscape, "q":
 			m.targ = targeting{}
 			m.mode = modeNormal
-			return
+			return nil
 		}
 		m.targ.pos = p.Add(maprg.Min)
 	case gruid.MsgMouse:
@@ -204,24 +422,151 @@ func (m *model) updateTargeting(msg gruid.Msg) {
 		case gruid.MouseMove:
 			m.targ.pos = msg.P
 		case gruid.MouseMain:
-			m.activateTarget(p)
+			return m.activateTarget(p)
+		}
+	}
+	return nil
+}
+
+func (m *model) activateTarget(p gruid.Point) gruid.Effect {
+	if m.targ.fire {
+		return m.fireAt(p)
+	}
+	if m.targ.throw {
+		return m.throwAt(p)
+	}
+	if m.targ.radius > 0 {
+		if friends := m.game.FriendlyFire(p, m.targ.radius); len(friends) > 0 {
+			// Answering no returns to targeting, so that the player
+			// can choose another target.
+			m.Confirm(m.friendlyFireQuestion(friends), func() gruid.Effect {
+				return m.useTargetedItem(p)
+			})
+			return nil
+		}
+	}
+	return m.useTargetedItem(p)
+}
+
+// friendlyFireQuestion returns the confirmation question for an area effect
+// that would hit the given friends.
+func (m *model) friendlyFireQuestion(friends []int) string {
+	names := []string{}
+	for _, i := range friends {
+		if i == m.game.ECS.PlayerID {
+			names = append(names, "you")
+			continue
 		}
+		names = append(names, "your "+m.game.ECS.GetName(i))
 	}
+	return "The blast would hit " + strings.Join(names, " and ") + ". Really?"
 }
 
-func (m *model) activateTarget(p gruid.Point) {
+// useTargetedItem uses the targeted item at p.
+func (m *model) useTargetedItem(p gruid.Point) gruid.Effect {
+	var name string
+	if inv := m.game.ECS.Inventory[m.game.ECS.PlayerID]; m.targ.item < len(inv.Items) {
+		name = m.game.ECS.Name[inv.Items[m.targ.item]]
+	}
+	var eff gruid.Effect
 	err := m.game.InventoryActivateWithTarget(m.game.ECS.PlayerID, m.targ.item, &p)
 	if err != nil {
 		m.game.Logf("%v", ColorLogSpecial, err)
+		// Show the path of the effect up to the wall that blocks it.
+		var be *blockedError
+		if errors.As(err, &be) {
+			eff = m.StartAnimation(be.Path, '*')
+		}
 	} else {
+		m.game.RememberTarget(p, name)
 		m.game.EndTurn()
 	}
 	m.mode = modeNormal
 	m.targ = targeting{}
+	return eff
+}
+
+// fireAt shoots an arrow at p, and starts the animation of the shot.
+func (m *model) fireAt(p gruid.Point) gruid.Effect {
+	m.mode = modeNormal
+	m.targ = targeting{}
+	path, err := m.game.Fire(m.game.ECS.PlayerID, p)
+	if err != nil {
+		m.game.Logf("%v", ColorLogSpecial, err)
+		return nil
+	}
+	m.game.RememberShot(p)
+	m.game.EndTurn()
+	return m.StartAnimation(path, '*')
+}
+
+// throwAt throws the targeted item at p, and starts the animation of the
+// throw.
+func (m *model) throwAt(p gruid.Point) gruid.Effect {
+	n := m.targ.item
+	m.mode = modeNormal
+	m.targ = targeting{}
+	path, err := m.game.Throw(m.game.ECS.PlayerID, n, p)
+	if err != nil {
+		m.game.Logf("%v", ColorLogSpecial, err)
+		return nil
+	}
+	m.game.EndTurn()
+	return m.StartAnimation(path, '!')
+}
+
+// dropTitle is the title of the drop menu.
+const dropTitle = "Drop items (space to mark)"
+
+// toggleDropMark marks or unmarks the n-th inventory entry for dropping, and
+// refreshes the drop menu.
+func (m *model) toggleDropMark(n int) {
+	if n < 0 || n >= len(m.game.ECS.Inventory[m.game.ECS.PlayerID].Items) {
+		return
+	}
+	if m.marked == nil {
+		m.marked = map[int]bool{}
+	}
+	if m.marked[n] {
+		delete(m.marked, n)
+	} else {
+		m.marked[n] = true
+	}
+	m.OpenInventory(dropTitle)
+	m.inventory.SetActive(n)
+}
+
+// dropMarked drops all the inventory items marked in the drop menu, in one
+// turn.
+func (m *model) dropMarked() {
+	inv := m.game.ECS.Inventory[m.game.ECS.PlayerID]
+	items := []int{}
+	for n, i := range inv.Items {
+		if m.marked[n] {
+			items = append(items, i)
+		}
+	}
+	m.marked = nil
+	m.mode = modeNormal
+	if err := m.game.DropItems(m.game.ECS.PlayerID, items); err != nil {
+		m.game.Logf("%v", ColorLogSpecial, err)
+	}
+	m.game.EndTurn()
 }
 
 // updateInventory handles input messages when the inventory window is open.
 func (m *model) updateInventory(msg gruid.Msg) {
+	if msg, ok := msg.(gruid.MsgKeyDown); ok && msg.Key == "?" {
+		inv := m.game.ECS.Inventory[m.game.ECS.PlayerID]
+		if n := m.inventory.Active(); n >= 0 && n < len(inv.Items) {
+			m.OpenItemDescription(inv.Items[n])
+		}
+		return
+	}
+	if msg, ok := msg.(gruid.MsgKeyDown); ok && msg.Key == gruid.KeySpace && m.mode == modeInventoryDrop {
+		m.toggleDropMark(m.inventory.Active())
+		return
+	}
 	// We call the Update function of the menu widget, so that we can
 	// inspect information about user activity on the menu.
 	m.inventory.Update(msg)
@@ -234,15 +579,62 @@ func (m *model) updateInventory(msg gruid.Msg) {
 		// The user invoked a particular entry of the menu (either by
 		// using enter or clicking on it).
 		n := m.inventory.Active()
+		if m.mode == modeInventoryDrop && len(m.marked) > 0 {
+			// With marked items, letters mark more items, and
+			// enter drops all of them.
+			if msg, ok := msg.(gruid.MsgKeyDown); ok && msg.Key != gruid.KeyEnter {
+				m.toggleDropMark(n)
+				return
+			}
+			m.dropMarked()
+			return
+		}
 		var err error
 		switch m.mode {
 		case modeInventoryDrop:
+			if count := m.game.StackCount(m.game.ECS.PlayerID, n); count > 1 {
+				m.mode = modeNormal
+				m.PromptNumber("Drop how many?", count, count, func(k int) gruid.Effect {
+					if err := m.game.DropArrows(m.game.ECS.PlayerID, n, k); err != nil {
+						m.game.Logf("%v", ColorLogSpecial, err)
+						return nil
+					}
+					m.game.EndTurn()
+					return nil
+				})
+				return
+			}
 			err = m.game.InventoryRemove(m.game.ECS.PlayerID, n)
+		case modeInventoryEquip:
+			err = m.game.ToggleEquip(m.game.ECS.PlayerID, n)
+		case modeInventoryThrow:
+			if err = m.game.CheckThrow(m.game.ECS.PlayerID, n); err != nil {
+				break
+			}
+			p, ok := m.game.LastTargetPos()
+			if !ok {
+				p = m.game.ECS.PP()
+			}
+			m.targ = targeting{item: n, pos: p.Shift(0, LogLines), throw: true}
+			m.mode = modeTargeting
+			return
 		case modeInventoryActivate:
+			if m.game.SelectsItem(m.game.ECS.PlayerID, n) {
+				if err = m.OpenItemSelection(n); err == nil {
+					return
+				}
+				break
+			}
 			if radius := m.game.TargetingRadius(n); radius >= 0 {
+				// The cursor starts on the last targeted
+				// monster, if still in view.
+				p, ok := m.game.LastTargetPos()
+				if !ok {
+					p = m.game.ECS.PP()
+				}
 				m.targ = targeting{
 					item:   n,
-					pos:    m.game.ECS.PP().Shift(0, LogLines),
+					pos:    p.Shift(0, LogLines),
 					radius: radius,
 				}
 				m.mode = modeTargeting
@@ -260,6 +652,9 @@ func (m *model) updateInventory(msg gruid.Msg) {
 }
 
 func (m *model) updateMsgKeyDown(msg gruid.MsgKeyDown) {
+	if m.skipKeyRepeat(msg) {
+		return
+	}
 	pdelta := gruid.Point{}
 	m.targ.pos = gruid.Point{}
 	switch msg.Key {
@@ -287,6 +682,58 @@ func (m *model) updateMsgKeyDown(msg gruid.MsgKeyDown) {
 		m.action = action{Type: ActionPickup}
 	case "x":
 		m.action = action{Type: ActionExamine}
+	case ">":
+		m.action = action{Type: ActionDescend}
+	case "<":
+		m.action = action{Type: ActionAscend}
+	case "c":
+		m.action = action{Type: ActionDestroyCorpse}
+	case "e":
+		m.action = action{Type: ActionEquip}
+	case "J":
+		m.action = action{Type: ActionViewQuests}
+	case "C":
+		m.action = action{Type: ActionViewCharacter}
+	case "o":
+		m.action = action{Type: ActionOrderAllies}
+	case gruid.KeySpace:
+		m.action = action{Type: ActionInteract}
+	case "T":
+		m.turnOrder = !m.turnOrder
+	case "H":
+		m.danger = !m.danger
+	case "G":
+		m.action = action{Type: ActionTravel}
+	case "E":
+		m.action = action{Type: ActionAutoEquip}
+	case "W":
+		m.action = action{Type: ActionDropWorse}
+	case "r":
+		m.action = action{Type: ActionRepeatTarget}
+	case "f":
+		m.action = action{Type: ActionFire}
+	case "b":
+		m.action = action{Type: ActionBash}
+	case "t":
+		m.action = action{Type: ActionThrow}
+	case "P":
+		m.action = action{Type: ActionAutoPickup}
+	case "B":
+		m.action = action{Type: ActionExportTurns}
+	case "D":
+		if m.game.Options.Wizard {
+			m.diag.Show = !m.diag.Show
+		}
+	case "L":
+		if m.game.Options.Wizard {
+			m.game.ReportLeaks()
+		}
+	case "A":
+		if m.game.Options.Wizard {
+			if err := m.game.EnterArena(arenaSpec); err != nil {
+				m.game.Logf("%v", ColorLogSpecial, err)
+			}
+		}
 	}
 }
 
@@ -294,6 +741,7 @@ func (m *model) updateMsgKeyDown(msg gruid.MsgKeyDown) {
 // we use for default foreground and background.
 const (
 	ColorFOV gruid.Color = iota + 1
+	ColorDarkFOV
 	ColorPlayer
 	ColorMonster
 	ColorLogPlayerAttack
@@ -304,6 +752,23 @@ const (
 	ColorStatusWounded
 	ColorConsumable
 	ColorMenuActive
+	ColorFoliage
+	ColorBones
+	ColorMushrooms
+	ColorPool
+	ColorBrazier
+	ColorBridge
+	ColorZombie
+	ColorNPC
+	ColorUnique
+	ColorLogAbility
+	ColorAlly
+	ColorMonsterVision
+	ColorDangerLow
+	ColorDangerMedium
+	ColorDangerHigh
+	ColorPoison
+	ColorFire
 )
 
 const (
@@ -313,30 +778,70 @@ const (
 // Draw implements gruid.Model.Draw. It draws a simple map that spans the whole
 // grid.
 func (m *model) Draw() gruid.Grid {
+	defer m.timeDraw(time.Now())
 	mapgrid := m.grid.Slice(m.grid.Range().Shift(0, LogLines, 0, -1))
 	switch m.mode {
 	case modeGameMenu:
 		return m.DrawGameMenu()
+	case modeChallenges:
+		m.grid.Fill(gruid.Cell{Rune: ' '})
+		m.grid.Copy(m.challenge.Draw())
+		m.info.Draw(m.grid.Slice(m.grid.Range().Lines(UIHeight-3, UIHeight)))
+		return m.grid
 	case modeMessageViewer:
 		m.grid.Copy(m.viewer.Draw())
 		return m.grid
-	case modeInventoryDrop, modeInventoryActivate:
+	case modeQuestJournal:
+		m.grid.Copy(m.journal.Draw())
+		return m.grid
+	case modeCharacterSheet:
+		m.grid.Copy(m.charsheet.Draw())
+		return m.grid
+	case modeInventoryDrop, modeInventoryActivate, modeInventoryEquip, modeInventoryThrow, modeDropWorse, modeItemSelection, modeAutoPickup:
 		mapgrid.Copy(m.inventory.Draw())
 		return m.grid
+	case modeService:
+		mapgrid.Copy(m.services.Draw())
+		return m.grid
+	case modeMapGenDebug:
+		return m.DrawMapGenDebug()
+	case modeEnd:
+		if m.game.Won {
+			return m.DrawVictory()
+		}
+	case modeItemDescription:
+		switch m.descBack {
+		case modeInventoryDrop, modeInventoryActivate, modeInventoryEquip, modeInventoryThrow:
+			mapgrid.Copy(m.inventory.Draw())
+			m.DrawItemDescription(mapgrid)
+			return m.grid
+		}
+	case modePrompt:
+		if !m.playing() {
+			m.DrawGameMenu()
+			m.DrawPrompt(m.grid)
+			return m.grid
+		}
 	}
 	m.grid.Fill(gruid.Cell{Rune: ' '})
+	m.layers.Clear()
 	g := m.game
-	// We draw the map tiles.
+	// We draw the map tiles and entities in the map layer.
+	ml := m.layers.Map
 	it := g.Map.Grid.Iterator()
 	for it.Next() {
 		if !g.Map.Explored[it.P()] {
 			continue
 		}
 		c := gruid.Cell{Rune: g.Map.Rune(it.Cell())}
+		c.Style.Fg = g.Map.Color(it.Cell())
 		if g.InFOV(it.P()) {
 			c.Style.Bg = ColorFOV
+			if g.Map.Dark[it.P()] {
+				c.Style.Bg = ColorDarkFOV
+			}
 		}
-		mapgrid.Set(it.P(), c)
+		ml.Set(it.P(), c)
 	}
 	// We sort entity indexes using the render ordering.
 	sortedEntities := make([]int, 0, len(g.ECS.Entities))
@@ -349,28 +854,48 @@ func (m *model) Draw() gruid.Grid {
 	// We draw the sorted entities.
 	for _, i := range sortedEntities {
 		p := g.ECS.Positions[i]
-		if !g.Map.Explored[p] || !g.InFOV(p) {
+		if !g.Map.Explored[p] || !g.InFOV(p) || g.Unseen(i) {
 			continue
 		}
-		c := mapgrid.At(p)
+		c := ml.At(p)
 		c.Rune, c.Style.Fg = g.ECS.GetStyle(i)
-		mapgrid.Set(p, c)
+		ml.Set(p, c)
 		// NOTE: We retrieved current cell at e.Pos() to preserve
 		// background (in FOV or not).
 	}
-	m.DrawNames(mapgrid)
+	// Highlights and animations go in the effects layer, popups and
+	// other overlays in the UI layer.
+	m.DrawAmbient(m.layers.Effects)
+	m.DrawDanger(m.layers.Effects)
+	m.DrawMonsterVision(m.layers.Effects)
+	m.DrawTargetHighlight(m.layers.Effects)
+	m.DrawAIStates(m.layers.Effects)
+	m.DrawAnimation(m.layers.Effects)
+	m.DrawTurnOrder(m.layers.UI)
+	m.DrawNames(m.layers.UI)
+	m.DrawDiagnostics(m.layers.UI)
+	switch m.mode {
+	case modePrompt:
+		m.DrawPrompt(m.layers.UI)
+	case modeItemDescription:
+		m.DrawItemDescription(m.layers.UI)
+	}
+	m.layers.Composite(mapgrid)
 	m.DrawLog(m.grid.Slice(m.grid.Range().Lines(0, LogLines)))
 	m.DrawStatus(m.grid.Slice(m.grid.Range().Line(m.grid.Size().Y - 1)))
+	m.DrawWarnings(m.grid.Slice(m.grid.Range().Line(m.grid.Size().Y - 1)))
 	return m.grid
 }
 
 var mainMenuAnchor = gruid.Point{10, 6}
 
-// DrawGameMenu draws the game's main menu.
+// DrawGameMenu draws the game's main menu on the title screen.
 func (m *model) DrawGameMenu() gruid.Grid {
 	m.grid.Fill(gruid.Cell{Rune: ' '})
+	m.title.Draw(m.grid)
+	m.DrawTitle(m.grid)
 	m.grid.Slice(m.gameMenu.Bounds().Add(mainMenuAnchor)).Copy(m.gameMenu.Draw())
-	m.info.Draw(m.grid.Slice(m.grid.Range().Line(12).Shift(10, 0, 0, 0)))
+	m.info.Draw(m.grid.Slice(m.grid.Range().Line(14).Shift(10, 0, 0, 0)))
 	return m.grid
 }
 
@@ -382,9 +907,7 @@ func (m *model) DrawLog(gd gruid.Grid) {
 			break
 		}
 		e := m.game.Log[i]
-		st := gruid.Style{}
-		st.Fg = e.Color
-		m.log.Content = ui.NewStyledText(e.String(), st)
+		m.log.Content = e.StyledText()
 		m.log.Draw(gd.Slice(gd.Range().Line(j)))
 		j--
 	}
@@ -399,13 +922,47 @@ func (m *model) DrawStatus(gd gruid.Grid) {
 	if f.HP < f.MaxHP/2 {
 		st.Fg = ColorStatusWounded
 	}
-	m.log.Content = ui.Textf("HP: %d/%d", f.HP, f.MaxHP).WithStyle(st)
+	// A “+” after HP means the player regenerated recently.
+	regen := ""
+	if r := g.ECS.Regen[g.ECS.PlayerID]; r != nil && r.Shown > 0 {
+		regen = "+"
+	}
+	// Poison and burning are shown with their remaining turns, in their
+	// own color.
+	poison := ""
+	if g.ECS.Status(g.ECS.PlayerID, StatusPoisoned) {
+		poison = fmt.Sprintf(" @pPoison:%d@N", g.ECS.Statuses[g.ECS.PlayerID][StatusPoisoned])
+	}
+	if g.ECS.Status(g.ECS.PlayerID, StatusBurning) {
+		poison += fmt.Sprintf(" @fBurning:%d@N", g.ECS.Statuses[g.ECS.PlayerID][StatusBurning])
+	}
+	// The readied bow, if any, is shown with the arrows left, in the
+	// wounded color when there are none.
+	ranged := ""
+	if g.EquippedBow(g.ECS.PlayerID) != nil {
+		if n := g.Ammo(g.ECS.PlayerID); n > 0 {
+			ranged = fmt.Sprintf(" Bow:%d", n)
+		} else {
+			ranged = " @wBow:0@N"
+		}
+	}
+	var text string
+	if g.Depth == 0 {
+		text = fmt.Sprintf("Town HP: %d/%d%s%s%s $%d", f.HP, f.MaxHP, regen, poison, ranged, g.ECS.Player().Gold)
+	} else {
+		text = fmt.Sprintf("Depth: %d HP: %d/%d%s%s%s $%d Explored: %d%% Hostiles: %d",
+			g.Depth, f.HP, f.MaxHP, regen, poison, ranged, g.ECS.Player().Gold, g.Map.ExploredPercent(), g.ECS.HostilesLeft())
+	}
+	m.log.Content = ui.NewStyledText(text, st).
+		WithMarkup('p', st.WithFg(ColorPoison)).
+		WithMarkup('f', st.WithFg(ColorFire)).
+		WithMarkup('w', st.WithFg(ColorStatusWounded))
 	m.log.Draw(gd)
 }
 
-// DrawNames renders the names of the named entities at current mouse location
-// if it is in the map.
-func (m *model) DrawNames(gd gruid.Grid) {
+// DrawTargetHighlight highlights the area around the current mouse or
+// targeting location, if it is in the map.
+func (m *model) DrawTargetHighlight(gd gruid.Grid) {
 	maprg := gruid.NewRange(0, LogLines, UIWidth, UIHeight-1)
 	if !m.targ.pos.In(maprg) {
 		return
@@ -414,15 +971,21 @@ func (m *model) DrawNames(gd gruid.Grid) {
 	rad := m.targ.radius
 	rg := gruid.Range{Min: p.Sub(gruid.Point{rad, rad}), Max: p.Add(gruid.Point{rad + 1, rad + 1})}
 	rg = rg.Intersect(maprg.Sub(maprg.Min))
-	rg.Iter(func(q gruid.Point) {
-		c := gd.At(q)
-		c.Style.Attrs |= AttrReverse
-		gd.Set(q, c)
-	})
+	gd.Slice(rg).Fill(gruid.Cell{Style: gruid.Style{Attrs: AttrReverse}})
+}
+
+// DrawNames renders the names of the named entities at current mouse location
+// if it is in the map.
+func (m *model) DrawNames(gd gruid.Grid) {
+	maprg := gruid.NewRange(0, LogLines, UIWidth, UIHeight-1)
+	if !m.targ.pos.In(maprg) {
+		return
+	}
+	p := m.targ.pos.Sub(maprg.Min)
 	// We get the names of the entities at p.
 	names := []string{}
-	for i, q := range m.game.ECS.Positions {
-		if q != p || !m.game.InFOV(q) {
+	for _, i := range m.game.ECS.EntitiesAt(p) {
+		if !m.game.InFOV(p) || m.game.Unseen(i) {
 			continue
 		}
 		name := m.game.ECS.GetName(i)
@@ -430,17 +993,23 @@ func (m *model) DrawNames(gd gruid.Grid) {
 			names = append(names, name)
 		}
 	}
-	if len(names) == 0 {
-		return
-	}
 	// We sort the names. This could be improved to sort by entity type
 	// too, as well as to remove duplicates (for example showing “corpse
 	// (3x)” if there are three corpses).
 	sort.Strings(names)
+	// We add the name of the terrain feature at p, if any.
+	if m.game.Map.Explored[p] {
+		if name := m.game.Map.Name(m.game.Map.Grid.At(p)); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
 
 	text := strings.Join(names, ", ")
 	width := utf8.RuneCountInString(text) + 2
-	rg = gruid.NewRange(p.X+1, p.Y-1, p.X+1+width, p.Y+2)
+	rg := gruid.NewRange(p.X+1, p.Y-1, p.X+1+width, p.Y+2)
 	// we adjust a bit the box's placement in case it's on a edge.
 	if p.X+1+width >= UIWidth {
 		rg = rg.Shift(-1-width, 0, -1-width, 0)
@@ -0,0 +1,68 @@
+// This file implements the monster vision overlay of the examination mode:
+// when examining a visible monster, the cells from which it would notice the
+// player are highlighted, helping players plan stealthy approaches and
+// flanking.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/rl"
+)
+
+// MonsterVision returns the cells monster i can currently see, that is, the
+// cells from which a player would be noticed by the monster. Vision is
+// symmetric: it mirrors the rule used by AITarget, for which a monster
+// notices the player when the player can see the monster.
+func (g *game) MonsterVision(i int) []gruid.Point {
+	p := g.ECS.Positions[i]
+	rg := gruid.NewRange(-maxLOS, -maxLOS, maxLOS+1, maxLOS+1)
+	fov := rl.NewFOV(rg.Add(p).Intersect(g.Map.Grid.Range()))
+	cells := []gruid.Point{}
+	for _, q := range fov.SSCVisionMap(p, maxLOS, g.Map.Transparent, false) {
+		// A monster in a dark zone is only noticed, and so only
+		// notices, from nearby.
+		if g.inSight(q, p) {
+			cells = append(cells, q)
+		}
+	}
+	return cells
+}
+
+// ToggleMonsterVision shows or hides the monster vision overlay.
+func (m *model) ToggleMonsterVision() {
+	m.vision = !m.vision
+	state := "off"
+	if m.vision {
+		state = "on"
+	}
+	m.game.Logf("Monster vision overlay: %s.", ColorLogSpecial, state)
+}
+
+// DrawMonsterVision highlights, in examination mode, the explored cells seen
+// by the examined monster, if the overlay is enabled.
+func (m *model) DrawMonsterVision(gd gruid.Grid) {
+	if !m.vision || m.mode != modeExamination {
+		return
+	}
+	maprg := gruid.NewRange(0, LogLines, UIWidth, UIHeight-1)
+	if !m.targ.pos.In(maprg) {
+		return
+	}
+	g := m.game
+	p := m.targ.pos.Sub(maprg.Min)
+	i := g.ECS.MonsterAt(p)
+	if i < 0 || i == g.ECS.PlayerID || !g.ECS.Alive(i) || !g.InFOV(p) || g.Unseen(i) {
+		return
+	}
+	for _, q := range g.MonsterVision(i) {
+		if !g.Map.Explored[q] {
+			continue
+		}
+		// We keep the map's rune and foreground, changing only the
+		// background.
+		c := m.layers.Map.At(q)
+		c.Style.Bg = ColorMonsterVision
+		gd.Set(q, c)
+	}
+}
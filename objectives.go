@@ -0,0 +1,95 @@
+// This file implements optional per-level bonus objectives, rewarded when
+// leaving the level.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+)
+
+// objectiveKind represents a kind of level objective.
+type objectiveKind int
+
+// These constants represent the available kinds of level objectives.
+const (
+	ObjectiveClear objectiveKind = iota // kill all the monsters
+	ObjectiveVault                      // find the hidden vault
+)
+
+// Objective represents an optional bonus objective for the current level.
+type Objective struct {
+	Kind   objectiveKind
+	Vault  gruid.Point // vault position (vault objectives)
+	Reward int         // gold reward
+	Done   bool
+}
+
+// Description returns a description of the objective.
+func (o *Objective) Description() string {
+	switch o.Kind {
+	case ObjectiveVault:
+		return "find the hidden vault"
+	default:
+		return "clear all monsters"
+	}
+}
+
+// objectiveChance is the percentage chance for a level without a vault to
+// have an objective.
+const objectiveChance = 50
+
+// NewObjective generates an objective for the current level, if any. Levels
+// with a hidden vault always get a vault objective.
+func (g *game) NewObjective() {
+	g.Objective = nil
+	for _, p := range g.Map.Placements[PlaceVault] {
+		if g.Map.Walkable(p) {
+			g.Objective = &Objective{Kind: ObjectiveVault, Vault: p, Reward: 5 + 2*g.Depth}
+			break
+		}
+	}
+	if g.Objective == nil && g.Rand(RNGMapgen).Intn(100) < objectiveChance {
+		g.Objective = &Objective{Kind: ObjectiveClear, Reward: 10 + 2*g.Depth}
+	}
+}
+
+func init() {
+	registerTurnHook(turnHook{Name: "objective", Order: turnStart + 2, Run: (*game).UpdateObjective})
+}
+
+// UpdateObjective checks whether the current level objective has been
+// fulfilled.
+func (g *game) UpdateObjective() {
+	o := g.Objective
+	if o == nil || o.Done {
+		return
+	}
+	switch o.Kind {
+	case ObjectiveClear:
+		if g.ECS.HostilesLeft() > 0 {
+			return
+		}
+	case ObjectiveVault:
+		if !g.InFOV(o.Vault) {
+			return
+		}
+	}
+	o.Done = true
+	g.Logf("Bonus objective fulfilled: %s.", ColorLogSpecial, o.Description())
+}
+
+// ReportObjective reports on the objective of the level the player is
+// leaving, granting the reward if it was fulfilled.
+func (g *game) ReportObjective() {
+	o := g.Objective
+	if o == nil {
+		return
+	}
+	if o.Done {
+		g.ECS.Player().Gold += o.Reward
+		g.Logf("Level objective “%s” completed (+%d gold).", ColorLogSpecial, o.Description(), o.Reward)
+	} else {
+		g.Logf("Level objective “%s” failed.", ColorLogSpecial, o.Description())
+	}
+	g.Objective = nil
+}
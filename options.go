@@ -0,0 +1,39 @@
+// This file handles run options: options affecting gameplay that are chosen
+// when starting a new game and saved along with it.
+
+package main
+
+// RunOptions contains the gameplay-affecting options of a run. They are
+// taken from the command-line flags when starting a new game, and saved with
+// the game, so that loading a game restores its rules even if the flags
+// changed since.
+type RunOptions struct {
+	Wizard   bool // wizard mode (the run is not scored)
+	EventLog bool // save the seed and player input instead of a snapshot
+}
+
+// NewRunOptions returns run options from the current command-line flags.
+func NewRunOptions() RunOptions {
+	// The arena is a wizard mode feature.
+	return RunOptions{Wizard: wizard || arenaSpec != "", EventLog: eventLogSaves}
+}
+
+// String returns a short description of the run's options.
+func (o RunOptions) String() string {
+	s := "standard"
+	if o.Wizard {
+		s = "wizard mode (unscored)"
+	}
+	if o.EventLog {
+		s += ", event log saves"
+	}
+	return s
+}
+
+// CheckRunOptions logs a notice if the options of a loaded game differ from
+// the ones given by the current command-line flags.
+func (g *game) CheckRunOptions() {
+	if g.Options != NewRunOptions() {
+		g.Logf("This game was started with other options: %s.", ColorLogSpecial, g.Options)
+	}
+}
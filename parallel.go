@@ -0,0 +1,103 @@
+// This file implements concurrent computation of monster paths. Paths are
+// planned from a read-only snapshot of the world at the start of the monsters
+// phase, and then used by monsters as they act in order.
+
+package main
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// parallelMinJobs is the minimum number of path computations for which
+// planning is done concurrently: for fewer paths, the overhead is not worth
+// it, and paths are computed when needed instead.
+const parallelMinJobs = 8
+
+// pathJob describes a path computation for a monster.
+type pathJob struct {
+	I        int         // moving monster
+	From, To gruid.Point // path extremities
+	Path     []gruid.Point
+}
+
+// PlanPaths computes concurrently the chase paths that the given monsters,
+// ordered by entity index, are expected to need this turn. Computations count
+// against the turn's AI budget. No world state is modified until all
+// workers are done, so the result does not depend on scheduling.
+func (g *game) PlanPaths(monsters []int) {
+	g.planned = nil
+	jobs := []pathJob{}
+	for _, i := range monsters {
+		if g.budget.paths <= len(jobs) {
+			break
+		}
+		if to, ok := g.chaseDestination(i); ok {
+			jobs = append(jobs, pathJob{I: i, From: g.ECS.Positions[i], To: to})
+		}
+	}
+	if len(jobs) < parallelMinJobs {
+		return
+	}
+	g.budget.paths -= len(jobs)
+	workers := runtime.NumCPU()
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// Path ranges cache state, so each worker needs its
+			// own.
+			pr := paths.NewPathRange(g.Map.Grid.Range())
+			for k := w; k < len(jobs); k += workers {
+				job := &jobs[k]
+				job.Path = pr.AstarPath(&aiPath{g: g, i: job.I}, job.From, job.To)
+			}
+		}(w)
+	}
+	wg.Wait()
+	g.planned = make(map[int]pathJob, len(jobs))
+	for _, job := range jobs {
+		g.planned[job.I] = job
+	}
+}
+
+// chaseDestination returns the position of the target of monster i, if the
+// monster is expected to compute a new path to chase it this turn.
+func (g *game) chaseDestination(i int) (gruid.Point, bool) {
+	ai := g.ECS.AI[i]
+	if ai == nil || g.ECS.Ally(i) || g.ECS.Status(i, StatusConfused) {
+		return gruid.Point{}, false
+	}
+	target := g.AITarget(i)
+	if target < 0 {
+		return gruid.Point{}, false
+	}
+	tp := g.ECS.Positions[target]
+	if paths.DistanceManhattan(g.ECS.Positions[i], tp) <= 1 || g.followsPath(i, tp) {
+		return gruid.Point{}, false
+	}
+	return tp, true
+}
+
+// plannedPath returns the path planned for monster i from its current
+// position to the given destination, if any. A planned path is used at most
+// once.
+func (g *game) plannedPath(i int, to gruid.Point) ([]gruid.Point, bool) {
+	job, ok := g.planned[i]
+	if !ok {
+		return nil, false
+	}
+	delete(g.planned, i)
+	if job.From != g.ECS.Positions[i] || job.To != to {
+		// The world changed since planning.
+		return nil, false
+	}
+	return job.Path, true
+}
@@ -0,0 +1,148 @@
+// This file implements allied companions: creatures of the player's faction
+// that follow the player, fight hostiles, and obey simple orders.
+
+package main
+
+import (
+	"github.com/anaseto/gruid/paths"
+)
+
+// allyOrder represents an order given to allies.
+type allyOrder int
+
+// These constants represent the available orders, in the order they are
+// cycled through.
+const (
+	OrderFollow allyOrder = iota // follow the player, fighting adjacent hostiles
+	OrderAttack                  // hunt hostiles in sight
+	OrderStay                    // stay in place, fighting adjacent hostiles
+)
+
+func (o allyOrder) String() string {
+	switch o {
+	case OrderAttack:
+		return "attack"
+	case OrderStay:
+		return "stay"
+	default:
+		return "follow"
+	}
+}
+
+// allyLeash is the distance from the player at which following allies stop
+// moving closer.
+const allyLeash = 2
+
+// Ally returns true if the entity i is an ally of the player.
+func (es *ECS) Ally(i int) bool {
+	f, ok := es.Faction[i]
+	return ok && f == FactionPlayer && i != es.PlayerID && es.AI[i] != nil
+}
+
+// Allies returns the allies of the player that are alive.
+func (es *ECS) Allies() []int {
+	allies := []int{}
+	for i := range es.AI {
+		if es.Ally(i) && es.Alive(i) {
+			allies = append(allies, i)
+		}
+	}
+	return allies
+}
+
+// AddPet adds the player's starting pet next to the player.
+func (g *game) AddPet() {
+	i := g.ECS.AddEntity(&Monster{}, g.ECS.PP())
+	g.ECS.Blocks[i] = true
+	g.ECS.Fighter[i] = &fighter{HP: 12, MaxHP: 12, Defense: 0, Power: 3}
+	g.ECS.Name[i] = "dog"
+	g.ECS.Style[i] = Style{Rune: 'd', Color: ColorAlly}
+	g.ECS.AI[i] = &AI{Animal: true}
+	g.ECS.Faction[i] = FactionPlayer
+	g.PlaceAllies([]int{i})
+}
+
+// PlaceAllies places allies at the free floor positions nearest to the
+// player. Allies for which there is no room are removed.
+func (g *game) PlaceAllies(allies []int) {
+	cands := g.SpawnCandidates()
+	for _, i := range allies {
+		g.ECS.AI[i].Path = nil
+		g.ECS.RemovePosition(i)
+		placed := false
+		for _, n := range cands {
+			if g.ECS.NoBlockingEntityAt(n.P) {
+				g.ECS.MoveEntity(i, n.P)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			g.ECS.RemoveEntity(i)
+		}
+	}
+}
+
+// FollowingAllies returns the allies that follow the player to a new level.
+// Allies ordered to stay are left behind.
+func (g *game) FollowingAllies() []int {
+	allies := []int{}
+	for _, i := range g.ECS.Allies() {
+		if g.ECS.AI[i].Order == OrderStay {
+			g.Logf("Your %s stays behind.", ColorLogSpecial, g.ECS.Name[i])
+			continue
+		}
+		allies = append(allies, i)
+	}
+	return allies
+}
+
+// OrderAllies cycles the order given to the player's allies.
+func (g *game) OrderAllies() {
+	allies := g.ECS.Allies()
+	if len(allies) == 0 {
+		g.Logf("You have no allies to give orders to.", ColorLogSpecial)
+		return
+	}
+	order := (g.ECS.AI[allies[0]].Order + 1) % (OrderStay + 1)
+	for _, i := range allies {
+		g.ECS.AI[i].Order = order
+	}
+	g.Logf("You order your allies to %s.", ColorLogSpecial, order)
+}
+
+// HandleAllyTurn handles the turn of ally i: it attacks adjacent hostiles,
+// and otherwise acts depending on its current order.
+func (g *game) HandleAllyTurn(i int) {
+	ai := g.ECS.AI[i]
+	p := g.ECS.Positions[i]
+	target := g.AITarget(i)
+	if target >= 0 && paths.DistanceManhattan(p, g.ECS.Positions[target]) == 1 {
+		g.BumpAttack(i, target)
+		return
+	}
+	switch ai.Order {
+	case OrderStay:
+		return
+	case OrderAttack:
+		if target >= 0 {
+			g.AIPath(i, g.ECS.Positions[target])
+			g.AIMove(i)
+			return
+		}
+	}
+	pp := g.ECS.PP()
+	if paths.DistanceManhattan(p, pp) > allyLeash {
+		g.AIPath(i, pp)
+		g.AIMove(i)
+	}
+}
+
+// SwapWithAlly makes the player swap places with ally i.
+func (g *game) SwapWithAlly(i int) {
+	pp := g.ECS.PP()
+	to := g.ECS.Positions[i]
+	g.ECS.MoveEntity(i, pp)
+	g.ECS.MovePlayer(to)
+	g.Map.Trample(to)
+}
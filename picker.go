@@ -0,0 +1,93 @@
+// This file implements a list picker: a helper that factors the common setup
+// of the game's menus (inventory, services, main menu, challenges...).
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// pickerEntry is an entry of a list picker.
+type pickerEntry struct {
+	Text     string
+	Disabled bool        // headers or unavailable choices
+	Marked   bool        // marked for a multiple selection
+	Keys     []gruid.Key // shortcuts, in addition to the letter, if any
+}
+
+// listPicker describes a menu listing entries to pick from.
+type listPicker struct {
+	Title     string
+	Footer    string
+	Entries   []pickerEntry
+	Letters   bool // prefix enabled entries with a letter shortcut
+	Width     int  // menu width (default: 40)
+	Height    int  // menu height (default: map height)
+	Columns   int  // number of columns (default: 1)
+	Highlight bool // highlight the active entry
+}
+
+// pickerLetters are the letter shortcuts given to entries, in order.
+const pickerLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Menu returns a new menu widget for the list picker. With letter shortcuts,
+// the menu moves only with arrow keys and quits with escape, so that letters
+// like “j” or “q” can be used as shortcuts.
+func (lp listPicker) Menu() *ui.Menu {
+	width, height := lp.Width, lp.Height
+	if width == 0 {
+		width = 40
+	}
+	if height == 0 {
+		height = MapHeight
+	}
+	columns := lp.Columns
+	if columns < 1 {
+		columns = 1
+	}
+	entries := []ui.MenuEntry{}
+	n := 0
+	for _, e := range lp.Entries {
+		text := e.Text
+		keys := e.Keys
+		if lp.Letters && !e.Disabled && n < len(pickerLetters) {
+			r := rune(pickerLetters[n])
+			sep := '-'
+			if e.Marked {
+				sep = '+'
+			}
+			text = fmt.Sprintf("%c %c %s", r, sep, text)
+			keys = append([]gruid.Key{gruid.Key(r)}, keys...)
+			n++
+		}
+		entries = append(entries, ui.MenuEntry{
+			Text:     ui.Text(text).Format((width - 2) / columns),
+			Disabled: e.Disabled,
+			Keys:     keys,
+		})
+	}
+	cfg := ui.MenuConfig{
+		Grid:    gruid.NewGrid(width, height),
+		Box:     &ui.Box{Title: ui.Text(lp.Title), Footer: ui.Text(lp.Footer)},
+		Entries: entries,
+	}
+	if columns > 1 {
+		cfg.Style.Layout = gruid.Point{columns, 0}
+	}
+	if lp.Highlight {
+		cfg.Style.Active = gruid.Style{}.WithFg(ColorMenuActive)
+	}
+	if lp.Letters {
+		cfg.Keys = ui.MenuKeys{
+			Up:    []gruid.Key{gruid.KeyArrowUp},
+			Down:  []gruid.Key{gruid.KeyArrowDown},
+			Left:  []gruid.Key{gruid.KeyArrowLeft},
+			Right: []gruid.Key{gruid.KeyArrowRight},
+			Quit:  []gruid.Key{gruid.KeyEscape},
+		}
+	}
+	return ui.NewMenu(cfg)
+}
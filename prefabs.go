@@ -0,0 +1,140 @@
+// This file describes prefabricated map parts (prefabs), stamped onto
+// procedurally generated maps.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+)
+
+// prefab represents a fixed map part, described by lines of characters. Walls
+// are represented by '#', stairs down by '>', deep water by '~', bridges by
+// '=', and any other character represents a floor cell. Some characters mark
+// special placement spots for entities.
+type prefab []string
+
+// placement describes a kind of special entity placement spot in a prefab.
+type placement rune
+
+// These constants represent the special placement spots in prefabs.
+const (
+	PlaceBoss       placement = 'B'
+	PlaceAmulet     placement = 'A'
+	PlaceStart      placement = '@'
+	PlaceShopkeeper placement = 'S'
+	PlaceHealer     placement = 'H'
+	PlaceElder      placement = 'E'
+	PlaceStash      placement = 'C'
+	PlaceGuard      placement = 'o'
+	PlaceWolf       placement = 'w'
+	PlaceTroll      placement = 'T'
+	PlaceChieftain  placement = 'K'
+	PlaceTreasure   placement = '$'
+	PlaceVault      placement = 'V'
+)
+
+// bossArena is the prefab for the boss room of the final level.
+var bossArena = prefab{
+	"...................",
+	".#######.#########.",
+	".#...............#.",
+	".#...............#.",
+	".#......B.A......#.",
+	".#...............#.",
+	".#...............#.",
+	".#################.",
+	"...................",
+}
+
+// hiddenVault is the prefab for a small treasure vault with a narrow
+// entrance, that can appear on intermediate levels.
+var hiddenVault = prefab{
+	".........",
+	".#######.",
+	".#$...$#.",
+	".#..V..#.",
+	".###.###.",
+	".........",
+}
+
+// vaultChance is the percentage chance for an intermediate level to contain
+// a hidden vault.
+const vaultChance = 30
+
+// Size returns the size of the prefab.
+func (pf prefab) Size() gruid.Point {
+	if len(pf) == 0 {
+		return gruid.Point{}
+	}
+	return gruid.Point{len([]rune(pf[0])), len(pf)}
+}
+
+// RandomPrefabOrigin returns a random position where the given prefab can be
+// stamped so that it fits in the map without touching the edges.
+func (m *Map) RandomPrefabOrigin(pf prefab) gruid.Point {
+	size := m.Grid.Size()
+	psize := pf.Size()
+	return gruid.Point{
+		1 + m.rand.Intn(size.X-psize.X-1),
+		1 + m.rand.Intn(size.Y-psize.Y-1),
+	}
+}
+
+// StampPrefab writes a prefab on the map at the given origin, records the
+// placement spots it marks, and returns a floor position in the prefab.
+func (m *Map) StampPrefab(pf prefab, origin gruid.Point) (floor gruid.Point) {
+	for y, line := range pf {
+		for x, r := range []rune(line) {
+			p := origin.Add(gruid.Point{x, y})
+			switch r {
+			case '#':
+				m.Grid.Set(p, Wall)
+				continue
+			case '>':
+				m.Grid.Set(p, Downstairs)
+				continue
+			case '~':
+				m.Grid.Set(p, DeepWater)
+				continue
+			case '=':
+				m.Grid.Set(p, Bridge)
+				continue
+			}
+			m.Grid.Set(p, Floor)
+			floor = p
+			switch pl := placement(r); pl {
+			case PlaceBoss, PlaceAmulet, PlaceStart, PlaceShopkeeper,
+				PlaceHealer, PlaceElder, PlaceStash, PlaceGuard, PlaceWolf,
+				PlaceTroll, PlaceChieftain, PlaceTreasure, PlaceVault:
+				m.Placements[pl] = append(m.Placements[pl], p)
+			}
+		}
+	}
+	return floor
+}
+
+// PlacePrefabEntities places monsters and treasure on the spots marked in
+// the prefabs of the current map.
+func (g *game) PlacePrefabEntities() {
+	monsters := []struct {
+		pl   placement
+		kind monsterKind
+	}{
+		{PlaceGuard, MonsterOrc},
+		{PlaceWolf, MonsterWolf},
+		{PlaceTroll, MonsterTroll},
+		{PlaceChieftain, MonsterOrcChieftain},
+	}
+	for _, mons := range monsters {
+		for _, p := range g.Map.Placements[mons.pl] {
+			if g.Map.Walkable(p) && g.ECS.NoBlockingEntityAt(p) {
+				g.AddMonster(mons.kind, p)
+			}
+		}
+	}
+	for _, p := range g.Map.Placements[PlaceTreasure] {
+		if g.Map.Walkable(p) {
+			g.PlaceRandomItem(p)
+		}
+	}
+}
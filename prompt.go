@@ -0,0 +1,154 @@
+// This file implements modal prompts: yes/no confirmations, one-line text
+// input, and number input. A prompt has its own mode, and returns to the
+// previous mode once answered or cancelled.
+
+package main
+
+import (
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// promptKind describes the different kinds of prompts.
+type promptKind int
+
+const (
+	promptConfirm promptKind = iota // yes or no
+	promptText                      // one line of text
+	promptNumber                    // a number between 0 and a maximum
+)
+
+// prompt describes the current modal prompt.
+type prompt struct {
+	Kind     promptKind
+	Question string
+	Input    []rune // current input (text and number prompts)
+	Max      int    // maximum length of text, or maximum number
+	back     mode   // mode to return to
+	done     func(input string) gruid.Effect
+}
+
+// maxNameLength is the maximum length of the player's name.
+const maxNameLength = 16
+
+// openPrompt opens the given prompt, that will return to the current mode.
+func (m *model) openPrompt(p *prompt) {
+	p.back = m.mode
+	m.prompt = p
+	m.mode = modePrompt
+}
+
+// Confirm opens a confirmation prompt with a yes or no question. The yes
+// function is called if the player answers yes.
+func (m *model) Confirm(question string, yes func() gruid.Effect) {
+	m.openPrompt(&prompt{
+		Kind:     promptConfirm,
+		Question: question + " (y/n)",
+		done:     func(string) gruid.Effect { return yes() },
+	})
+}
+
+// PromptText opens a prompt for a line of text of at most max characters. The
+// done function is called with the text once entered.
+func (m *model) PromptText(question, initial string, max int, done func(string) gruid.Effect) {
+	m.openPrompt(&prompt{
+		Kind:     promptText,
+		Question: question,
+		Input:    []rune(initial),
+		Max:      max,
+		done:     done,
+	})
+}
+
+// PromptNumber opens a prompt for a number between 0 and max. The done
+// function is called with the number once entered.
+func (m *model) PromptNumber(question string, initial, max int, done func(int) gruid.Effect) {
+	m.openPrompt(&prompt{
+		Kind:     promptNumber,
+		Question: question,
+		Input:    []rune(strconv.Itoa(initial)),
+		Max:      max,
+		done: func(s string) gruid.Effect {
+			n, _ := strconv.Atoi(s)
+			return done(n)
+		},
+	})
+}
+
+// updatePrompt handles input messages when a prompt is open.
+func (m *model) updatePrompt(msg gruid.Msg) gruid.Effect {
+	p := m.prompt
+	kmsg, ok := msg.(gruid.MsgKeyDown)
+	if !ok {
+		return nil
+	}
+	switch key := kmsg.Key; {
+	case key == gruid.KeyEscape:
+		m.closePrompt()
+	case p.Kind == promptConfirm:
+		switch key {
+		case "y", "Y":
+			m.closePrompt()
+			return p.done("y")
+		case "n", "N":
+			m.closePrompt()
+		}
+	case key == gruid.KeyEnter:
+		m.closePrompt()
+		return p.done(string(p.Input))
+	case key == gruid.KeyBackspace:
+		if len(p.Input) > 0 {
+			p.Input = p.Input[:len(p.Input)-1]
+		}
+	case key.IsRune():
+		r, _ := utf8.DecodeRuneInString(string(key))
+		p.AddRune(r)
+	}
+	return nil
+}
+
+// AddRune adds a rune to the prompt's input, if valid.
+func (p *prompt) AddRune(r rune) {
+	switch p.Kind {
+	case promptText:
+		if len(p.Input) < p.Max && (r == ' ' || r == '-' || r == '\'' || 'a' <= r && r <= 'z' ||
+			'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			p.Input = append(p.Input, r)
+		}
+	case promptNumber:
+		if r < '0' || r > '9' {
+			return
+		}
+		n, _ := strconv.Atoi(string(append(p.Input, r)))
+		if n > p.Max {
+			n = p.Max
+		}
+		p.Input = []rune(strconv.Itoa(n))
+	}
+}
+
+// closePrompt closes the current prompt, returning to the previous mode.
+func (m *model) closePrompt() {
+	m.mode = m.prompt.back
+	m.prompt = nil
+}
+
+// DrawPrompt draws the current prompt in the middle of the given grid.
+func (m *model) DrawPrompt(gd gruid.Grid) {
+	p := m.prompt
+	text := p.Question
+	switch p.Kind {
+	case promptText:
+		text += "\n> " + string(p.Input) + "_"
+	case promptNumber:
+		text += "\n> " + string(p.Input) + "_ (max " + strconv.Itoa(p.Max) + ")"
+	}
+	label := &ui.Label{Box: &ui.Box{}, Content: ui.Text(text), AdjustWidth: true}
+	size := label.Content.Size()
+	x := (gd.Size().X - size.X - 2) / 2
+	y := (gd.Size().Y - size.Y - 2) / 2
+	label.Draw(gd.Slice(gruid.NewRange(x, y, gd.Size().X, gd.Size().Y)))
+}
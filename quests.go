@@ -0,0 +1,168 @@
+// This file handles quests given to the player.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// questKind describes the different kinds of quests.
+type questKind int
+
+const (
+	QuestKill  questKind = iota // kill a number of monsters of a kind
+	QuestFetch                  // retrieve an item
+)
+
+// Quest represents a quest given to the player.
+type Quest struct {
+	Kind     questKind
+	Title    string // short description of the quest
+	Target   string // name of the monster or item
+	Depth    int    // depth where the quest item is found (fetch quests)
+	Count    int    // required number of kills (kill quests)
+	Progress int    // current number of kills
+	Reward   int    // maximum HP bonus granted on completion
+	Done     bool   // whether the quest has been completed
+	Failed   bool   // whether the quest cannot be completed anymore
+}
+
+// Objective returns a description of the quest's objective, with progress
+// information.
+func (q *Quest) Objective() string {
+	switch q.Kind {
+	case QuestKill:
+		return fmt.Sprintf("kill %s (%d/%d)", q.Target, q.Progress, q.Count)
+	case QuestFetch:
+		return fmt.Sprintf("retrieve the %s (depth %d)", q.Target, q.Depth)
+	}
+	return ""
+}
+
+// Status returns the title of the quest journal section of the quest.
+func (q *Quest) Status() string {
+	switch {
+	case q.Done:
+		return "Completed quests"
+	case q.Failed:
+		return "Failed quests"
+	}
+	return "Active quests"
+}
+
+// AssignQuests gives the initial quests to the player at the start of the
+// game.
+func (g *game) AssignQuests() {
+	g.Quests = []*Quest{
+		{Kind: QuestKill, Title: "Cull the wolves", Target: "wolf", Count: 3, Reward: 3},
+		{Kind: QuestFetch, Title: "Retrieve the elder's locket", Target: "elder's locket",
+			Depth: 3, Reward: 5},
+		{Kind: QuestKill, Title: "Slay the orc warlord", Target: "orc warlord", Count: 1, Reward: 10},
+	}
+	g.Logf("The village elder gives you %d quests.", ColorLogSpecial, len(g.Quests))
+}
+
+// PlaceQuestItems places the items of ongoing fetch quests whose depth is the
+// current one. Quest items are carried by a random monster, that drops it on
+// death, or lie on the floor if there are no monsters.
+func (g *game) PlaceQuestItems() {
+	monsters := []int{}
+	for i := range g.ECS.AI {
+		if g.ECS.Alive(i) && !g.ECS.Ally(i) {
+			monsters = append(monsters, i)
+		}
+	}
+	sort.Ints(monsters)
+	for _, q := range g.Quests {
+		if q.Kind != QuestFetch || q.Done || q.Failed || q.Depth != g.Depth {
+			continue
+		}
+		if len(monsters) == 0 {
+			g.ECS.AddItem(&QuestItem{}, g.FreeFloorTile(RNGMapgen), q.Target, '\'')
+			continue
+		}
+		i := monsters[g.Rand(RNGMapgen).Intn(len(monsters))]
+		g.ECS.OnDeath[i] = append(g.ECS.OnDeath[i], DeathEffect{Kind: DeathDropItem, Item: q.Target})
+	}
+}
+
+// FailLeftQuests marks as failed the ongoing fetch quests whose item is found
+// on the current level, as the player leaves it: levels are never revisited,
+// so the item is lost.
+func (g *game) FailLeftQuests() {
+	for _, q := range g.Quests {
+		if q.Kind != QuestFetch || q.Done || q.Failed || q.Depth != g.Depth {
+			continue
+		}
+		q.Failed = true
+		g.Logf("Quest “%s” failed: the %s is lost.", ColorLogSpecial, q.Title, q.Target)
+		g.AddReputation(questFailedReputation, "quest failed")
+	}
+}
+
+// questReputation is the reputation gained when completing a quest.
+const questReputation = 15
+
+// UpdateQuests updates the progress of ongoing quests of the given kind
+// concerning the given target, granting rewards for completed quests.
+func (g *game) UpdateQuests(kind questKind, target string) {
+	for _, q := range g.Quests {
+		if q.Done || q.Failed || q.Kind != kind || q.Target != target {
+			continue
+		}
+		q.Progress++
+		if q.Kind == QuestKill && q.Progress < q.Count {
+			g.Logf("Quest “%s”: %d/%d", ColorLogSpecial, q.Title, q.Progress, q.Count)
+			continue
+		}
+		q.Done = true
+		fi := g.ECS.Fighter[g.ECS.PlayerID]
+		fi.MaxHP += q.Reward
+		fi.HP += q.Reward
+		g.Logf("Quest “%s” completed! (+%d max HP)", ColorLogSpecial, q.Title, q.Reward)
+		g.AddReputation(questReputation, "quest completed")
+	}
+}
+
+// QuestJournalLines returns the lines of the quest journal, listing active
+// quests first, and then completed and failed ones.
+func (g *game) QuestJournalLines() []ui.StyledText {
+	lines := []ui.StyledText{}
+	st := gruid.Style{}
+	for _, title := range []string{"Active quests", "Completed quests", "Failed quests"} {
+		lines = append(lines, ui.NewStyledText(title, st.WithFg(ColorLogSpecial)))
+		n := 0
+		for _, q := range g.Quests {
+			if q.Status() != title {
+				continue
+			}
+			lines = append(lines, ui.Textf("  • %s: %s", q.Title, q.Objective()))
+			n++
+		}
+		if n == 0 {
+			lines = append(lines, ui.Text("  (none)"))
+		}
+		lines = append(lines, ui.Text(""))
+	}
+	if o := g.Objective; o != nil {
+		lines = append(lines, ui.NewStyledText("Level objective", st.WithFg(ColorLogSpecial)))
+		status := "active"
+		if o.Done {
+			status = "fulfilled"
+		}
+		lines = append(lines, ui.Textf("  • %s (%s, %d gold)", o.Description(), status, o.Reward))
+	}
+	return lines
+}
+
+// InitializeQuestJournal creates a new pager for viewing the quest journal.
+func (m *model) InitializeQuestJournal() {
+	m.journal = ui.NewPager(ui.PagerConfig{
+		Grid: gruid.NewGrid(UIWidth, UIHeight-1),
+		Box:  &ui.Box{Title: ui.Text("Quest Journal")},
+	})
+}
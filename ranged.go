@@ -0,0 +1,84 @@
+// This file implements ranged attacks for monsters that shoot at their
+// targets from a distance.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// archerRange is the range of orc archers' arrows.
+const archerRange = 5
+
+// ClearShot returns true if there is a clear line from p to q: it should be
+// in line of sight, without any blocking entities in between.
+func (g *game) ClearShot(p, q gruid.Point) bool {
+	return lineFree(p, q, func(r gruid.Point) bool {
+		return g.Map.Transparent(r) && g.ECS.NoBlockingEntityAt(r)
+	})
+}
+
+// WallBetween returns the first wall on the straight line from p to q
+// (excluding them), if any. Unlike ClearShot, it only considers solid walls:
+// magical effects, such as lightning or fireballs, go through foliage and
+// monsters, but not through walls.
+func (g *game) WallBetween(p, q gruid.Point) (gruid.Point, bool) {
+	var wall gruid.Point
+	free := lineFree(p, q, func(r gruid.Point) bool {
+		if g.Map.Grid.At(r) == Wall {
+			wall = r
+			return false
+		}
+		return true
+	})
+	return wall, !free
+}
+
+// blockedError is returned when a wall blocks the path of a magical effect.
+// Path is the path followed up to the blocking wall, so that it can be shown
+// to the player.
+type blockedError struct {
+	Msg  string
+	Path []gruid.Point
+}
+
+func (e *blockedError) Error() string { return e.Msg }
+
+// HandleRangedTurn handles the turn of a ranged attacker i with a given
+// target. The monster backs off if the target is adjacent, and shoots if it
+// has a clear shot within range. It returns false if the monster did nothing,
+// in which case it should act as a melee monster, approaching its target so
+// as to get a clear shot, or attacking it if it is cornered.
+func (g *game) HandleRangedTurn(i, target int) bool {
+	p := g.ECS.Positions[i]
+	q := g.ECS.Positions[target]
+	dist := paths.DistanceManhattan(p, q)
+	if dist <= 1 {
+		return g.BackOff(i, q)
+	}
+	if dist <= g.ECS.AI[i].Range && g.ClearShot(p, q) {
+		g.Attack(i, target, "shoots")
+		return true
+	}
+	return false
+}
+
+// BackOff makes monster i step away from q, if possible. It returns true if
+// the monster moved.
+func (g *game) BackOff(i int, q gruid.Point) bool {
+	p := g.ECS.Positions[i]
+	dist := paths.DistanceManhattan(p, q)
+	for _, r := range []gruid.Point{p.Shift(1, 0), p.Shift(-1, 0), p.Shift(0, 1), p.Shift(0, -1)} {
+		if !g.Map.Walkable(r) || !g.ECS.NoBlockingEntityAt(r) || g.Frightens(i, r) || g.Hazardous(i, r) {
+			continue
+		}
+		if paths.DistanceManhattan(r, q) > dist {
+			g.ECS.MoveEntity(i, r)
+			g.ECS.AI[i].Path = nil
+			g.ECS.AI[i].State = AIFleeing
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+// This file implements event log saves: instead of a snapshot of the game
+// state, the initial seed and the player's input messages are saved, and the
+// game is re-simulated from them when loading. Such saves are tiny, and can
+// be replayed for post-mortem debugging.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"time"
+
+	"github.com/anaseto/gruid"
+)
+
+// eventLogSaves enables event log saves for new games. It is set with the
+// -event-log command-line flag.
+var eventLogSaves bool
+
+// replayFile is the name of an event log file to re-simulate instead of
+// loading the last saved game. It is set with the -replay command-line flag.
+var replayFile string
+
+// Data file names for event logs.
+const (
+	eventsFile     = "events"     // event log of the saved game
+	postMortemFile = "postmortem" // event log of the last game lost
+)
+
+// event is a recorded input message.
+type event struct {
+	Key    gruid.Key         // key (key down and release events)
+	Mod    gruid.ModMask     // modifiers
+	Mouse  bool              // whether it is a mouse event
+	Up     bool              // whether it is a key release event
+	Action gruid.MouseAction // mouse action (mouse events)
+	P      gruid.Point       // mouse position (mouse events)
+	Time   time.Time         // time of the message
+}
+
+// Msg returns the input message corresponding to the event.
+func (ev event) Msg() gruid.Msg {
+	if ev.Up {
+		return msgKeyUp{Key: ev.Key, Time: ev.Time}
+	}
+	if ev.Mouse {
+		return gruid.MsgMouse{Action: ev.Action, P: ev.P, Mod: ev.Mod, Time: ev.Time}
+	}
+	return gruid.MsgKeyDown{Key: ev.Key, Mod: ev.Mod, Time: ev.Time}
+}
+
+// replayCheck summarizes the game state at the end of an event log, so that
+// a re-simulation that diverged can be detected.
+type replayCheck struct {
+	Depth      int
+	LevelTurns int
+	HP         int
+	Pos        gruid.Point
+	Messages   int
+}
+
+// eventLog contains all the information needed to re-simulate a game.
+type eventLog struct {
+	Seed     int64
+	Options  RunOptions
+	Scenario *Scenario
+	Name     string    // player's name
+	Build    buildInfo // build that saved the log
+	Events   []event
+	Check    replayCheck
+}
+
+// ReplayCheck returns the current replay check summary of the game.
+func (g *game) ReplayCheck() replayCheck {
+	return replayCheck{
+		Depth:      g.Depth,
+		LevelTurns: g.LevelTurns,
+		HP:         g.ECS.Fighter[g.ECS.PlayerID].HP,
+		Pos:        g.ECS.PP(),
+		Messages:   len(g.Log),
+	}
+}
+
+// Record appends an input message to the event log. Messages other than key
+// presses, key releases and mouse events are ignored.
+func (el *eventLog) Record(msg gruid.Msg) {
+	switch msg := msg.(type) {
+	case gruid.MsgKeyDown:
+		el.Events = append(el.Events, event{Key: msg.Key, Mod: msg.Mod, Time: msg.Time})
+	case gruid.MsgMouse:
+		el.Events = append(el.Events, event{Mouse: true, Action: msg.Action, P: msg.P, Mod: msg.Mod, Time: msg.Time})
+	case msgKeyUp:
+		el.Events = append(el.Events, event{Up: true, Key: msg.Key, Time: msg.Time})
+	}
+}
+
+// playing reports whether input messages currently affect the game. Messages
+// handled by the game menu, map generation debug mode, or prompts opened from
+// the game menu do not.
+func (m *model) playing() bool {
+	md := m.mode
+	if md == modePrompt {
+		md = m.prompt.back
+	}
+	switch md {
+	case modeGameMenu, modeChallenges, modeMapGenDebug:
+		return false
+	}
+	return true
+}
+
+// recordEvent records an input message in the event log of the current game,
+// if any. Messages that do not affect the game are not recorded.
+func (m *model) recordEvent(msg gruid.Msg) {
+	if !m.playing() {
+		return
+	}
+	if m.events == nil || m.replaying {
+		return
+	}
+	m.events.Record(msg)
+}
+
+// SaveEvents saves the event log of the current game to the given data
+// file, with a check summary of the current state. The last recorded event
+// is dropped if drop is true, like the save command itself.
+func (m *model) SaveEvents(filename string, drop bool) error {
+	el := *m.events
+	if drop && len(el.Events) > 0 {
+		el.Events = el.Events[:len(el.Events)-1]
+	}
+	el.Check = m.game.ReplayCheck()
+	el.Build = build
+	data := bytes.Buffer{}
+	if err := gob.NewEncoder(&data).Encode(&el); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data.Bytes())
+	w.Close()
+	return SaveFile(filename, buf.Bytes())
+}
+
+// LoadEvents loads an event log from the given data file.
+func LoadEvents(filename string) (*eventLog, error) {
+	data, err := LoadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	el := &eventLog{}
+	if err := gob.NewDecoder(r).Decode(el); err != nil {
+		return nil, err
+	}
+	return el, nil
+}
+
+// Replay re-simulates the game described by an event log, by starting a new
+// game with the same seed and options, and feeding the recorded messages to
+// the model. Recording then goes on with the same log.
+func (m *model) Replay(el *eventLog) error {
+	m.replaying = true
+	defer func() { m.replaying = false }()
+	m.game = NewScenarioGame(el.Seed, el.Options, el.Scenario)
+	m.game.SetPlayerName(el.Name)
+	m.mode = modeNormal
+	for _, ev := range el.Events {
+		m.Update(ev.Msg())
+	}
+	if m.game.ReplayCheck() != el.Check {
+		return errors.New("replay diverged from the saved game")
+	}
+	el.Check = replayCheck{}
+	m.events = el
+	return nil
+}
@@ -0,0 +1,128 @@
+// This file implements the player's reputation among town folk, which
+// changes with the player's deeds and affects how NPCs deal with the player,
+// as well as the character sheet where it is shown.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// Reputation bounds and thresholds.
+const (
+	MaxReputation     = 100
+	MinReputation     = -100
+	hostileReputation = -50 // below this, NPCs refuse to deal with the player
+)
+
+// Reputation changes for the player's misdeeds.
+const (
+	questFailedReputation = -20 // a quest could not be completed
+	allyLostReputation    = -25 // an ally died
+	allyHarmedReputation  = -5  // the player hurt an ally
+	theftReputation       = -30 // the player stole from the shop
+)
+
+// AddReputation changes the player's reputation by a given amount, logging
+// the reason for the change.
+func (g *game) AddReputation(n int, reason string) {
+	g.Reputation += n
+	if g.Reputation > MaxReputation {
+		g.Reputation = MaxReputation
+	}
+	if g.Reputation < MinReputation {
+		g.Reputation = MinReputation
+	}
+	if n >= 0 {
+		g.Logf("Your reputation improves (%s).", ColorLogSpecial, reason)
+	} else {
+		g.Logf("Your reputation worsens (%s).", ColorLogSpecial, reason)
+	}
+}
+
+// ReputationTitle returns a short description of the player's reputation.
+func (g *game) ReputationTitle() string {
+	switch r := g.Reputation; {
+	case r <= hostileReputation:
+		return "despised"
+	case r < 0:
+		return "distrusted"
+	case r < 20:
+		return "unknown"
+	case r < 60:
+		return "respected"
+	default:
+		return "renowned"
+	}
+}
+
+// Price returns the price of something with a given base price, taking into
+// account the player's reputation: prices go from twice the base price for a
+// despised player, to half the base price for a renowned one.
+func (g *game) Price(base int) int {
+	price := base * (200 - g.Reputation) / 200
+	if g.Reputation < 0 {
+		price = base * (100 - g.Reputation) / 100
+	}
+	if price < 1 {
+		price = 1
+	}
+	return price
+}
+
+// CheckHostility returns an error if the NPC i refuses to deal with the
+// player because of a bad reputation.
+func (g *game) CheckHostility(i int) error {
+	if npc, ok := g.ECS.Entities[i].(*NPC); ok && npc.Role == NPCStash {
+		// The stash is not a person.
+		return nil
+	}
+	if npc, ok := g.ECS.Entities[i].(*NPC); ok && npc.Role == NPCShopkeeper && g.Thief {
+		return errors.New("The shopkeeper says: “I do not deal with thieves!”")
+	}
+	if g.Reputation > hostileReputation {
+		return nil
+	}
+	return fmt.Errorf("The %s refuses to deal with you.", g.ECS.Name[i])
+}
+
+// CharacterSheetLines returns the lines of the character sheet, summarizing
+// the player's statistics and reputation.
+func (g *game) CharacterSheetLines() []ui.StyledText {
+	i := g.ECS.PlayerID
+	fi := g.ECS.Fighter[i]
+	st := gruid.Style{}
+	place := fmt.Sprintf("depth %d", g.Depth)
+	if g.Depth == 0 {
+		place = "town"
+	}
+	return []ui.StyledText{
+		ui.NewStyledText("Statistics", st.WithFg(ColorLogSpecial)),
+		ui.Textf("  HP:         %d/%d", fi.HP, fi.MaxHP),
+		g.powerLine(),
+		ui.Textf("  Defense:    %d", g.ECS.Defense(i)),
+		ui.Textf("  Gold:       %d", g.ECS.Player().Gold),
+		ui.Textf("  Location:   %s", place),
+		ui.Text(""),
+		ui.NewStyledText("Reputation", st.WithFg(ColorLogSpecial)),
+		ui.Textf("  %s (%+d)", g.ReputationTitle(), g.Reputation),
+		ui.Text(""),
+		ui.NewStyledText("Run", st.WithFg(ColorLogSpecial)),
+		ui.Textf("  %s", g.Options),
+		ui.Textf("  Scenario: %s", g.ScenarioName()),
+		ui.Textf("  Score:    %d", g.Score()),
+	}
+}
+
+// InitializeCharacterSheet creates a new pager for viewing the character
+// sheet.
+func (m *model) InitializeCharacterSheet() {
+	m.charsheet = ui.NewPager(ui.PagerConfig{
+		Grid: gruid.NewGrid(UIWidth, UIHeight-1),
+		Box:  &ui.Box{Title: ui.Text("Character Sheet")},
+	})
+}
@@ -0,0 +1,79 @@
+// This file implements gradual respawning of monsters on the current level,
+// so that lingering on a cleared level is not free.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+)
+
+// respawnInterval is the number of turns between two respawns.
+const respawnInterval = 50
+
+// monsterCosts gives the danger cost of monster kinds that can respawn. It is
+// sorted by increasing cost, so that affordable monsters form a prefix.
+var monsterCosts = []struct {
+	kind monsterKind
+	cost int
+}{
+	{MonsterBat, 1},
+	{MonsterOrc, 2},
+	{MonsterWolf, 2},
+	{MonsterOrcArcher, 3},
+	{MonsterSlime, 3},
+	{MonsterTroll, 4},
+	{MonsterSpider, 4},
+	{MonsterNecromancer, 6},
+	{MonsterOrcChieftain, 10},
+}
+
+func init() {
+	registerTurnHook(turnHook{Name: "respawn", Order: turnWorld, Run: (*game).Respawn})
+}
+
+// Respawn is called each turn. Every respawnInterval turns, the danger
+// budget of the level increases, by an amount that grows with the depth and
+// the time spent on the level, and a monster is spawned out of view using
+// the budget. Unspent budget accumulates, so that stronger, possibly
+// out-of-depth, monsters appear over time.
+func (g *game) Respawn() {
+	if g.Depth == 0 {
+		return
+	}
+	g.LevelTurns++
+	if g.LevelTurns%respawnInterval != 0 {
+		return
+	}
+	g.DangerBudget += g.Depth + g.LevelTurns/(4*respawnInterval)
+	affordable := 0
+	for affordable < len(monsterCosts) && monsterCosts[affordable].cost <= g.DangerBudget {
+		affordable++
+	}
+	if affordable == 0 {
+		return
+	}
+	// We favor the most dangerous affordable monsters.
+	n := affordable - 1 - g.Rand(RNGMapgen).Intn(1+affordable/2)
+	p, ok := g.RespawnTile()
+	if !ok {
+		return
+	}
+	g.DangerBudget -= monsterCosts[n].cost
+	g.AddMonster(monsterCosts[n].kind, p)
+}
+
+// RespawnTile returns a free floor position far from the player and out of
+// view, if any.
+func (g *game) RespawnTile() (gruid.Point, bool) {
+	const minSpawnDistance = maxLOS + 2
+	far := []gruid.Point{}
+	for _, n := range g.SpawnCandidates() {
+		if n.Cost >= minSpawnDistance && !g.InFOV(n.P) && g.ECS.NoBlockingEntityAt(n.P) {
+			far = append(far, n.P)
+		}
+	}
+	if len(far) == 0 {
+		return gruid.Point{}, false
+	}
+	return far[g.Rand(RNGMapgen).Intn(len(far))], true
+}
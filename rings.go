@@ -0,0 +1,97 @@
+// This file implements rings: jewelry worn in one of two ring slots, that
+// grants a passive effect while worn. Ring effects are checked where the
+// corresponding rule is computed: regeneration in RegenNextTurn, poison
+// resistance in PoisonNextTurn, and seeing invisible monsters wherever the
+// map and monster information are shown.
+
+package main
+
+// ringEffect describes the passive effect of a ring.
+type ringEffect int
+
+const (
+	RingRegeneration     ringEffect = iota // regain HP over time
+	RingSeeInvisible                       // see invisible monsters
+	RingPoisonResistance                   // no damage from poison
+)
+
+func (re ringEffect) String() (s string) {
+	switch re {
+	case RingRegeneration:
+		s = "regeneration"
+	case RingSeeInvisible:
+		s = "see invisible"
+	case RingPoisonResistance:
+		s = "poison resistance"
+	}
+	return s
+}
+
+// ringRegenEvery is the number of turns between two HP regained thanks to a
+// ring of regeneration.
+const ringRegenEvery = 4
+
+// Ring is an equippable item that grants a passive effect while worn.
+type Ring struct {
+	Effect ringEffect `json:"effect"`
+	Hand   equipSlot  `json:"hand"` // ring slot the ring is (or was last) worn in
+	Wait   int        `json:"wait"` // turns worn since the last regenerated HP
+}
+
+func (r *Ring) Slot() equipSlot               { return r.Hand }
+func (r *Ring) Bonuses() (power, defense int) { return 0, 0 }
+
+// ringSlots lists the ring slots.
+var ringSlots = []equipSlot{SlotRingLeft, SlotRingRight}
+
+// WearsRing returns true if the actor wears a ring with the given effect.
+func (g *game) WearsRing(actor int, re ringEffect) bool {
+	for _, sl := range ringSlots {
+		i, ok := g.ECS.Equipment[actor][sl]
+		if !ok {
+			continue
+		}
+		if r, ok := g.ECS.Entities[i].(*Ring); ok && r.Effect == re {
+			return true
+		}
+	}
+	return false
+}
+
+// RingRegenNextTurn makes fighter i regain one HP every ringRegenEvery turns
+// for each ring of regeneration it wears.
+func (g *game) RingRegenNextTurn(i int) {
+	for _, sl := range ringSlots {
+		j, ok := g.ECS.Equipment[i][sl]
+		if !ok {
+			continue
+		}
+		r, ok := g.ECS.Entities[j].(*Ring)
+		if !ok || r.Effect != RingRegeneration {
+			continue
+		}
+		r.Wait++
+		if r.Wait >= ringRegenEvery {
+			r.Wait = 0
+			g.ECS.Fighter[i].Heal(1)
+		}
+	}
+}
+
+// ringSlot returns the ring slot in which the actor puts on a new ring: a
+// free one if any, or the left one otherwise, replacing the ring worn there.
+func (g *game) ringSlot(actor int) equipSlot {
+	for _, sl := range ringSlots {
+		if _, ok := g.ECS.Equipment[actor][sl]; !ok {
+			return sl
+		}
+	}
+	return SlotRingLeft
+}
+
+// Unseen returns true if entity i is an invisible monster that the player
+// cannot see.
+func (g *game) Unseen(i int) bool {
+	ai := g.ECS.AI[i]
+	return ai != nil && ai.Invisible && !g.WearsRing(g.ECS.PlayerID, RingSeeInvisible)
+}
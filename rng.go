@@ -0,0 +1,118 @@
+// This file implements per-system random number streams: each system (map
+// generation, combat, loot, monster AI) draws from its own generator, derived
+// from the level's seed, so that adding a random call in one system does not
+// shift the outcomes of the others. This keeps daily runs comparable between
+// builds, and makes replay divergences easier to track down.
+
+package main
+
+import (
+	"math/rand"
+)
+
+// rngStream identifies a random number stream.
+type rngStream int
+
+const (
+	RNGMapgen rngStream = iota // level generation and population
+	RNGCombat                  // fights, statuses and magical effects
+	RNGLoot                    // kind, blessing and amount of items
+	RNGAI                      // monster decisions
+	numRNGStreams
+)
+
+func (s rngStream) String() (name string) {
+	switch s {
+	case RNGMapgen:
+		name = "mapgen"
+	case RNGCombat:
+		name = "combat"
+	case RNGLoot:
+		name = "loot"
+	case RNGAI:
+		name = "ai"
+	}
+	return name
+}
+
+// streamSeed derives the seed of stream s from a level seed. The map
+// generation stream uses the level seed itself, so that a given seed still
+// produces the same maps. Other seeds are mixed with a splitmix64 step, so
+// that streams are not correlated.
+func streamSeed(seed int64, s rngStream) int64 {
+	if s == RNGMapgen {
+		return seed
+	}
+	z := uint64(seed) + uint64(s)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// rngStreams holds the random number streams of a level.
+type rngStreams struct {
+	seed  int64 // level seed the streams derive from
+	rands [numRNGStreams]*rand.Rand
+	srcs  [numRNGStreams]*countingSource
+}
+
+// newRNGStreams returns the random number streams derived from a level seed.
+func newRNGStreams(seed int64) *rngStreams {
+	rs := &rngStreams{seed: seed}
+	for s := rngStream(0); s < numRNGStreams; s++ {
+		rs.srcs[s] = newCountingSource(streamSeed(seed, s))
+		rs.rands[s] = rand.New(rs.srcs[s])
+	}
+	return rs
+}
+
+// rngState is the saved state of the random number streams of a level: the
+// level seed, and the number of draws of each stream.
+type rngState struct {
+	Seed  int64
+	Draws [numRNGStreams]int
+}
+
+// State returns the current state of the streams.
+func (rs *rngStreams) State() rngState {
+	st := rngState{Seed: rs.seed}
+	for s, src := range rs.srcs {
+		st.Draws[s] = src.count()
+	}
+	return st
+}
+
+// restoreRNGStreams returns the streams in the given state: new streams are
+// derived from the seed, and then advanced by the recorded number of draws.
+func restoreRNGStreams(st rngState) *rngStreams {
+	rs := newRNGStreams(st.Seed)
+	for s, src := range rs.srcs {
+		for src.Draws < st.Draws[s] {
+			src.Uint64()
+		}
+	}
+	return rs
+}
+
+// Get returns the generator of stream s.
+func (rs *rngStreams) Get(s rngStream) *rand.Rand {
+	return rs.rands[s]
+}
+
+// count returns the total number of draws of all the streams, handling nil
+// streams.
+func (rs *rngStreams) count() int {
+	if rs == nil {
+		return 0
+	}
+	n := 0
+	for _, src := range rs.srcs {
+		n += src.count()
+	}
+	return n
+}
+
+// Rand returns the generator of stream s for the current level.
+func (g *game) Rand(s rngStream) *rand.Rand {
+	return g.Map.rngs.Get(s)
+}
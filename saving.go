@@ -6,6 +6,8 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -13,26 +15,71 @@ import (
 	"runtime"
 )
 
-func init() {
-	// We register Entity types so that gob can encode them.
-	gob.Register(&Player{})
-	gob.Register(&Monster{})
-	gob.Register(&HealingPotion{})
-	gob.Register(&LightningScroll{})
-	gob.Register(&ConfusionScroll{})
-	gob.Register(&FireballScroll{})
+// saveMagic identifies the header of save files.
+const saveMagic = "gruid-rltuto save"
+
+// saveHeader is the header of save files. It is written as an uncompressed
+// JSON line before the game data, so that it can be checked without decoding
+// the whole game.
+type saveHeader struct {
+	Magic  string    `json:"magic"`
+	Build  buildInfo `json:"build"`  // build that wrote the save
+	Schema int       `json:"schema"` // save schema version
+}
+
+// splitSaveHeader returns the header and the compressed game data of a save
+// file. Saves written before headers were introduced start directly with the
+// compressed data: a zero header is returned for them.
+func splitSaveHeader(data []byte) (saveHeader, []byte, error) {
+	h := saveHeader{}
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		// gzip magic number: no header
+		return h, data, nil
+	}
+	n := bytes.IndexByte(data, '\n')
+	if n < 0 {
+		return h, nil, errors.New("invalid save file: missing header")
+	}
+	if err := json.Unmarshal(data[:n], &h); err != nil || h.Magic != saveMagic {
+		return h, nil, errors.New("invalid save file: bad header")
+	}
+	return h, data[n+1:], nil
+}
+
+// ReadSaveHeader returns the header of the given save file data, or an error
+// if the save is invalid or incompatible with the current build.
+func ReadSaveHeader(data []byte) (saveHeader, error) {
+	h, _, err := splitSaveHeader(data)
+	if err != nil {
+		return h, err
+	}
+	if h.Magic != "" && h.Schema != schemaVersion {
+		return h, fmt.Errorf("save from build %v uses schema version %d (expected %d)", h.Build, h.Schema, schemaVersion)
+	}
+	return h, nil
 }
 
 // EncodeGame uses the gob package of the standard library to encode the game
-// so that it can be saved to a file.
+// so that it can be saved to a file. Entities are encoded following the save
+// schema described in schema.go. The compressed data follows a save header.
 func EncodeGame(g *game) ([]byte, error) {
+	g.Map.SaveRNG()
+	if g.Town != nil {
+		g.Town.SaveRNG()
+	}
 	data := bytes.Buffer{}
 	enc := gob.NewEncoder(&data)
 	err := enc.Encode(g)
 	if err != nil {
 		return nil, err
 	}
+	header, err := json.Marshal(saveHeader{Magic: saveMagic, Build: build, Schema: schemaVersion})
+	if err != nil {
+		return nil, err
+	}
 	var buf bytes.Buffer
+	buf.Write(header)
+	buf.WriteByte('\n')
 	w := gzip.NewWriter(&buf)
 	w.Write(data.Bytes())
 	w.Close()
@@ -42,6 +89,11 @@ func EncodeGame(g *game) ([]byte, error) {
 // DecodeGame uses the gob package from the standard library to decode a saved
 // game.
 func DecodeGame(data []byte) (*game, error) {
+	h, err := ReadSaveHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	_, data, _ = splitSaveHeader(data)
 	buf := bytes.NewReader(data)
 	r, err := gzip.NewReader(buf)
 	if err != nil {
@@ -51,12 +103,63 @@ func DecodeGame(data []byte) (*game, error) {
 	g := &game{}
 	err = dec.Decode(g)
 	if err != nil {
+		if h.Magic != "" {
+			return nil, fmt.Errorf("save from build %v: %v", h.Build, err)
+		}
 		return nil, err
 	}
 	r.Close()
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	g.Map.RestoreRNG()
+	if g.Depth == 0 {
+		// The current map is the town, but gob does not preserve
+		// pointer sharing.
+		g.Town = g.Map
+	} else if g.Town != nil {
+		g.Town.RestoreRNG()
+	}
+	// The player's field of view is not saved.
+	g.UpdateFOV()
 	return g, nil
 }
 
+// saveFile is the data file name of snapshot saves.
+const saveFile = "save"
+
+// saveStatus describes the state of the save of the last game.
+type saveStatus int
+
+const (
+	saveMissing saveStatus = iota // no save
+	saveValid                     // save that can be continued
+	saveCorrupt                   // unreadable or incompatible save
+)
+
+// probeSave checks the save of the last game, returning its file name and
+// status. Event logs are fully decoded, but only the header of snapshot
+// saves is checked, so a snapshot save may still fail to decode.
+func probeSave() (string, saveStatus) {
+	if replayFile != "" {
+		return replayFile, saveValid
+	}
+	if _, err := LoadFile(eventsFile); err == nil {
+		if _, err := LoadEvents(eventsFile); err != nil {
+			return eventsFile, saveCorrupt
+		}
+		return eventsFile, saveValid
+	}
+	data, err := LoadFile(saveFile)
+	if err != nil {
+		return "", saveMissing
+	}
+	if _, err := ReadSaveHeader(data); err != nil {
+		return saveFile, saveCorrupt
+	}
+	return saveFile, saveValid
+}
+
 // DataDir returns the directory for saving application's data, which depends
 // on the platform. It builds the directory if it does not exist already.
 func DataDir() (string, error) {
@@ -0,0 +1,228 @@
+// This file implements scenarios (also called challenges): runs with a fixed
+// seed, special rules and a custom starting kit. Scenarios are described in
+// JSON data files: built-in ones are embedded from the scenarios directory,
+// and more can be added in the scenarios subdirectory of the game's data
+// directory.
+
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+//go:embed scenarios/*.json
+var builtinScenarios embed.FS
+
+// rule describes a special rule of a scenario.
+type rule string
+
+// These constants represent the available special rules.
+const (
+	RuleNoHealingPotions rule = "no_healing_potions" // healing potions are not generated
+	RuleNoRegeneration   rule = "no_regeneration"    // the player does not regenerate
+	RuleNoPet            rule = "no_pet"             // the player starts without a pet
+)
+
+// Scenario describes a challenge run.
+type Scenario struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Seed        int64    `json:"seed"`  // fixed seed (0 for a random one)
+	Rules       []rule   `json:"rules"` // special rules
+	Kit         []string `json:"kit"`   // names of starting inventory items
+	Gold        *int     `json:"gold"`  // starting gold, if not the default
+}
+
+// Check returns an error if the scenario is not valid.
+func (sc *Scenario) Check() error {
+	if sc.Name == "" {
+		return fmt.Errorf("scenario without name")
+	}
+	for _, r := range sc.Rules {
+		switch r {
+		case RuleNoHealingPotions, RuleNoRegeneration, RuleNoPet:
+		default:
+			return fmt.Errorf("%s: unknown rule %q", sc.Name, r)
+		}
+	}
+	for _, name := range sc.Kit {
+		if !isItemName(name) {
+			return fmt.Errorf("%s: unknown kit item %q", sc.Name, name)
+		}
+	}
+	return nil
+}
+
+// LoadScenarios returns the built-in scenarios, followed by the ones found in
+// the data directory, sorted by name within each group. Invalid scenario
+// files are reported as errors, but do not prevent loading the others.
+func LoadScenarios() ([]*Scenario, []error) {
+	scs, errs := loadScenarios(builtinScenarios, "scenarios")
+	dataDir, err := DataDir()
+	if err != nil {
+		return scs, append(errs, err)
+	}
+	dir := filepath.Join(dataDir, "scenarios")
+	if _, err := os.Stat(dir); err != nil {
+		return scs, errs
+	}
+	user, uerrs := loadScenarios(os.DirFS(dir), ".")
+	return append(scs, user...), append(errs, uerrs...)
+}
+
+// loadScenarios loads the scenario files of a directory in fsys.
+func loadScenarios(fsys fs.FS, dir string) ([]*Scenario, []error) {
+	scs := []*Scenario{}
+	errs := []error{}
+	files, err := fs.Glob(fsys, dir+"/*.json")
+	if err != nil {
+		return nil, []error{err}
+	}
+	for _, f := range files {
+		data, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sc := &Scenario{}
+		if err := json.Unmarshal(data, sc); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", f, err))
+			continue
+		}
+		if err := sc.Check(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		scs = append(scs, sc)
+	}
+	sort.Slice(scs, func(i, j int) bool { return scs[i].Name < scs[j].Name })
+	return scs, errs
+}
+
+// Rule returns true if the game is a scenario with the given special rule.
+func (g *game) Rule(r rule) bool {
+	if g.Scenario == nil {
+		return false
+	}
+	for _, r2 := range g.Scenario.Rules {
+		if r2 == r {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyScenarioKit gives the player the starting kit of the scenario. Kit
+// equipment is worn from the start, unless its slot is already used by a
+// previous kit item.
+func (g *game) ApplyScenarioKit() {
+	sc := g.Scenario
+	if sc.Gold != nil {
+		g.ECS.Player().Gold = *sc.Gold
+	}
+	pl := g.ECS.PlayerID
+	for _, name := range sc.Kit {
+		i, err := g.AddNamedItem(name, g.ECS.PP())
+		if err != nil {
+			// Should not happen: kits are checked when loading.
+			continue
+		}
+		if err := g.InventoryAdd(pl, i); err != nil {
+			g.ECS.RemoveEntity(i)
+			continue
+		}
+		e, ok := g.ECS.Entities[i].(Equippable)
+		if !ok {
+			continue
+		}
+		if g.ECS.Equipment[pl] == nil {
+			g.ECS.Equipment[pl] = Equipment{}
+		}
+		if r, ok := e.(*Ring); ok {
+			r.Hand = g.ringSlot(pl)
+		}
+		if _, ok := g.ECS.Equipment[pl][e.Slot()]; !ok {
+			g.ECS.Equipment[pl][e.Slot()] = i
+		}
+	}
+}
+
+// ScenarioName returns the name of the scenario of the game, or "standard"
+// for normal games.
+func (g *game) ScenarioName() string {
+	if g.Scenario == nil {
+		return "standard"
+	}
+	return g.Scenario.Name
+}
+
+// String returns the scenario's name along with its special rules.
+func (sc *Scenario) String() string {
+	rules := []string{}
+	for _, r := range sc.Rules {
+		rules = append(rules, strings.ReplaceAll(string(r), "_", " "))
+	}
+	if len(rules) == 0 {
+		return sc.Name
+	}
+	return fmt.Sprintf("%s (%s)", sc.Name, strings.Join(rules, ", "))
+}
+
+// OpenChallenges opens the challenges menu, listing the available scenarios
+// along with their best score.
+func (m *model) OpenChallenges() {
+	scs, errs := LoadScenarios()
+	m.scenarios = scs
+	m.info.SetText("")
+	if len(errs) > 0 {
+		m.info.SetText(fmt.Sprintf("Invalid scenario: %v", errs[0]))
+	}
+	if len(scs) == 0 {
+		m.info.SetText("No scenarios available.")
+		return
+	}
+	sts := LoadScores()
+	lp := listPicker{
+		Title:     "Challenges",
+		Letters:   true,
+		Width:     UIWidth,
+		Height:    UIHeight - 3,
+		Highlight: true,
+	}
+	for _, sc := range scs {
+		lp.Entries = append(lp.Entries, pickerEntry{
+			Text: fmt.Sprintf("%s (best: %d)\n    %s", sc, sts.Best(sc.Name), sc.Description),
+		})
+	}
+	m.challenge = lp.Menu()
+	m.mode = modeChallenges
+}
+
+// updateChallenges handles input messages in the challenges menu.
+func (m *model) updateChallenges(msg gruid.Msg) {
+	m.challenge.Update(msg)
+	switch m.challenge.Action() {
+	case ui.MenuQuit:
+		m.mode = modeGameMenu
+	case ui.MenuInvoke:
+		sc := m.scenarios[m.challenge.Active()]
+		m.PromptText("What is your name?", "", maxNameLength, func(name string) gruid.Effect {
+			g := NewScenarioGame(time.Now().UnixNano(), NewRunOptions(), sc)
+			g.SetPlayerName(name)
+			m.StartGame(g)
+			m.game.Logf("Challenge: %s.", ColorLogSpecial, sc)
+			return nil
+		})
+	}
+}
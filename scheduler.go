@@ -0,0 +1,136 @@
+// This file implements an energy-based turn scheduler, so that monsters can
+// act at different speeds, as well as a preview of the turn order.
+
+package main
+
+import (
+	"sort"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// normalSpeed is the speed of most actors. An actor gains its speed in energy
+// for each unit of game time, and acting costs normalSpeed energy: actors
+// with normal speed act exactly once per player action, fast actors act more
+// often, and slow actors less.
+const normalSpeed = 100
+
+// Speed returns the current speed of an entity, taking into account hasted
+// and slowed statuses.
+func (es *ECS) Speed(i int) int {
+	speed, ok := es.Speeds[i]
+	if !ok {
+		speed = normalSpeed
+	}
+	if es.Status(i, StatusHasted) {
+		speed *= 2
+	}
+	if es.Status(i, StatusSlowed) {
+		speed /= 2
+	}
+	return speed
+}
+
+func init() {
+	registerTurnHook(turnHook{Name: "monsters", Order: turnMonsters, Run: (*game).RunMonsters})
+}
+
+// RunMonsters gives monsters energy for the duration of the last player's
+// action, and makes them act while they have enough energy. The duration
+// depends on the player's speed: a hasted player's actions take less time.
+func (g *game) RunMonsters() {
+	elapsed := normalSpeed * normalSpeed / g.ECS.Speed(g.ECS.PlayerID)
+	// Monsters act in entity order, so that the outcome of a turn does
+	// not depend on map iteration order.
+	monsters := []int{}
+	for i, e := range g.ECS.Entities {
+		if _, ok := e.(*Monster); ok && g.ECS.Alive(i) {
+			monsters = append(monsters, i)
+		}
+	}
+	sort.Ints(monsters)
+	g.PlanPaths(monsters)
+	defer func() { g.planned = nil }()
+	for _, i := range monsters {
+		if !g.ECS.Alive(i) {
+			continue
+		}
+		g.ECS.Energy[i] += g.ECS.Speed(i) * elapsed / normalSpeed
+		for g.ECS.Energy[i] >= normalSpeed {
+			if g.ECS.PlayerDied() {
+				return
+			}
+			if !g.ECS.Alive(i) {
+				// The monster died during its own turn, for
+				// example from a death explosion: the others
+				// still act.
+				break
+			}
+			g.HandleMonsterTurn(i)
+			g.ECS.Energy[i] -= normalSpeed
+		}
+	}
+}
+
+// TurnOrder returns the next n actors in order, starting with the player's
+// next action, by simulating the scheduler. Only monsters in view are taken
+// into account. Monsters acting during the same player action are listed by
+// index, as their actual order is not defined.
+func (g *game) TurnOrder(n int) []int {
+	elapsed := normalSpeed * normalSpeed / g.ECS.Speed(g.ECS.PlayerID)
+	monsters := []int{}
+	energy := map[int]int{}
+	for i, e := range g.ECS.Entities {
+		if _, ok := e.(*Monster); !ok || !g.ECS.Alive(i) || !g.InFOV(g.ECS.Positions[i]) || g.Unseen(i) {
+			continue
+		}
+		monsters = append(monsters, i)
+		energy[i] = g.ECS.Energy[i]
+	}
+	sort.Ints(monsters)
+	order := []int{}
+	for len(order) < n {
+		order = append(order, g.ECS.PlayerID)
+		for _, i := range monsters {
+			energy[i] += g.ECS.Speed(i) * elapsed / normalSpeed
+			for energy[i] >= normalSpeed {
+				order = append(order, i)
+				energy[i] -= normalSpeed
+			}
+		}
+	}
+	return order[:n]
+}
+
+// turnOrderLength is the number of actors shown in the turn order strip.
+const turnOrderLength = 16
+
+// DrawTurnOrder draws a strip showing the next actors in order on the last
+// line of the map, if enabled and there are monsters in view.
+func (m *model) DrawTurnOrder(mapgrid gruid.Grid) {
+	if !m.turnOrder {
+		return
+	}
+	order := m.game.TurnOrder(turnOrderLength)
+	monsters := false
+	for _, i := range order {
+		if i != m.game.ECS.PlayerID {
+			monsters = true
+		}
+	}
+	if !monsters {
+		return
+	}
+	line := mapgrid.Slice(mapgrid.Range().Line(mapgrid.Size().Y - 1))
+	// We clear the part of the line used by the strip, so that it is
+	// readable over the map.
+	line.Slice(gruid.NewRange(0, 0, 6+2*len(order), 1)).Fill(gruid.Cell{Rune: ' '})
+	st := gruid.Style{}
+	x := ui.NewStyledText("Next:", st).Draw(line).Size().X + 1
+	for _, i := range order {
+		r, c := m.game.ECS.GetStyle(i)
+		line.Set(gruid.Point{x, 0}, gruid.Cell{Rune: r, Style: st.WithFg(c)})
+		x += 2
+	}
+}
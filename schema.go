@@ -0,0 +1,148 @@
+// This file describes the save schema of entities and their components.
+// Instead of relying on gob type registration and Go field names, entities
+// are saved component by component, with stable names for entity kinds,
+// components and fields (set with json struct tags), so that saves survive
+// renames in the code, and can be exported as JSON.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// schemaVersion is the version of the save schema. It should be increased
+// whenever the schema changes in an incompatible way.
+const schemaVersion = 1
+
+// entityKinds maps the stable kind names used in saves to constructors for
+// each type of entity. New entity types have to be added here.
+var entityKinds = map[string]func() Entity{
+	"player":              func() Entity { return NewPlayer() },
+	"monster":             func() Entity { return &Monster{} },
+	"npc":                 func() Entity { return &NPC{} },
+	"corpse":              func() Entity { return &Corpse{} },
+	"gold":                func() Entity { return &Gold{} },
+	"amulet":              func() Entity { return &Amulet{} },
+	"quest_item":          func() Entity { return &QuestItem{} },
+	"healing_potion":      func() Entity { return &HealingPotion{} },
+	"strength_potion":     func() Entity { return &StrengthPotion{} },
+	"poison_potion":       func() Entity { return &PoisonPotion{} },
+	"regeneration_potion": func() Entity { return &RegenerationPotion{} },
+	"lightning_scroll":    func() Entity { return &LightningScroll{} },
+	"confusion_scroll":    func() Entity { return &ConfusionScroll{} },
+	"fireball_scroll":     func() Entity { return &FireballScroll{} },
+	"teleport_scroll":     func() Entity { return &TeleportScroll{} },
+	"enchant_scroll":      func() Entity { return &EnchantScroll{} },
+	"weapon":              func() Entity { return &Weapon{} },
+	"armor":               func() Entity { return &Armor{} },
+	"shield":              func() Entity { return &Shield{} },
+	"bow":                 func() Entity { return &Bow{} },
+	"arrows":              func() Entity { return &Arrows{} },
+	"ring":                func() Entity { return &Ring{} },
+}
+
+// kindNames maps entity types to their kind name.
+var kindNames = map[reflect.Type]string{}
+
+func init() {
+	for name, fn := range entityKinds {
+		kindNames[reflect.TypeOf(fn())] = name
+	}
+}
+
+// entityRecord is the saved representation of an entity.
+type entityRecord struct {
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+// ecsSchema is the saved representation of the ECS. Components are saved by
+// name, as a map from entity indexes to values.
+type ecsSchema struct {
+	Version    int                                `json:"version"`
+	PlayerID   int                                `json:"player_id"`
+	NextID     int                                `json:"next_id"`
+	Entities   map[int]entityRecord               `json:"entities"`
+	Components map[string]map[int]json.RawMessage `json:"components"`
+}
+
+// MarshalJSON implements json.Marshaler, following the save schema.
+func (es *ECS) MarshalJSON() ([]byte, error) {
+	sc := ecsSchema{
+		Version:    schemaVersion,
+		PlayerID:   es.PlayerID,
+		NextID:     es.NextID,
+		Entities:   make(map[int]entityRecord, len(es.Entities)),
+		Components: map[string]map[int]json.RawMessage{},
+	}
+	for i, e := range es.Entities {
+		kind, ok := kindNames[reflect.TypeOf(e)]
+		if !ok {
+			return nil, fmt.Errorf("entity %d: unknown entity type %T", i, e)
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return nil, fmt.Errorf("entity %d: %v", i, err)
+		}
+		sc.Entities[i] = entityRecord{Kind: kind, Data: data}
+	}
+	for name, c := range es.components() {
+		if name == "entities" {
+			continue
+		}
+		data, err := c.encode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		sc.Components[name] = data
+	}
+	return json.Marshal(sc)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, following the save schema.
+// Unknown components are ignored, and missing ones are left empty.
+func (es *ECS) UnmarshalJSON(bs []byte) error {
+	sc := ecsSchema{}
+	if err := json.Unmarshal(bs, &sc); err != nil {
+		return err
+	}
+	if sc.Version != schemaVersion {
+		return fmt.Errorf("unsupported save schema version %d (expected %d)", sc.Version, schemaVersion)
+	}
+	*es = ECS{PlayerID: sc.PlayerID, NextID: sc.NextID}
+	es.Entities = make(componentMap[Entity], len(sc.Entities))
+	for i, rec := range sc.Entities {
+		fn, ok := entityKinds[rec.Kind]
+		if !ok {
+			return fmt.Errorf("entity %d: unknown entity kind %q", i, rec.Kind)
+		}
+		e := fn()
+		if err := json.Unmarshal(rec.Data, e); err != nil {
+			return fmt.Errorf("entity %d: %v", i, err)
+		}
+		es.Entities[i] = e
+	}
+	for name, c := range es.components() {
+		if name == "entities" {
+			continue
+		}
+		if err := c.decode(sc.Components[name]); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	es.InitComponents()
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder, so that the ECS is saved following
+// the save schema as part of the game.
+func (es *ECS) GobEncode() ([]byte, error) {
+	return es.MarshalJSON()
+}
+
+// GobDecode implements gob.GobDecoder.
+func (es *ECS) GobDecode(bs []byte) error {
+	return es.UnmarshalJSON(bs)
+}
@@ -0,0 +1,110 @@
+// This file handles score tables. Each scenario has its own table, and the
+// standard game too. Wizard mode runs are not scored.
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// scoresFile is the data file where score tables are saved.
+const scoresFile = "scores.json"
+
+// maxScores is the number of entries kept in each score table.
+const maxScores = 10
+
+// scoreEntry is an entry of a score table.
+type scoreEntry struct {
+	Name    string    `json:"name,omitempty"`
+	Score   int       `json:"score"`
+	Depth   int       `json:"depth"`
+	Outcome string    `json:"outcome"` // how the run ended (died, won)
+	Date    time.Time `json:"date"`
+}
+
+// scoreTables maps scenario names to their score table, ordered from best
+// to worst.
+type scoreTables map[string][]scoreEntry
+
+// LoadScores loads the score tables. Missing or invalid files result in
+// empty tables.
+func LoadScores() scoreTables {
+	sts := scoreTables{}
+	data, err := LoadFile(scoresFile)
+	if err != nil {
+		return sts
+	}
+	if err := json.Unmarshal(data, &sts); err != nil {
+		return scoreTables{}
+	}
+	return sts
+}
+
+// Best returns the best score of the given table, or 0 if it is empty.
+func (sts scoreTables) Best(name string) int {
+	if len(sts[name]) == 0 {
+		return 0
+	}
+	return sts[name][0].Score
+}
+
+// Score returns the score of the current run: gold, plus a bonus for depth,
+// and another for winning.
+func (g *game) Score() int {
+	score := g.ECS.Player().Gold + 100*g.Depth
+	if g.Won {
+		score += winBonus
+	}
+	return score
+}
+
+// RecordScore adds the current run to the score table of its scenario, with
+// the given outcome. It returns the rank of the run in the table (starting
+// from 1), or 0 if the run did not make it into the table or is not scored.
+func (g *game) RecordScore(outcome string) (int, error) {
+	if g.Options.Wizard {
+		return 0, nil
+	}
+	sts := LoadScores()
+	name := g.ScenarioName()
+	e := scoreEntry{Name: g.ECS.Name[g.ECS.PlayerID], Score: g.Score(), Depth: g.Depth, Outcome: outcome, Date: time.Now()}
+	table := append(sts[name], e)
+	sort.SliceStable(table, func(i, j int) bool { return table[i].Score > table[j].Score })
+	rank := 0
+	for k := range table {
+		if table[k] == e {
+			rank = k + 1
+			break
+		}
+	}
+	if len(table) > maxScores {
+		table = table[:maxScores]
+	}
+	if rank > maxScores {
+		rank = 0
+	}
+	sts[name] = table
+	data, err := json.Marshal(sts)
+	if err != nil {
+		return 0, err
+	}
+	return rank, SaveFile(scoresFile, data)
+}
+
+// RecordScore records the score of the current run with the given outcome,
+// and logs the result.
+func (m *model) RecordScore(outcome string) {
+	g := m.game
+	rank, err := g.RecordScore(outcome)
+	switch {
+	case err != nil:
+		g.Logf("Could not save score: %v", ColorLogSpecial, err)
+	case g.Options.Wizard:
+	case rank > 0:
+		g.Logf("Score: %d (rank %d in the %s table).", ColorLogSpecial, g.Score(), rank, g.ScenarioName())
+	default:
+		g.Logf("Score: %d.", ColorLogSpecial, g.Score())
+	}
+}
@@ -0,0 +1,154 @@
+// This file extends the SDL driver so that key releases and focus losses are
+// reported: releases tell a new press of a movement key from a held one (see
+// keyrepeat.go), and a focus loss pauses and saves the game (see suspend.go).
+//
+// Events are caught with an event watch, which runs when SDL queues them,
+// before the driver dequeues and reports the previous ones. Key releases may
+// thus be reported before the corresponding presses, so presses and releases
+// of movement keys are both timed with SDL's event timestamps, so that the
+// model can order them.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/anaseto/gruid"
+	sdl "github.com/anaseto/gruid-sdl"
+	sdl2 "github.com/veandco/go-sdl2/sdl"
+)
+
+// sdlDriver wraps the SDL driver, sending a msgKeyUp message each time a
+// movement key is released, and a msgFocusLost message when the window loses
+// focus.
+type sdlDriver struct {
+	*sdl.Driver
+}
+
+// sdlKeyDown is a movement key press queued by SDL.
+type sdlKeyDown struct {
+	Key  gruid.Key
+	Time time.Time
+}
+
+// maxQueuedKeyDowns is the maximum number of queued movement key presses
+// waiting for the corresponding driver message.
+const maxQueuedKeyDowns = 64
+
+// sdlMovementKey returns the movement key of an SDL key symbol, or an empty
+// key if it is not a movement key. Letters are only reported by the driver
+// as text input, so they are handled only if text is true.
+func sdlMovementKey(ks sdl2.Keysym, text bool) gruid.Key {
+	switch ks.Sym {
+	case sdl2.K_LEFT:
+		return gruid.KeyArrowLeft
+	case sdl2.K_DOWN:
+		return gruid.KeyArrowDown
+	case sdl2.K_UP:
+		return gruid.KeyArrowUp
+	case sdl2.K_RIGHT:
+		return gruid.KeyArrowRight
+	case sdl2.K_h, sdl2.K_j, sdl2.K_k, sdl2.K_l:
+		if text {
+			return gruid.Key(rune(ks.Sym))
+		}
+		return ""
+	}
+	if ks.Mod&sdl2.KMOD_NUM == 0 {
+		// Like the driver, handle the keypad as arrows when num lock
+		// is off.
+		switch ks.Sym {
+		case sdl2.K_KP_4:
+			return gruid.KeyArrowLeft
+		case sdl2.K_KP_2:
+			return gruid.KeyArrowDown
+		case sdl2.K_KP_8:
+			return gruid.KeyArrowUp
+		case sdl2.K_KP_6:
+			return gruid.KeyArrowRight
+		}
+	}
+	return ""
+}
+
+// PollMsgs implements gruid.Driver.PollMsgs. Messages of the SDL driver are
+// forwarded, with the SDL time of the event for movement key presses.
+func (dr sdlDriver) PollMsgs(ctx context.Context, msgs chan<- gruid.Msg) error {
+	// SDL timestamps are in milliseconds since SDL initialization.
+	epoch := time.Now().Add(-time.Duration(sdl2.GetTicks()) * time.Millisecond)
+	sdlTime := func(ts uint32) time.Time {
+		return epoch.Add(time.Duration(ts) * time.Millisecond)
+	}
+	send := func(msg gruid.Msg) {
+		select {
+		case msgs <- msg:
+		case <-ctx.Done():
+		}
+	}
+	var mu sync.Mutex
+	downs := []sdlKeyDown{}
+	queue := func(key gruid.Key, ts uint32) {
+		if key == "" {
+			return
+		}
+		mu.Lock()
+		if len(downs) >= maxQueuedKeyDowns {
+			downs = downs[1:]
+		}
+		downs = append(downs, sdlKeyDown{Key: key, Time: sdlTime(ts)})
+		mu.Unlock()
+	}
+	h := sdl2.AddEventWatchFunc(func(ev sdl2.Event, _ interface{}) bool {
+		switch ev := ev.(type) {
+		case *sdl2.KeyboardEvent:
+			switch ev.Type {
+			case sdl2.KEYDOWN:
+				queue(sdlMovementKey(ev.Keysym, false), ev.Timestamp)
+			case sdl2.KEYUP:
+				if key := sdlMovementKey(ev.Keysym, true); key != "" {
+					send(msgKeyUp{Key: key, Time: sdlTime(ev.Timestamp)})
+				}
+			}
+		case *sdl2.TextInputEvent:
+			switch s := ev.GetText(); s {
+			case "h", "j", "k", "l":
+				queue(gruid.Key(s), ev.Timestamp)
+			}
+		case *sdl2.WindowEvent:
+			if ev.Event == sdl2.WINDOWEVENT_FOCUS_LOST {
+				send(msgFocusLost{})
+			}
+		}
+		return true
+	}, nil)
+	defer sdl2.DelEventWatch(h)
+	in := make(chan gruid.Msg)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- dr.Driver.PollMsgs(ctx, in)
+	}()
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case msg := <-in:
+			if msg, ok := msg.(gruid.MsgKeyDown); ok && isMovementKey(msg.Key) {
+				mu.Lock()
+				for len(downs) > 0 {
+					d := downs[0]
+					downs = downs[1:]
+					if d.Key == msg.Key {
+						msg.Time = d.Time
+						break
+					}
+				}
+				mu.Unlock()
+				send(msg)
+				continue
+			}
+			send(msg)
+		}
+	}
+}
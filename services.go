@@ -0,0 +1,272 @@
+// This file implements services offered by town NPCs, like healing or selling
+// items, as well as the town stash, and the menu used to buy or use them.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// service represents a paid service offered by a town NPC. The Do function
+// performs the service for the player, and returns an error if the service
+// is not needed.
+type service struct {
+	Name string
+	Cost int
+	Do   func(g *game) error
+}
+
+// Services returns the services offered by the NPC i, if any.
+func (g *game) Services(i int) []service {
+	npc, ok := g.ECS.Entities[i].(*NPC)
+	if !ok {
+		return nil
+	}
+	switch npc.Role {
+	case NPCHealer:
+		return g.healerServices()
+	case NPCShopkeeper:
+		return append(g.shopServices(), g.theftServices(i)...)
+	case NPCStash:
+		return g.stashServices()
+	}
+	return nil
+}
+
+// ailments lists the harmful statuses cured by the healer. Helpful statuses,
+// like haste or regeneration, are kept.
+var ailments = []status{
+	StatusConfused,
+	StatusSlowed,
+	StatusPoisoned,
+	StatusWebbed,
+	StatusParalyzed,
+	StatusBurning,
+	StatusBleeding,
+}
+
+// healerServices returns the services offered by the healer: curing wounds,
+// with a cost depending on missing HP, and curing ailments.
+func (g *game) healerServices() []service {
+	f := g.ECS.Fighter[g.ECS.PlayerID]
+	cost := (f.MaxHP - f.HP + 1) / 2
+	if cost < 5 {
+		cost = 5
+	}
+	cost = g.Price(cost)
+	return []service{
+		{Name: "heal wounds", Cost: cost, Do: func(g *game) error {
+			f := g.ECS.Fighter[g.ECS.PlayerID]
+			if f.HP == f.MaxHP {
+				return errors.New("You are not wounded.")
+			}
+			f.HP = f.MaxHP
+			g.Logf("The healer tends your wounds. You feel fully healed.", ColorLogItemUse)
+			return nil
+		}},
+		{Name: "cure ailments", Cost: g.Price(10), Do: func(g *game) error {
+			cured := false
+			for _, st := range ailments {
+				if g.ECS.Status(g.ECS.PlayerID, st) {
+					delete(g.ECS.Statuses[g.ECS.PlayerID], st)
+					cured = true
+				}
+			}
+			if !cured {
+				return errors.New("You have no ailments.")
+			}
+			g.Logf("The healer cures your ailments.", ColorLogItemUse)
+			return nil
+		}},
+	}
+}
+
+// ware describes an item sold by the shopkeeper, with its base price.
+type ware struct {
+	Name  string
+	Price int
+}
+
+// shopWares lists the items sold by the shopkeeper.
+var shopWares = []ware{
+	{Name: "health potion", Price: 15},
+	{Name: "regeneration potion", Price: 20},
+	{Name: "confusion scroll", Price: 20},
+	{Name: "teleport scroll", Price: 25},
+	{Name: "fireball scroll", Price: 35},
+	{Name: "arrows", Price: 10},
+}
+
+// shopArrows is the number of arrows in a bundle sold by the shopkeeper.
+const shopArrows = 10
+
+// shopServices returns the services offered by the shopkeeper: selling
+// uncursed items, whose blessing state is known.
+func (g *game) shopServices() []service {
+	svcs := []service{}
+	for _, w := range shopWares {
+		if w.Name == "health potion" && g.Rule(RuleNoHealingPotions) {
+			continue
+		}
+		name := w.Name
+		if name == "arrows" {
+			name = arrowsName(shopArrows)
+		}
+		w := w
+		svcs = append(svcs, service{Name: "buy " + name, Cost: g.Price(w.Price), Do: func(g *game) error {
+			return g.BuyWare(w)
+		}})
+	}
+	return svcs
+}
+
+// BuyWare adds a newly bought item to the player's inventory.
+func (g *game) BuyWare(w ware) error {
+	return g.TakeWare(w, "buy")
+}
+
+// TakeWare adds a ware of the shop to the player's inventory, logging it with
+// the given verb.
+func (g *game) TakeWare(w ware, verb string) error {
+	pid := g.ECS.PlayerID
+	var i int
+	if w.Name == "arrows" {
+		i = g.AddArrows(shopArrows, g.ECS.PP())
+		if g.StackArrows(pid, i) {
+			g.Logf("You %s %s.", ColorLogItemUse, verb, arrowsName(shopArrows))
+			return nil
+		}
+	} else {
+		var err error
+		i, err = g.AddNamedItem(w.Name, g.ECS.PP())
+		if err != nil {
+			return err
+		}
+		g.ECS.BUC[i] = &BUC{Blessing: Uncursed, Known: true}
+	}
+	if err := g.InventoryAdd(pid, i); err != nil {
+		g.ECS.RemoveEntity(i)
+		return err
+	}
+	g.Logf("You %s %s.", ColorLogItemUse, verb, g.ECS.GetName(i))
+	return nil
+}
+
+// maxStashSize is the maximum number of items in the town stash.
+const maxStashSize = 10
+
+// stashServices returns the actions available with the town stash chest:
+// storing an inventory item, or taking back a stored item. They are free.
+func (g *game) stashServices() []service {
+	pid := g.ECS.PlayerID
+	svcs := []service{}
+	for _, i := range g.ECS.Inventory[pid].Items {
+		i := i
+		svcs = append(svcs, service{Name: "store " + g.ECS.GetName(i), Do: func(g *game) error {
+			return g.StoreItem(i)
+		}})
+	}
+	for _, i := range g.Stash.Items {
+		i := i
+		svcs = append(svcs, service{Name: "take " + g.ECS.GetName(i), Do: func(g *game) error {
+			return g.TakeStashedItem(i)
+		}})
+	}
+	return svcs
+}
+
+// StoreItem moves the item i from the player's inventory to the stash.
+func (g *game) StoreItem(i int) error {
+	if len(g.Stash.Items) >= maxStashSize {
+		return errors.New("Your stash is full.")
+	}
+	pid := g.ECS.PlayerID
+	if g.ECS.Equipped(pid, i) {
+		if err := g.Unequip(pid, i); err != nil {
+			return err
+		}
+	}
+	inv := g.ECS.Inventory[pid]
+	for n, j := range inv.Items {
+		if j == i {
+			inv.Items = append(inv.Items[:n], inv.Items[n+1:]...)
+			break
+		}
+	}
+	g.Stash.Items = append(g.Stash.Items, i)
+	g.Logf("You store %s in your stash.", ColorLogItemUse, g.ECS.GetName(i))
+	return nil
+}
+
+// TakeStashedItem moves the item i from the stash to the player's inventory.
+func (g *game) TakeStashedItem(i int) error {
+	name := g.ECS.GetName(i)
+	pid := g.ECS.PlayerID
+	if !g.StackArrows(pid, i) {
+		if err := g.InventoryAdd(pid, i); err != nil {
+			return err
+		}
+	}
+	for n, j := range g.Stash.Items {
+		if j == i {
+			g.Stash.Items = append(g.Stash.Items[:n], g.Stash.Items[n+1:]...)
+			break
+		}
+	}
+	g.Logf("You take %s from your stash.", ColorLogItemUse, name)
+	return nil
+}
+
+// BuyService makes the player buy the n-th service offered by the NPC i.
+func (g *game) BuyService(i, n int) error {
+	svcs := g.Services(i)
+	if n < 0 || n >= len(svcs) {
+		return errors.New("Invalid service.")
+	}
+	svc := svcs[n]
+	player := g.ECS.Player()
+	if player.Gold < svc.Cost {
+		return errors.New("You do not have enough gold.")
+	}
+	if err := svc.Do(g); err != nil {
+		return err
+	}
+	player.Gold -= svc.Cost
+	return nil
+}
+
+// OpenServices opens the service menu for the NPC i.
+func (m *model) OpenServices(i int) {
+	m.npc = i
+	lp := listPicker{
+		Title:   fmt.Sprintf("%s (you have %d gold)", m.game.ECS.Name[i], m.game.ECS.Player().Gold),
+		Letters: true,
+	}
+	for _, svc := range m.game.Services(i) {
+		text := svc.Name
+		if svc.Cost > 0 {
+			text = fmt.Sprintf("%s (%d gold)", svc.Name, svc.Cost)
+		}
+		lp.Entries = append(lp.Entries, pickerEntry{Text: text})
+	}
+	m.services = lp.Menu()
+}
+
+// updateServices handles input messages when the service menu is open.
+func (m *model) updateServices(msg gruid.Msg) {
+	m.services.Update(msg)
+	switch m.services.Action() {
+	case ui.MenuQuit:
+		m.mode = modeNormal
+	case ui.MenuInvoke:
+		err := m.game.BuyService(m.npc, m.services.Active())
+		if err != nil {
+			m.game.Logf("%v", ColorLogSpecial, err)
+		}
+		m.mode = modeNormal
+	}
+}
@@ -0,0 +1,122 @@
+// This file implements special levels: fixed one-room levels, described by
+// whole-level prefabs with scripted entity placements, that occasionally
+// replace a procedurally generated level.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+)
+
+// specialLevelChance is the percentage chance for an intermediate level to
+// be a special level.
+const specialLevelChance = 10
+
+// specialLevel describes a special level.
+type specialLevel struct {
+	Name   string // name of the special level
+	Intro  string // message shown when entering the level
+	Prefab prefab // whole-level prefab
+}
+
+// specialLevels lists the available special levels.
+var specialLevels = []specialLevel{
+	{Name: "flooded cavern", Intro: "You wade into a flooded cavern.", Prefab: floodedCavern},
+	{Name: "orc throne room", Intro: "You hear drums: this is an orc throne room!", Prefab: orcThroneRoom},
+	{Name: "treasure maze", Intro: "You enter a maze. You smell treasure.", Prefab: treasureMaze},
+}
+
+// floodedCavern is a cavern with large pools of deep water, crossed by a few
+// bridges.
+var floodedCavern = prefab{
+	"##################################################",
+	"#@.....~~~~~~.........~~~~~~~~.........~~~~~.....#",
+	"#.....~~~~~~~~~......===========......=======..w.#",
+	"#....===========....~~~~~~~~~===~....~~~~~~~~~...#",
+	"#.....~~~~~~~~~......~~~~~~~~===~~~~~~~~~~~~~....#",
+	"#.......~~~~~..........~~~~~~===~~~~~~~~~~~......#",
+	"#..~~~~~~~~~~~~~~~~~~~~~~~~~~===~~~~~~~~~~~~~~~..#",
+	"#.~~~~~~~~~~~~~~~~~~~~~~~~~~~===~~~~~~~~~~~~~~~~.#",
+	"#..~~~~~~~~~~~~~~~~~~~~~~~~~~===~~~~~~~~~~~~~~~..#",
+	"#......~~~~~~~...........~~~...~~......~~~~......#",
+	"#..w..~~~~~~~~~..$......~~~.....~~....======..o..#",
+	"#....===========.......~~~~..>..~~~..~~~~~~~~....#",
+	"#.....~~~~~~~~~.........~~~.....==....~~~~~~.$...#",
+	"#.......~~~~~.............~~...~~......~~~~......#",
+	"##################################################",
+}
+
+// orcThroneRoom is a pillared hall guarded by orcs, with their chieftain and
+// some treasure at the far end.
+var orcThroneRoom = prefab{
+	"############################################################",
+	"#.......#......................................#...........#",
+	"#.......#...o..........................o.......#.....$.....#",
+	"#..@....#......................................#...........#",
+	"#.......#.....#.....#.....#.....#.....#........#######.#####",
+	"#..........................................o...............#",
+	"#.......#......................................#..K........#",
+	"#.......#......................................#...........#",
+	"#..........................................o...............#",
+	"#.......#.....#.....#.....#.....#.....#........#######.#####",
+	"#.......#......................................#...........#",
+	"#.......#...o..........................o.......#.....>.....#",
+	"#.......#......................................#.....$.....#",
+	"############################################################",
+}
+
+// treasureMaze is a maze with treasure in some dead ends, and a few monsters.
+var treasureMaze = prefab{
+	"###########################################################",
+	"#@..#....o#...........#.........#.....#.......#.....#.....#",
+	"###.#.#####.###.#####.#########.#.#.#.#.###.###.#.#.#.###.#",
+	"#...#...#...#.#...#...#.......#...#.#.#...#.#...#.#$#.#.#.#",
+	"#.###.#.#.###.###.#.###.#####.#####.#.###.#.#.###.###.#.#.#",
+	"#.#...#.#.#.....#...#...#$..#.#...#.#.#...#...#$#...#...#.#",
+	"#.#.###.#.#.#####.#.#.#####.#.#.#.#.#.#####.###.###.###.#.#",
+	"#.#...#.....#...#.#...#...#.#.#.#...#.....#.......#.....#.#",
+	"#.#.#.#######.#.#.#####.#.#.#.#.#########.#####.#.#######.#",
+	"#.#.....#.....#.#.....#.#.#...#...#.....#...#...#.......#.#",
+	"#.#####.#.#####.#####.#.#.###.###.#.###.###.#.#.#####.###.#",
+	"#...#$#.#.#o..#.....#...#...#...#.#...#.....#.#...#...#...#",
+	"###.#.#.#.###.#####.#.###.#.###.#.###.#######.#.#.#####.#.#",
+	"#...#...#.#...#.......#.....#.#.#...#.#...#$....#.....#.#.#",
+	"#.#######.#.###.#######.#####.#.#.#.#.#.#.#####.#####.#.#.#",
+	"#.#.......#.....#...#...#...#...#.#.#.#.#.#...#.#...#...#.#",
+	"#.#.#######.#####.#.#.###.###.###.#.#.#.#.#.#.#.#.#.#####.#",
+	"#...#$............#...#.............#...#...#...#T#......>#",
+	"###########################################################",
+}
+
+// generateSpecial fills the map with a random special level: the level's
+// prefab is stamped in the middle of a map filled with walls.
+func (m *Map) generateSpecial() {
+	m.reset()
+	sl := specialLevels[m.rand.Intn(len(specialLevels))]
+	m.Special = sl.Name
+	m.Grid.Fill(Wall)
+	origin := m.Grid.Size().Sub(sl.Prefab.Size()).Div(2)
+	m.StampPrefab(sl.Prefab, origin)
+	m.recordPhase(sl.Name)
+}
+
+// SpecialIntro returns the message shown when entering the current special
+// level, if any.
+func (m *Map) SpecialIntro() string {
+	for _, sl := range specialLevels {
+		if sl.Name == m.Special {
+			return sl.Intro
+		}
+	}
+	return ""
+}
+
+// StartPosition returns the starting position of the player in the current
+// map: the spot marked in a prefab, if any, or a random floor position.
+func (m *Map) StartPosition() gruid.Point {
+	starts := m.Placements[PlaceStart]
+	if len(starts) == 0 {
+		return m.RandomFloor()
+	}
+	return starts[0]
+}
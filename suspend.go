@@ -0,0 +1,80 @@
+// This file handles auto-suspend: when the driver requests termination of
+// the application, for example because the window is being closed, the game
+// in progress is saved before quitting, so that progress is never lost. The
+// game is also paused and saved when the window loses focus.
+
+package main
+
+import (
+	"log"
+
+	"github.com/anaseto/gruid"
+)
+
+// SaveGame saves the game in progress, either as an event log or as a
+// snapshot, depending on the run's options. With drop, the last recorded
+// event is dropped from the event log, like the save command itself.
+func (m *model) SaveGame(drop bool) error {
+	if m.events != nil {
+		return m.SaveEvents(eventsFile, drop)
+	}
+	data, err := EncodeGame(m.game)
+	if err != nil {
+		return err
+	}
+	return SaveFile(saveFile, data)
+}
+
+// inGame reports whether a game is in progress, and not over.
+func (m *model) inGame() bool {
+	if m.game == nil || m.mode == modeEnd {
+		return false
+	}
+	md := m.mode
+	if md == modePrompt {
+		md = m.prompt.back
+	}
+	switch md {
+	case modeGameMenu, modeChallenges:
+		return false
+	}
+	return true
+}
+
+// msgFocusLost reports that the game window lost focus. It is sent by the
+// driver wrapper in sdlkeys.go.
+type msgFocusLost struct{}
+
+// autoSave stops running automatic actions, and saves the game in progress,
+// if any.
+func (m *model) autoSave() error {
+	m.hold = keyHold{}
+	m.anim = nil
+	if !m.inGame() {
+		return nil
+	}
+	return m.SaveGame(false)
+}
+
+// Suspend handles a termination request from the driver. Running automatic
+// actions are stopped, and the game in progress, if any, is saved before
+// quitting. If saving fails, the application keeps running, so that the
+// player does not lose the game.
+func (m *model) Suspend() gruid.Effect {
+	if err := m.autoSave(); err != nil {
+		log.Printf("could not save game on quit request: %v", err)
+		m.game.Logf("Could not save game: not quitting.", ColorLogSpecial)
+		return nil
+	}
+	return gruid.End()
+}
+
+// Pause handles a loss of focus of the window: like Suspend, it stops running
+// automatic actions and saves the game in progress, but without quitting.
+func (m *model) Pause() gruid.Effect {
+	if err := m.autoSave(); err != nil {
+		log.Printf("could not save game on focus loss: %v", err)
+		m.game.Logf("Could not save game.", ColorLogSpecial)
+	}
+	return nil
+}
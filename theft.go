@@ -0,0 +1,65 @@
+// This file implements shop theft: the player can steal the shopkeeper's
+// wares, but the shopkeeper then turns hostile, and town guards come from the
+// town entrance.
+
+package main
+
+import "github.com/anaseto/gruid"
+
+// townGuards is the number of guards coming after a theft.
+const townGuards = 2
+
+// theftServices returns the theft actions available at the shopkeeper i:
+// stealing one of the wares.
+func (g *game) theftServices(i int) []service {
+	svcs := []service{}
+	for _, w := range shopWares {
+		if w.Name == "health potion" && g.Rule(RuleNoHealingPotions) {
+			continue
+		}
+		name := w.Name
+		if name == "arrows" {
+			name = arrowsName(shopArrows)
+		}
+		w := w
+		svcs = append(svcs, service{Name: "steal " + name, Do: func(g *game) error {
+			return g.Steal(i, w)
+		}})
+	}
+	return svcs
+}
+
+// Steal makes the player steal a ware from the shopkeeper i, who turns
+// hostile and calls the town guards.
+func (g *game) Steal(i int, w ware) error {
+	if err := g.TakeWare(w, "steal"); err != nil {
+		return err
+	}
+	g.Thief = true
+	p := g.ECS.Positions[i]
+	g.ECS.RemoveEntity(i)
+	g.AddMonster(MonsterShopkeeper, p)
+	g.Logf("The shopkeeper shouts: “Thief! Guards!”", ColorLogMonsterAttack)
+	g.AddReputation(theftReputation, "theft")
+	g.CallGuards()
+	return nil
+}
+
+// CallGuards spawns town guards on the free floor tiles nearest to the town
+// entrance.
+func (g *game) CallGuards() {
+	start := g.Map.StartPosition()
+	size := g.Map.Grid.Size()
+	nodes := g.PR.BreadthFirstMap(&path{m: g.Map}, []gruid.Point{start}, size.X*size.Y)
+	n := 0
+	for _, nd := range nodes {
+		if n >= townGuards {
+			break
+		}
+		if g.Map.Grid.At(nd.P) != Floor || !g.ECS.NoBlockingEntityAt(nd.P) {
+			continue
+		}
+		g.AddMonster(MonsterTownGuard, nd.P)
+		n++
+	}
+}
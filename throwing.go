@@ -0,0 +1,101 @@
+// This file implements throwing potions at monsters: the potion shatters on
+// the target, and its effect applies to the target instead of the thrower.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// potionThrowRange is the maximal distance at which potions can be thrown.
+const potionThrowRange = 6
+
+// Throwable describes consumables that can be thrown at a target.
+type Throwable interface {
+	Consumable
+	// ThrowRange returns the maximal distance at which the item can be
+	// thrown.
+	ThrowRange() int
+}
+
+func (pt *HealingPotion) ThrowRange() int      { return potionThrowRange }
+func (pt *StrengthPotion) ThrowRange() int     { return potionThrowRange }
+func (pt *PoisonPotion) ThrowRange() int       { return potionThrowRange }
+func (pt *RegenerationPotion) ThrowRange() int { return potionThrowRange }
+
+// CheckThrow returns an error if the n-th item of the actor's inventory
+// cannot be thrown.
+func (g *game) CheckThrow(actor, n int) error {
+	inv := g.ECS.Inventory[actor]
+	if len(inv.Items) <= n {
+		return errors.New("Empty slot.")
+	}
+	if _, ok := g.ECS.Entities[inv.Items[n]].(Throwable); !ok {
+		return errors.New("You can only throw potions.")
+	}
+	return nil
+}
+
+// Throw makes the actor throw the n-th item of its inventory at p. The item
+// shatters, and its effect applies to the monster at p, if any. It returns
+// the path followed by the item, for animation purposes.
+func (g *game) Throw(actor, n int, p gruid.Point) ([]gruid.Point, error) {
+	if err := g.CheckThrow(actor, n); err != nil {
+		return nil, err
+	}
+	inv := g.ECS.Inventory[actor]
+	i := inv.Items[n]
+	e := g.ECS.Entities[i].(Throwable)
+	from := g.ECS.Positions[actor]
+	if p == from {
+		return nil, errors.New("You cannot throw a potion at yourself.")
+	}
+	if !g.InFOV(p) {
+		return nil, errors.New("You cannot target what you cannot see.")
+	}
+	if paths.DistanceManhattan(from, p) > e.ThrowRange() {
+		return nil, errors.New("Your target is out of range.")
+	}
+	if !g.ClearShot(from, p) {
+		return nil, errors.New("You have no clear line of throw.")
+	}
+	inv.Items[n] = inv.Items[len(inv.Items)-1]
+	inv.Items = inv.Items[:len(inv.Items)-1]
+	name := g.ECS.GetName(i)
+	a := itemAction{Actor: g.ECS.MonsterAt(p)}
+	if buc := g.ECS.BUC[i]; buc != nil {
+		a.Blessing = buc.Blessing
+	}
+	g.ECS.RemoveEntity(i)
+	path := linePoints(from, p)
+	if a.Actor < 0 || !g.ECS.Alive(a.Actor) {
+		g.Logf("The %s shatters on the ground.", ColorLogItemUse, name)
+		return path, nil
+	}
+	g.Logf("The %s shatters on %v.", ColorLogItemUse, name,
+		g.ECS.HighlightName(a.Actor, g.ECS.Name[a.Actor]))
+	if err := e.Activate(g, a); err != nil {
+		g.Logf("%v", ColorLogSpecial, err)
+	}
+	return path, nil
+}
+
+// logSplash logs the visible effect of a thrown potion on monster i, with a
+// format taking the monster's name as argument.
+func (g *game) logSplash(i int, format string, color gruid.Color) {
+	if !g.InFOV(g.ECS.Positions[i]) {
+		return
+	}
+	g.Logf(format, color, g.ECS.HighlightName(i, strings.Title(g.ECS.Name[i])))
+}
+
+// errSplashNoEffect returns the error of a thrown potion without effect on
+// monster i.
+func (g *game) errSplashNoEffect(i int) error {
+	return fmt.Errorf("%s is unaffected.", strings.Title(g.ECS.Name[i]))
+}
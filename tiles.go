@@ -33,20 +33,40 @@ func (t *TileDrawer) GetImage(c gruid.Cell) image.Image {
 	switch c.Style.Bg {
 	case ColorFOV:
 		bg = image.NewUniform(color.RGBA{0x18, 0x49, 0x56, 255})
+	case ColorDarkFOV:
+		bg = image.NewUniform(color.RGBA{0x14, 0x42, 0x4f, 255})
+	case ColorMonsterVision:
+		bg = image.NewUniform(color.RGBA{0x3a, 0x2f, 0x48, 255})
+	case ColorDangerLow:
+		bg = image.NewUniform(color.RGBA{0x3b, 0x3a, 0x2c, 255})
+	case ColorDangerMedium:
+		bg = image.NewUniform(color.RGBA{0x55, 0x3a, 0x26, 255})
+	case ColorDangerHigh:
+		bg = image.NewUniform(color.RGBA{0x6e, 0x2a, 0x28, 255})
 	}
 	switch c.Style.Fg {
-	case ColorPlayer, ColorLogItemUse:
+	case ColorPlayer, ColorLogItemUse, ColorAlly:
 		fg = image.NewUniform(color.RGBA{0x46, 0x95, 0xf7, 255})
 	case ColorMonster:
 		fg = image.NewUniform(color.RGBA{0xfa, 0x57, 0x50, 255})
 	case ColorLogPlayerAttack, ColorStatusHealthy:
 		fg = image.NewUniform(color.RGBA{0x75, 0xb9, 0x38, 255})
-	case ColorLogMonsterAttack, ColorStatusWounded:
+	case ColorLogMonsterAttack, ColorStatusWounded, ColorBrazier:
 		fg = image.NewUniform(color.RGBA{0xed, 0x86, 0x49, 255})
-	case ColorLogSpecial:
+	case ColorLogSpecial, ColorUnique:
 		fg = image.NewUniform(color.RGBA{0xf2, 0x75, 0xbe, 255})
-	case ColorConsumable, ColorMenuActive:
+	case ColorConsumable, ColorMenuActive, ColorBridge:
 		fg = image.NewUniform(color.RGBA{0xdb, 0xb3, 0x2d, 255})
+	case ColorFoliage, ColorZombie, ColorPoison:
+		fg = image.NewUniform(color.RGBA{0x41, 0xc7, 0xb9, 255})
+	case ColorBones:
+		fg = image.NewUniform(color.RGBA{0xca, 0xd8, 0xd9, 255})
+	case ColorMushrooms, ColorNPC, ColorLogAbility:
+		fg = image.NewUniform(color.RGBA{0xaf, 0x88, 0xeb, 255})
+	case ColorPool:
+		fg = image.NewUniform(color.RGBA{0x46, 0x95, 0xf7, 255})
+	case ColorFire:
+		fg = image.NewUniform(color.RGBA{0xf5, 0x5a, 0x2c, 255})
 	}
 	if c.Style.Attrs&AttrReverse != 0 {
 		fg, bg = bg, fg
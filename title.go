@@ -0,0 +1,109 @@
+// This file implements the title screen: the main menu is drawn over a cave
+// background generated for the occasion, in which a slowly wandering light
+// reveals the terrain.
+
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// titleTickDelay is the duration between two frames of the title screen's
+// background animation.
+const titleTickDelay = 100 * time.Millisecond
+
+// titleLightRadius is the radius of the wandering light of the title
+// screen's background.
+const titleLightRadius = 9
+
+// titleScreen holds the state of the title screen's background.
+type titleScreen struct {
+	Map   *Map // throwaway map, never played
+	Frame int  // current animation frame
+}
+
+// msgTitleTick is sent to advance the title screen's background animation.
+type msgTitleTick struct{}
+
+// titleTickCmd returns a command that sends a message for the next frame of
+// the title screen after a delay.
+func titleTickCmd() gruid.Cmd {
+	return func() gruid.Msg {
+		time.Sleep(titleTickDelay)
+		return msgTitleTick{}
+	}
+}
+
+// dailySeed returns the seed of the day for the given time: the same for
+// every player on a given day, so that runs can be compared.
+func dailySeed(t time.Time) int64 {
+	y, mo, d := t.Date()
+	return int64(y*10000 + int(mo)*100 + d)
+}
+
+// newTitleScreen returns a title screen with a cave background generated from
+// the given seed.
+func newTitleScreen(seed int64) *titleScreen {
+	bg := newMap(gruid.Point{UIWidth, UIHeight}, 1, seed)
+	bg.generate()
+	return &titleScreen{Map: bg}
+}
+
+// nextTitleFrame advances the title screen's background animation, as long
+// as the title screen or one of its submenus is shown.
+func (m *model) nextTitleFrame() gruid.Effect {
+	if m.playing() || m.mode == modeMapGenDebug {
+		return nil
+	}
+	m.title.Frame++
+	return titleTickCmd()
+}
+
+// LightPos returns the position of the wandering light, which follows a slow
+// Lissajous curve over the map.
+func (ts *titleScreen) LightPos() gruid.Point {
+	t := float64(ts.Frame) / 40
+	size := ts.Map.Grid.Size()
+	x := float64(size.X)/2 + float64(size.X-10)/2*math.Sin(t)
+	y := float64(size.Y)/2 + float64(size.Y-6)/2*math.Sin(2*t+1)
+	return gruid.Point{int(x), int(y)}
+}
+
+// Draw draws the background into gd. Only the terrain close to the light is
+// visible, and the terrain closest to it is highlighted.
+func (ts *titleScreen) Draw(gd gruid.Grid) {
+	lp := ts.LightPos()
+	it := ts.Map.Grid.Iterator()
+	for it.Next() {
+		p := it.P()
+		d := p.Sub(lp)
+		// Cells are about twice as high as wide.
+		dist := math.Sqrt(float64(d.X*d.X) + float64(4*d.Y*d.Y))
+		if dist > titleLightRadius {
+			continue
+		}
+		c := gruid.Cell{Rune: ts.Map.Rune(it.Cell())}
+		c.Style.Fg = ts.Map.Color(it.Cell())
+		c.Style.Bg = ColorDarkFOV
+		if dist <= titleLightRadius/2 {
+			c.Style.Bg = ColorFOV
+		}
+		gd.Set(p, c)
+	}
+}
+
+// DrawTitle draws the game's name, version, and seed of the day above the
+// main menu.
+func (m *model) DrawTitle(gd gruid.Grid) {
+	label := &ui.Label{
+		Box: &ui.Box{},
+		Content: ui.Textf("Gruid Roguelike Tutorial  %v\nSeed of the day: %d",
+			build, dailySeed(time.Now())),
+		AdjustWidth: true,
+	}
+	label.Draw(gd.Slice(gd.Range().Shift(mainMenuAnchor.X, 1, 0, 0)))
+}
@@ -0,0 +1,112 @@
+// This file implements the surface town, a peaceful level at depth 0 from
+// which the player enters the dungeon, and to which the player can come back
+// by the stairs up found at the arrival spot of each dungeon level.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+)
+
+// townPrefab is the prefab for the town buildings. The player starts at the
+// '@' spot, and the '>' cell is the dungeon entrance.
+var townPrefab = prefab{
+	"......................................",
+	".#########..............#########.....",
+	".#.......#..............#.......#.....",
+	".#...S...#......>.......#...H...#.....",
+	".#.......#..............#.......#.....",
+	".####.####..............####.####.....",
+	"......................................",
+	".............E....@...................",
+	"......................................",
+	".#########..............#########.....",
+	".#.......#..............#.......#.....",
+	".#...C...#..............#.......#.....",
+	".####.####..............####.####.....",
+	"......................................",
+}
+
+// generateTown fills the map with the surface town: an open grassy field
+// surrounded by walls, with the town buildings in the middle.
+func (m *Map) generateTown() mapStats {
+	st := mapStats{Cells: m.Grid.Size().X * m.Grid.Size().Y}
+	m.Grid.Fill(Wall)
+	m.Grid.Slice(m.Grid.Range().Shift(1, 1, -1, -1)).Fill(Floor)
+	m.recordPhase("town field")
+	m.GenerateFoliage()
+	size := m.Grid.Size()
+	origin := size.Sub(townPrefab.Size()).Div(2)
+	m.StampPrefab(townPrefab, origin)
+	m.recordPhase("town buildings")
+	st.Floor = m.Grid.Count(Floor) + m.Grid.Count(Foliage)
+	st.Reachable = st.Floor
+	st.Spawn = m.Grid.Count(Floor)
+	return st
+}
+
+// npcRole describes the role of a non-player character in town.
+type npcRole int
+
+// These constants represent the roles of town characters.
+const (
+	NPCShopkeeper npcRole = iota
+	NPCHealer
+	NPCElder
+	NPCStash
+)
+
+// NPC represents a peaceful non-player character. Bumping into them makes the
+// player talk to them.
+type NPC struct {
+	Role npcRole `json:"role"`
+}
+
+// PlaceTownNPCs places the town characters on the spots marked in the town
+// prefab.
+func (g *game) PlaceTownNPCs() {
+	npcs := []struct {
+		pl    placement
+		role  npcRole
+		name  string
+		style Style
+	}{
+		{PlaceShopkeeper, NPCShopkeeper, "shopkeeper", Style{Rune: 'S', Color: ColorNPC}},
+		{PlaceHealer, NPCHealer, "healer", Style{Rune: 'H', Color: ColorNPC}},
+		{PlaceElder, NPCElder, "village elder", Style{Rune: 'E', Color: ColorNPC}},
+		{PlaceStash, NPCStash, "stash chest", Style{Rune: '■', Color: ColorNPC}},
+	}
+	for _, npc := range npcs {
+		for _, p := range g.Map.Placements[npc.pl] {
+			i := g.ECS.AddEntity(&NPC{Role: npc.role}, p)
+			g.ECS.Blocks[i] = true
+			g.ECS.Name[i] = npc.name
+			g.ECS.Style[i] = npc.style
+		}
+	}
+}
+
+// Talk makes the player talk to the NPC i.
+func (g *game) Talk(i int) {
+	npc := g.ECS.Entities[i].(*NPC)
+	switch npc.Role {
+	case NPCShopkeeper:
+		g.Logf("The shopkeeper says: “Have a look at my wares.”", ColorLogSpecial)
+	case NPCHealer:
+		g.Logf("The healer says: “Let me see those wounds.”", ColorLogSpecial)
+	case NPCElder:
+		g.Logf("The village elder says: “The dungeon entrance is just north of here.”", ColorLogSpecial)
+	case NPCStash:
+		g.Logf("You open your stash chest.", ColorLogSpecial)
+	}
+}
+
+// NPCAt returns the NPC at p, if any, or -1.
+func (es *ECS) NPCAt(p gruid.Point) int {
+	for _, i := range es.EntitiesAt(p) {
+		if _, ok := es.Entities[i].(*NPC); ok {
+			return i
+		}
+	}
+	return -1
+}
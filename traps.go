@@ -0,0 +1,60 @@
+// This file implements traps: terrain features, found from depth 2, that
+// poison fighters standing on them, or set them on fire.
+
+package main
+
+import "github.com/anaseto/gruid/rl"
+
+// trapPoisonTurns is the duration of the poison inflicted by a poison trap.
+const trapPoisonTurns = 5
+
+// GenerateTraps places a few poison or fire traps on plain floor cells: one
+// less than the depth, so that deeper levels are more dangerous.
+func (m *Map) GenerateTraps() {
+	for i := 1; i < m.Depth; i++ {
+		trap := PoisonTrap
+		if m.rand.Intn(2) == 0 {
+			trap = FireTrap
+		}
+		m.Grid.Set(m.RandomFloor(), trap)
+	}
+}
+
+// isTrap returns true if the given terrain is a trap.
+func isTrap(c rl.Cell) bool {
+	return c == PoisonTrap || c == FireTrap
+}
+
+func init() {
+	// Traps trigger once monsters have moved, before poison damage.
+	registerTurnHook(turnHook{Name: "traps", Order: turnMonsters + 1, Run: (*game).TriggerTraps})
+}
+
+// TriggerTraps poisons fighters standing on a poison trap, unless they are
+// already poisoned or undead, and sets on fire those standing on a fire trap.
+func (g *game) TriggerTraps() {
+	for _, i := range g.ECS.Fighter.sortedKeys() {
+		p := g.ECS.Positions[i]
+		if !g.ECS.Alive(i) {
+			continue
+		}
+		switch g.Map.Grid.At(p) {
+		case PoisonTrap:
+			if ai := g.ECS.AI[i]; g.ECS.Status(i, StatusPoisoned) || ai != nil && ai.Undead {
+				continue
+			}
+			g.ECS.PutStatus(i, StatusPoisoned, trapPoisonTurns)
+			switch {
+			case i == g.ECS.PlayerID:
+				g.Logf("A poison needle pricks you!", ColorLogMonsterAttack)
+			case g.InFOV(p) && !g.Unseen(i):
+				g.Logf("%v steps on a poison trap.", ColorLogAbility, g.ECS.HighlightName(i, g.ECS.GetName(i)))
+			}
+		case FireTrap:
+			if i == g.ECS.PlayerID && !g.ECS.Status(i, StatusBurning) {
+				g.Logf("Flames burst from the floor!", ColorLogMonsterAttack)
+			}
+			g.Ignite(i)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// This file implements auto-travel: a command that walks the player to the
+// nearest noteworthy feature of the explored map: an item seen on the ground
+// but not picked up, or stairs and altars not visited yet. Travel only goes
+// through explored cells, avoids known traps and fires, and stops as soon as
+// something would interrupt a repeated action.
+
+package main
+
+import (
+	"errors"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// maxTravelSteps is the maximum number of steps of a single travel.
+const maxTravelSteps = 200
+
+// travelPath implements the paths.Pather and paths.Astar interfaces for
+// travel over the explored part of the map.
+type travelPath struct {
+	g  *game
+	nb paths.Neighbors
+}
+
+// passable returns true if travel can go through p.
+func (tp *travelPath) passable(p gruid.Point) bool {
+	m := tp.g.Map
+	c := m.Grid.At(p)
+	return m.Explored[p] && m.Walkable(p) && !isTrap(c) && c != BurningGrass
+}
+
+func (tp *travelPath) Neighbors(q gruid.Point) []gruid.Point {
+	return tp.nb.Cardinal(q, tp.passable)
+}
+
+func (tp *travelPath) Cost(p, q gruid.Point) int {
+	return 1
+}
+
+func (tp *travelPath) Estimation(p, q gruid.Point) int {
+	return paths.DistanceManhattan(p, q)
+}
+
+// NoteFeatures updates the memory used by auto-travel: items in view are
+// remembered as seen, and the stairs or altar under the player as visited.
+func (g *game) NoteFeatures() {
+	if g.SeenItems == nil {
+		g.SeenItems = map[int]bool{}
+	}
+	if g.Visited == nil {
+		g.Visited = map[gruid.Point]bool{}
+	}
+	for i, p := range g.ECS.Positions {
+		if g.ECS.RenderOrder(i) == ROItem && g.InFOV(p) {
+			g.SeenItems[i] = true
+		}
+	}
+	pp := g.ECS.PP()
+	switch g.Map.Grid.At(pp) {
+	case Downstairs, Altar:
+		g.Visited[pp] = true
+	}
+}
+
+// noteworthy returns true if p is a travel destination.
+func (g *game) noteworthy(p gruid.Point) bool {
+	switch g.Map.Grid.At(p) {
+	case Downstairs, Altar:
+		if !g.Visited[p] {
+			return true
+		}
+	}
+	for _, i := range g.ECS.EntitiesAt(p) {
+		if g.SeenItems[i] && g.ECS.RenderOrder(i) == ROItem {
+			return true
+		}
+	}
+	return false
+}
+
+// TravelTarget returns the nearest travel destination, if any.
+func (g *game) TravelTarget() (gruid.Point, bool) {
+	pp := g.ECS.PP()
+	size := g.Map.Grid.Size()
+	tp := &travelPath{g: g}
+	for _, n := range g.PR.BreadthFirstMap(tp, []gruid.Point{pp}, size.X*size.Y) {
+		if n.P != pp && g.noteworthy(n.P) {
+			return n.P, true
+		}
+	}
+	return gruid.Point{}, false
+}
+
+// Travel walks the player toward the nearest travel destination, one turn
+// per step, until arrival or interruption: the player lost HP, a new hostile
+// monster came into view, or the way is blocked.
+func (g *game) Travel() error {
+	st := g.InterruptState()
+	switch {
+	case st.Hostiles > 0:
+		return errors.New("You cannot travel with enemies in view.")
+	case g.ECS.Status(g.ECS.PlayerID, StatusConfused):
+		return errors.New("You are too confused to travel.")
+	}
+	to, ok := g.TravelTarget()
+	if !ok {
+		return errors.New("There is nothing noteworthy left to travel to.")
+	}
+	path := g.PR.AstarPath(&travelPath{g: g}, g.ECS.PP(), to)
+	if len(path) > maxTravelSteps+1 {
+		path = path[:maxTravelSteps+1]
+	}
+	for _, q := range path[1:] {
+		if !g.ECS.NoBlockingEntityAt(q) {
+			g.Logf("Something blocks your way.", ColorLogSpecial)
+			return nil
+		}
+		g.Bump(q)
+		if g.ECS.PlayerDied() || g.ECS.PP() != q || st.Interrupts(g.InterruptState()) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// This file implements the end of turn hooks registry: subsystems that need
+// to do something each turn (monsters, respawning, poison, regeneration,
+// statuses...) register a hook, instead of being called from a hardcoded
+// sequence in EndTurn.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Hooks run in increasing order. The following values mark the phases of a
+// turn: hooks of a same phase use small offsets from the phase value, so that
+// their relative order is explicit.
+const (
+	turnStart    = 100 // per-turn bookkeeping and field of view
+	turnWorld    = 200 // level changes independent of monsters
+	turnMonsters = 300 // monsters act
+	turnEffects  = 400 // effects of the turn on fighters
+	turnStatuses = 500 // statuses count down
+)
+
+// turnHook describes something done at the end of each player's turn.
+type turnHook struct {
+	Name  string      // unique name, for diagnostics
+	Order int         // hooks with lower order run first
+	Alive bool        // only run if the player is still alive
+	Run   func(*game) // the hook itself
+}
+
+// turnHooks contains the registered hooks, sorted by order.
+var turnHooks []turnHook
+
+// registerTurnHook registers a hook to be run by EndTurn. It is meant to be
+// called from init functions, and panics on duplicate names. Hooks with the
+// same order run in name order, so that turns do not depend on the order in
+// which files are initialized.
+func registerTurnHook(h turnHook) {
+	for _, oh := range turnHooks {
+		if oh.Name == h.Name {
+			panic(fmt.Sprintf("duplicate turn hook: %s", h.Name))
+		}
+	}
+	turnHooks = append(turnHooks, h)
+	sort.SliceStable(turnHooks, func(i, j int) bool {
+		if turnHooks[i].Order != turnHooks[j].Order {
+			return turnHooks[i].Order < turnHooks[j].Order
+		}
+		return turnHooks[i].Name < turnHooks[j].Name
+	})
+}
+
+// runTurnHooks runs the registered hooks in order. Once the player has died,
+// hooks that only make sense for a living player are skipped.
+func (g *game) runTurnHooks() {
+	for _, h := range turnHooks {
+		if h.Alive && g.ECS.PlayerDied() {
+			continue
+		}
+		h.Run(g)
+	}
+}
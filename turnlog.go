@@ -0,0 +1,158 @@
+// This file implements the turn log: a record of the last turns of the game,
+// with the player's input, the number of random draws, and the resulting log
+// events of each turn. It can be exported to a structured file, so that users
+// can attach it to bug reports.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/anaseto/gruid"
+)
+
+const (
+	// maxTurnRecords is the number of turns kept in the turn log.
+	maxTurnRecords = 200
+
+	// turnsFile is the data file to which the turn log is exported.
+	turnsFile = "turns.json"
+)
+
+// turnLogLength is the number of turns exported by the turn log export
+// command.
+var turnLogLength = 50
+
+// countingSource is a random source that counts the numbers drawn from it.
+type countingSource struct {
+	src   rand.Source64
+	Draws int
+}
+
+// newCountingSource returns a new counting source with the given seed.
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{src: rand.NewSource(seed).(rand.Source64)}
+}
+
+func (s *countingSource) Int63() int64 {
+	s.Draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.Draws++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+}
+
+// count returns the number of draws, handling a nil source.
+func (s *countingSource) count() int {
+	if s == nil {
+		return 0
+	}
+	return s.Draws
+}
+
+// turnRecord describes what happened during a turn.
+type turnRecord struct {
+	Depth      int         `json:"depth"`
+	LevelTurns int         `json:"level_turns"`
+	Inputs     []string    `json:"inputs"`    // input since previous turn
+	Draws      int         `json:"rng_draws"` // random numbers drawn
+	Events     []string    `json:"events"`    // log messages
+	HP         int         `json:"hp"`
+	Pos        gruid.Point `json:"pos"`
+}
+
+// turnLog records the last turns of the game. It is not saved.
+type turnLog struct {
+	Turns   []turnRecord
+	pending turnRecord  // turn in progress
+	rngs    *rngStreams // random streams at the start of the pending turn
+	draws   int         // draws of rngs at the start of the pending turn
+}
+
+// noteTurnInput records an input message in the pending turn of the turn
+// log. Only the messages recorded in the event log are considered.
+func (m *model) noteTurnInput(msg gruid.Msg) {
+	if !m.playing() {
+		return
+	}
+	tl := &m.game.turns
+	switch msg := msg.(type) {
+	case gruid.MsgKeyDown:
+		tl.pending.Inputs = append(tl.pending.Inputs, string(msg.Key))
+	case gruid.MsgMouse:
+		tl.pending.Inputs = append(tl.pending.Inputs, fmt.Sprintf("mouse %d at %v", msg.Action, msg.P))
+	}
+}
+
+// noteTurnEvent records a log message in the pending turn of the turn log.
+func (g *game) noteTurnEvent(text string) {
+	g.turns.pending.Events = append(g.turns.pending.Events, text)
+}
+
+// recordTurn ends the pending turn of the turn log.
+func (g *game) recordTurn() {
+	tl := &g.turns
+	rec := tl.pending
+	rec.Depth = g.Depth
+	rec.LevelTurns = g.LevelTurns
+	rec.HP = g.ECS.Fighter[g.ECS.PlayerID].HP
+	rec.Pos = g.ECS.PP()
+	// The map, and so the random streams, may have changed during the
+	// turn.
+	rec.Draws = g.Map.rngs.count() - tl.draws
+	if tl.rngs != g.Map.rngs {
+		rec.Draws = tl.rngs.count() - tl.draws + g.Map.rngs.count()
+	}
+	tl.Turns = append(tl.Turns, rec)
+	if len(tl.Turns) > maxTurnRecords {
+		tl.Turns = tl.Turns[len(tl.Turns)-maxTurnRecords:]
+	}
+	tl.pending = turnRecord{}
+	tl.rngs, tl.draws = g.Map.rngs, g.Map.rngs.count()
+}
+
+// turnLogExport is the structure of an exported turn log.
+type turnLogExport struct {
+	Build    buildInfo    `json:"build"`
+	Seed     int64        `json:"seed"`
+	Options  string       `json:"options"`
+	Scenario string       `json:"scenario"`
+	Turns    []turnRecord `json:"turns"`
+}
+
+// ExportTurns exports the last n turns of the turn log to the turns data
+// file.
+func (g *game) ExportTurns(n int) error {
+	turns := g.turns.Turns
+	if len(turns) == 0 {
+		return errors.New("There are no turns to export yet.")
+	}
+	if n < len(turns) {
+		turns = turns[len(turns)-n:]
+	}
+	ex := turnLogExport{
+		Build:    build,
+		Seed:     g.Seed,
+		Options:  g.Options.String(),
+		Scenario: g.ScenarioName(),
+		Turns:    turns,
+	}
+	data, err := json.MarshalIndent(ex, "", "\t")
+	if err != nil {
+		return fmt.Errorf("Could not export turns: %v", err)
+	}
+	if err := SaveFile(turnsFile, data); err != nil {
+		return fmt.Errorf("Could not export turns: %v", err)
+	}
+	g.Logf("Exported the last %d turns to %s in the data directory.", ColorLogSpecial, len(turns), turnsFile)
+	return nil
+}
@@ -0,0 +1,97 @@
+// This file implements unique monsters: named monsters with bespoke stats,
+// special abilities and guaranteed drops, that appear at most once per game.
+
+package main
+
+import (
+	"github.com/anaseto/gruid"
+)
+
+// uniqueMonster describes a unique monster.
+type uniqueMonster struct {
+	Name    string
+	Kind    monsterKind // base monster kind (faction, AI)
+	Depth   int         // depth where the unique appears
+	Fighter fighter     // bespoke fighting stats
+	Rune    rune
+	Speed   int   // speed, if not normal
+	Regen   int   // turns between regenerated HP, if any
+	Drops   Drops // guaranteed drops
+	OnDeath DeathEffects
+}
+
+// uniques lists the unique monsters of the game.
+var uniques = []uniqueMonster{
+	{
+		Name: "Grishnak the Cruel", Kind: MonsterOrc, Depth: 2,
+		Fighter: fighter{HP: 20, MaxHP: 20, Defense: 1, Power: 5},
+		Rune:    'o', Regen: 1,
+		Drops: Drops{{DropGold, 100}, {DropEquipment, 100}},
+	},
+	{
+		Name: "Fenris the Swift", Kind: MonsterWolf, Depth: 3,
+		Fighter: fighter{HP: 16, MaxHP: 16, Defense: 1, Power: 5},
+		Rune:    'w', Speed: 2 * normalSpeed,
+		Drops: Drops{{DropPotion, 100}, {DropPotion, 100}},
+	},
+	{
+		Name: "Morghul the Deathless", Kind: MonsterNecromancer, Depth: 4,
+		Fighter: fighter{HP: 24, MaxHP: 24, Defense: 2, Power: 4},
+		Rune:    'N', Regen: 1,
+		Drops:   Drops{{DropItem, 100}, {DropItem, 100}, {DropGold, 100}},
+		OnDeath: DeathEffects{{Kind: DeathCurse}},
+	},
+}
+
+// SpawnUniques spawns the unique monsters of the current depth that have not
+// appeared yet in this game.
+func (g *game) SpawnUniques() {
+	if g.UniquesSpawned == nil {
+		g.UniquesSpawned = map[string]bool{}
+	}
+	cands := g.SpawnCandidates()
+	for _, u := range uniques {
+		if u.Depth != g.Depth || g.UniquesSpawned[u.Name] {
+			continue
+		}
+		g.AddUnique(u, g.MonsterSpawnTile(cands))
+		g.UniquesSpawned[u.Name] = true
+	}
+}
+
+// AddUnique adds the given unique monster at p, and returns its id.
+func (g *game) AddUnique(u uniqueMonster, p gruid.Point) int {
+	i := g.AddMonster(u.Kind, p)
+	fi := u.Fighter
+	g.ECS.Fighter[i] = &fi
+	g.ECS.Name[i] = u.Name
+	g.ECS.Style[i] = Style{Rune: u.Rune, Color: ColorUnique}
+	if u.Speed > 0 {
+		g.ECS.Speeds[i] = u.Speed
+	}
+	if u.Regen > 0 {
+		g.ECS.Regen[i] = &Regen{Every: u.Regen}
+	}
+	g.ECS.Drops[i] = u.Drops
+	if u.OnDeath != nil {
+		g.ECS.OnDeath[i] = u.OnDeath
+	}
+	return i
+}
+
+// UniquesHere returns the names of the living unique monsters on the current
+// level.
+func (g *game) UniquesHere() []string {
+	names := []string{}
+	for _, u := range uniques {
+		if u.Depth != g.Depth {
+			continue
+		}
+		for i, name := range g.ECS.Name {
+			if name == u.Name && g.ECS.Alive(i) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,193 @@
+// This file implements a validation pass for loaded games, checking that the
+// decoded state satisfies the invariants the rest of the code relies on.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// validation records the problems found while validating a game.
+type validation struct {
+	repaired []string // problems that were repaired
+	fatal    []string // problems that could not be repaired
+}
+
+func (v *validation) repair(format string, a ...interface{}) {
+	v.repaired = append(v.repaired, fmt.Sprintf(format, a...))
+}
+
+func (v *validation) reject(format string, a ...interface{}) {
+	v.fatal = append(v.fatal, fmt.Sprintf(format, a...))
+}
+
+// err returns an error with a detailed report if there were fatal problems.
+func (v *validation) err() error {
+	if len(v.fatal) == 0 {
+		return nil
+	}
+	return errors.New("invalid saved game: " + strings.Join(v.fatal, "; "))
+}
+
+// Validate checks the invariants of a decoded game: the player should exist,
+// entities should have valid positions on the map, and inventories and
+// equipment should reference valid items. Problems are repaired when
+// possible, and reported in the log. It returns an error with a detailed
+// report if the game cannot be used.
+func (g *game) Validate() error {
+	v := &validation{}
+	if g.ECS == nil || g.Map == nil {
+		v.reject("missing entities or map")
+		return v.err()
+	}
+	g.ECS.InitComponents()
+	g.validateMap(v)
+	g.validatePlayer(v)
+	if err := v.err(); err != nil {
+		return err
+	}
+	g.validateEntities(v)
+	g.validateInventories(v)
+	for _, s := range v.repaired {
+		g.Logf("Saved game repaired: %s.", ColorLogSpecial, s)
+	}
+	return nil
+}
+
+// validateMap checks the map and its associated structures.
+func (g *game) validateMap(v *validation) {
+	m := g.Map
+	if m.Grid.Size().X <= 0 || m.Grid.Size().Y <= 0 {
+		v.reject("empty map")
+		return
+	}
+	if m.Explored == nil {
+		m.Explored = map[gruid.Point]bool{}
+		v.repair("missing explored cells")
+	}
+	if m.Lit == nil {
+		m.Lit = map[gruid.Point]bool{}
+	}
+	if m.Dark == nil {
+		m.Dark = map[gruid.Point]bool{}
+	}
+	if g.PR == nil {
+		g.PR = paths.NewPathRange(m.Grid.Range())
+	}
+}
+
+// validatePlayer checks that the player entity exists and has the components
+// it needs.
+func (g *game) validatePlayer(v *validation) {
+	es := g.ECS
+	i := es.PlayerID
+	if _, ok := es.Entities[i].(*Player); !ok {
+		v.reject("no player entity")
+		return
+	}
+	if fi := es.Fighter[i]; fi == nil || fi.HP <= 0 {
+		v.reject("player has no fighter component or is dead")
+	}
+	p, ok := es.Positions[i]
+	if !ok || !p.In(g.Map.Grid.Range()) || !g.Map.Walkable(p) {
+		v.reject("player is not on a walkable tile")
+	}
+	if es.Player().FOV == nil {
+		v.reject("player has no field of view")
+	}
+	if es.Inventory[i] == nil {
+		es.Inventory[i] = &Inventory{}
+		v.repair("missing player inventory")
+	}
+}
+
+// validateEntities removes entities without a valid position that are not
+// in an inventory.
+func (g *game) validateEntities(v *validation) {
+	es := g.ECS
+	held := map[int]bool{}
+	for _, inv := range es.Inventory {
+		for _, j := range inv.Items {
+			held[j] = true
+		}
+	}
+	for _, j := range g.Stash.Items {
+		held[j] = true
+	}
+	ids := []int{}
+	for i := range es.Entities {
+		ids = append(ids, i)
+	}
+	sort.Ints(ids)
+	for _, i := range ids {
+		if i >= es.NextID {
+			es.NextID = i + 1
+			v.repair("next entity id too small")
+		}
+		if held[i] {
+			continue
+		}
+		p, ok := es.Positions[i]
+		switch {
+		case !ok:
+			v.repair("removed %s without position", es.Name[i])
+		case !p.In(g.Map.Grid.Range()):
+			v.repair("removed %s outside the map", es.Name[i])
+		case es.Blocks[i] && !g.Map.Walkable(p):
+			v.repair("removed %s inside a wall", es.Name[i])
+		default:
+			continue
+		}
+		es.RemoveEntity(i)
+	}
+}
+
+// validateInventories removes references to missing entities from
+// inventories and equipment.
+func (g *game) validateInventories(v *validation) {
+	es := g.ECS
+	for i, inv := range es.Inventory {
+		items := inv.Items[:0]
+		for _, j := range inv.Items {
+			if _, ok := es.Entities[j]; !ok {
+				v.repair("removed missing item from %s inventory", es.Name[i])
+				continue
+			}
+			if _, ok := es.Positions[j]; ok {
+				es.RemovePosition(j)
+				v.repair("removed map position of held %s", es.Name[j])
+			}
+			items = append(items, j)
+		}
+		inv.Items = items
+	}
+	items := g.Stash.Items[:0]
+	for _, j := range g.Stash.Items {
+		if _, ok := es.Entities[j]; !ok {
+			v.repair("removed missing item from the stash")
+			continue
+		}
+		items = append(items, j)
+	}
+	g.Stash.Items = items
+	for i, eq := range es.Equipment {
+		held := map[int]bool{}
+		if inv := es.Inventory[i]; inv != nil {
+			for _, j := range inv.Items {
+				held[j] = true
+			}
+		}
+		for slot, j := range eq {
+			if !held[j] {
+				delete(eq, slot)
+				v.repair("unequipped item not in %s inventory", es.Name[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// This file handles the victory condition of the game: picking up the amulet
+// found on the final level of the dungeon.
+
+package main
+
+import (
+	"log"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// winBonus is the score bonus for winning the game.
+const winBonus = 1000
+
+// PickupAmulet picks up the amulet at the player's position, if any, winning
+// the game. It returns true in that case.
+func (g *game) PickupAmulet() bool {
+	for _, i := range g.ECS.EntitiesAt(g.ECS.PP()) {
+		if _, ok := g.ECS.Entities[i].(*Amulet); !ok {
+			continue
+		}
+		g.Logf("You pickup the %v!", ColorLogSpecial, g.ECS.HighlightName(i, g.ECS.Name[i]))
+		g.ECS.RemoveEntity(i)
+		g.Won = true
+		return true
+	}
+	return false
+}
+
+// endGame switches to the end mode after the run ended with the given
+// outcome (died, won), and records its score.
+func (m *model) endGame(outcome string) gruid.Effect {
+	m.mode = modeEnd
+	if m.replaying {
+		return nil
+	}
+	if m.events != nil {
+		// Keep the event log for post-mortem replay with the -replay
+		// flag. This is done before recording the score, which is not
+		// part of the replayed game.
+		if err := m.SaveEvents(postMortemFile, false); err != nil {
+			log.Printf("could not save post-mortem event log: %v", err)
+		}
+	}
+	// Saves made during the game, for example on a loss of focus, cannot
+	// be continued anymore.
+	RemoveDataFile(saveFile)
+	RemoveDataFile(eventsFile)
+	m.RecordScore(outcome)
+	return nil
+}
+
+// DrawVictory draws the victory screen.
+func (m *model) DrawVictory() gruid.Grid {
+	g := m.game
+	m.grid.Fill(gruid.Cell{Rune: ' '})
+	text := ui.Textf("You found the amulet of the depths!\n\nScenario: %s\nGold:     %d\nScore:    %d\n\nPress “q” or escape to quit.",
+		g.ScenarioName(), g.ECS.Player().Gold, g.Score())
+	label := &ui.Label{
+		Box:     &ui.Box{Title: ui.NewStyledText("Victory", gruid.Style{}.WithFg(ColorLogSpecial))},
+		Content: text,
+	}
+	label.Draw(m.grid.Slice(m.grid.Range().Intersect(m.grid.Range().Add(mainMenuAnchor))))
+	return m.grid
+}
@@ -0,0 +1,74 @@
+// This file implements the warnings strip, which shows ongoing dangers for
+// the player separately from the scrolling log.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/ui"
+)
+
+// warning represents a pinned warning about an ongoing danger. It is shown
+// as long as its condition holds, and cleared automatically afterwards.
+type warning struct {
+	Text  string
+	Check func(g *game) bool
+}
+
+// warnings lists the possible warnings, in display order.
+var warnings = []warning{
+	{Text: "Near death", Check: func(g *game) bool {
+		f := g.ECS.Fighter[g.ECS.PlayerID]
+		return f.HP <= f.MaxHP/4
+	}},
+	{Text: "Confused", Check: func(g *game) bool {
+		return g.ECS.Status(g.ECS.PlayerID, StatusConfused)
+	}},
+	{Text: "Slowed", Check: func(g *game) bool {
+		return g.ECS.Status(g.ECS.PlayerID, StatusSlowed)
+	}},
+	{Text: "Poisoned", Check: func(g *game) bool {
+		return g.ECS.Status(g.ECS.PlayerID, StatusPoisoned)
+	}},
+	{Text: "Bleeding", Check: func(g *game) bool {
+		return g.ECS.Status(g.ECS.PlayerID, StatusBleeding)
+	}},
+	{Text: "Burning", Check: func(g *game) bool {
+		return g.ECS.Status(g.ECS.PlayerID, StatusBurning)
+	}},
+	{Text: "Paralyzed", Check: func(g *game) bool {
+		return g.ECS.Status(g.ECS.PlayerID, StatusParalyzed)
+	}},
+	{Text: "Webbed", Check: func(g *game) bool {
+		return g.ECS.Status(g.ECS.PlayerID, StatusWebbed)
+	}},
+	{Text: "Pack full", Check: func(g *game) bool {
+		return len(g.ECS.Inventory[g.ECS.PlayerID].Items) >= maxInventorySize
+	}},
+}
+
+// Warnings returns the texts of the warnings that currently apply.
+func (g *game) Warnings() []string {
+	ws := []string{}
+	for _, w := range warnings {
+		if w.Check(g) {
+			ws = append(ws, w.Text)
+		}
+	}
+	return ws
+}
+
+// DrawWarnings draws the current warnings, if any, right-aligned on the
+// given line.
+func (m *model) DrawWarnings(gd gruid.Grid) {
+	ws := m.game.Warnings()
+	if len(ws) == 0 {
+		return
+	}
+	st := gruid.Style{}.WithFg(ColorStatusWounded).WithAttrs(AttrReverse)
+	stt := ui.NewStyledText(" "+strings.Join(ws, " | ")+" ", st)
+	w := stt.Size().X
+	stt.Draw(gd.Slice(gd.Range().Shift(gd.Size().X-w, 0, 0, 0)))
+}
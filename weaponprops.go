@@ -0,0 +1,152 @@
+// This file implements weapon properties: some weapons found in the dungeon
+// have a special property, resolved after each of their strikes, that makes
+// them qualitatively different from plain ones.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// weaponProperty represents a special property of a weapon.
+type weaponProperty int
+
+const (
+	PropNone      weaponProperty = iota
+	PropVampiric                 // drains HP from the defender
+	PropCleave                   // also strikes the other enemies next to the wielder
+	PropKnockback                // pushes the defender one step back
+	PropVenom                    // poisons the defender
+)
+
+func (prop weaponProperty) String() (s string) {
+	switch prop {
+	case PropVampiric:
+		s = "vampiric"
+	case PropCleave:
+		s = "cleaving"
+	case PropKnockback:
+		s = "crushing"
+	case PropVenom:
+		s = "venomous"
+	}
+	return s
+}
+
+// Description returns a short description of the property's effect.
+func (prop weaponProperty) Description() (s string) {
+	switch prop {
+	case PropVampiric:
+		s = "heals you by half the damage dealt"
+	case PropCleave:
+		s = "also strikes the other enemies next to you"
+	case PropKnockback:
+		s = "knocks the enemy back"
+	case PropVenom:
+		s = "poisons the enemy"
+	}
+	return s
+}
+
+// weaponProp describes a weapon property that can be generated in the
+// dungeon.
+type weaponProp struct {
+	Prop     weaponProperty
+	MinDepth int // minimum depth at which the property can be found
+}
+
+// weaponProps lists the generated weapon properties.
+var weaponProps = []weaponProp{
+	{Prop: PropKnockback, MinDepth: 2},
+	{Prop: PropVenom, MinDepth: 2},
+	{Prop: PropCleave, MinDepth: 3},
+	{Prop: PropVampiric, MinDepth: 4},
+}
+
+// weaponPropOdds is the chance of generated weapons to have a property, when
+// one can be found at the current depth: one in weaponPropOdds.
+const weaponPropOdds = 4
+
+// RandomWeaponProperty gives a random property suitable for the current
+// depth to the weapon i, if lucky, and names it accordingly.
+func (g *game) RandomWeaponProperty(i int, ek equipKind) {
+	w, ok := g.ECS.Entities[i].(*Weapon)
+	if !ok {
+		return
+	}
+	props := []weaponProperty{}
+	for _, wp := range weaponProps {
+		if wp.MinDepth <= g.Depth {
+			props = append(props, wp.Prop)
+		}
+	}
+	if len(props) == 0 || g.Rand(RNGLoot).Intn(weaponPropOdds) != 0 {
+		return
+	}
+	w.Property = props[g.Rand(RNGLoot).Intn(len(props))]
+	g.ECS.Name[i] = strings.Replace(g.ECS.Name[i], ek.Name, w.Property.String()+" "+ek.Name, 1)
+}
+
+// WeaponStrike resolves the property of the weapon wielded by fighter i in
+// the given slot, after a strike on j with the given power that dealt the
+// given damage.
+func (g *game) WeaponStrike(i, j int, slot equipSlot, power, damage int) {
+	w, ok := g.ECS.Entities[g.ECS.Equipment[i][slot]].(*Weapon)
+	if !ok || !g.ECS.Alive(i) {
+		return
+	}
+	q := g.ECS.Positions[j]
+	seen := g.InFOV(q)
+	switch w.Property {
+	case PropVampiric:
+		if damage <= 0 {
+			break
+		}
+		n := g.ECS.Fighter[i].Heal((damage + 1) / 2)
+		if n > 0 && i == g.ECS.PlayerID {
+			g.Logf("You drain %d HP.", ColorLogItemUse, n)
+		}
+	case PropCleave:
+		p := g.ECS.Positions[i]
+		for _, r := range [4]gruid.Point{p.Shift(1, 0), p.Shift(-1, 0), p.Shift(0, 1), p.Shift(0, -1)} {
+			k := g.ECS.BlockingEntityAt(r)
+			if k < 0 || k == j || !g.ECS.Alive(k) || !g.ECS.Hostile(i, k) {
+				continue
+			}
+			g.AttackWith(i, k, "cleaves", power)
+			if g.ECS.PlayerDied() {
+				return
+			}
+		}
+	case PropKnockback:
+		if damage <= 0 || !g.ECS.Alive(j) {
+			break
+		}
+		p := g.ECS.Positions[i]
+		r := q.Add(q.Sub(p))
+		if paths.DistanceManhattan(p, q) != 1 || !g.Map.Walkable(r) || !g.ECS.NoBlockingEntityAt(r) {
+			break
+		}
+		g.ECS.MoveEntity(j, r)
+		if ai := g.ECS.AI[j]; ai != nil {
+			ai.Path = nil
+		}
+		if j == g.ECS.PlayerID {
+			g.UpdateFOV()
+			g.Logf("You are knocked back!", ColorLogMonsterAttack)
+		} else if seen {
+			g.Logf("%v is knocked back.", ColorLogAbility, g.ECS.HighlightName(j, g.ECS.GetName(j)))
+		}
+	case PropVenom:
+		if damage <= 0 || !g.ECS.Alive(j) || g.ECS.Status(j, StatusPoisoned) {
+			break
+		}
+		g.ECS.PutStatus(j, StatusPoisoned, poisonTurns)
+		if seen {
+			g.Logf("%v is poisoned!", ColorLogAbility, g.ECS.HighlightName(j, g.ECS.GetName(j)))
+		}
+	}
+}